@@ -3,21 +3,25 @@ package root
 import (
 	"github.com/orderly-queue/orderly/cmd/routes"
 	"github.com/orderly-queue/orderly/cmd/serve"
+	"github.com/orderly-queue/orderly/cmd/snapshots"
 	"github.com/orderly-queue/orderly/cmd/token"
-	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/orderly-queue/orderly/internal/server"
 	"github.com/spf13/cobra"
 )
 
-func New(app *app.App) *cobra.Command {
+func New(srv *server.Server) *cobra.Command {
+	app := srv.App()
+
 	cmd := &cobra.Command{
 		Use:     "api",
 		Short:   "Golang template API",
 		Version: app.Version,
 	}
 
-	cmd.AddCommand(serve.New(app))
+	cmd.AddCommand(serve.New(srv))
 	cmd.AddCommand(routes.New(app))
 	cmd.AddCommand(token.New(app))
+	cmd.AddCommand(snapshots.New(app))
 
 	cmd.PersistentFlags().StringP("config", "c", "orderly.yaml", "The path to the api config file")
 
@@ -0,0 +1,48 @@
+package snapshots
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/spf13/cobra"
+)
+
+func newExport(app *app.App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "export [name] [file]",
+		Short: "Export a snapshot to an NDJSON file, writes to stdout when no file is given",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshot, err := app.Snapshotter.Find(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			state, err := app.Snapshotter.Open(cmd.Context(), *snapshot)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if len(args) == 2 && args[1] != "-" {
+				file, err := os.Create(args[1])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+
+			w := bufio.NewWriter(out)
+			enc := json.NewEncoder(w)
+			for _, item := range state {
+				if err := enc.Encode(item); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package snapshots
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pin bool
+)
+
+func newImport(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import an NDJSON file as a new snapshot, reads from stdin when no file is given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if len(args) == 1 && args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				in = file
+			}
+
+			state := []string{}
+			scanner := bufio.NewScanner(in)
+			scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+			for line := 1; scanner.Scan(); line++ {
+				if len(scanner.Bytes()) == 0 {
+					continue
+				}
+				var item string
+				if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+					return fmt.Errorf("invalid item on line %d: %w", line, err)
+				}
+				state = append(state, item)
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			snapshot, err := app.Snapshotter.Import(cmd.Context(), state)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("imported %d items as %s\n", len(state), snapshot.Name)
+
+			if pin {
+				if err := app.Snapshotter.Pin(cmd.Context(), *snapshot); err != nil {
+					return err
+				}
+				fmt.Printf("pinned %s, it will be restored on the next start\n", snapshot.Name)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&pin, "pin", false, "Pin the imported snapshot to be restored on the next start")
+
+	return cmd
+}
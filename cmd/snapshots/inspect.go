@@ -0,0 +1,56 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var (
+	head  int
+	tail  int
+	count bool
+)
+
+func newInspect(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [name]",
+		Short: "Print the head or tail of a snapshot's contents, or the number of items in it",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if head < 0 || tail < 0 {
+				return errors.New("--head and --tail cannot be negative")
+			}
+			snapshot, err := app.Snapshotter.Find(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			state, err := app.Snapshotter.Open(cmd.Context(), *snapshot)
+			if err != nil {
+				return err
+			}
+
+			if count {
+				fmt.Println(len(state))
+				return nil
+			}
+
+			items := state[:min(head, len(state))]
+			if tail > 0 {
+				items = state[max(len(state)-tail, 0):]
+			}
+			for _, item := range items {
+				fmt.Println(item)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&head, "head", 10, "The number of items to print from the front of the queue")
+	cmd.Flags().IntVar(&tail, "tail", 0, "The number of items to print from the back of the queue, takes precedence over --head")
+	cmd.Flags().BoolVar(&count, "count", false, "Print the number of items in the snapshot rather than its contents")
+
+	return cmd
+}
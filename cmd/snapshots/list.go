@@ -0,0 +1,44 @@
+package snapshots
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/spf13/cobra"
+)
+
+func newList(app *app.App) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the snapshots in storage",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snapshots, err := app.Snapshotter.List(cmd.Context())
+			if err != nil {
+				return err
+			}
+			pinned, err := app.Snapshotter.Pinned(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+			// The number of items is shown by inspect --count, counting them
+			// here would download every snapshot
+			fmt.Fprintln(w, "NAME\tTIME\tSIZE\tPINNED")
+			for _, sn := range snapshots {
+				fmt.Fprintf(
+					w,
+					"%s\t%s\t%d\t%t\n",
+					sn.Name,
+					sn.Time.Format(time.RFC3339),
+					sn.Size,
+					pinned != nil && pinned.Name == sn.Name,
+				)
+			}
+			return w.Flush()
+		},
+	}
+}
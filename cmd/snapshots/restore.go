@@ -0,0 +1,104 @@
+package snapshots
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/orderly-queue/orderly/internal/snapshotter"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unpin  bool
+	at     string
+	verify bool
+)
+
+func newRestore(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore [name]",
+		Short: "Pin a snapshot to be restored the next time the server starts",
+		Long: `Pin a snapshot to be restored the next time the server starts.
+
+With --at, the state of the queue is rebuilt as of the given time from the
+latest snapshot before it and the operation log, then imported and pinned as a
+new snapshot.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if unpin || at != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if unpin {
+				if err := app.Snapshotter.Unpin(cmd.Context()); err != nil {
+					return err
+				}
+				fmt.Println("unpinned snapshot")
+				return nil
+			}
+
+			var snapshot *snapshotter.Snapshot
+			var err error
+			if at != "" {
+				snapshot, err = restoreAt(cmd, app)
+			} else {
+				if verify {
+					return errors.New("--verify can only be used with --at")
+				}
+				snapshot, err = app.Snapshotter.Find(cmd.Context(), args[0])
+			}
+			if err != nil || snapshot == nil {
+				return err
+			}
+
+			if err := app.Snapshotter.Pin(cmd.Context(), *snapshot); err != nil {
+				return err
+			}
+			fmt.Printf("pinned %s, it will be restored on the next start\n", snapshot.Name)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&unpin, "unpin", false, "Remove the pinned snapshot so the latest is restored")
+	cmd.Flags().StringVar(&at, "at", "", "Rebuild the queue as of an RFC3339 time using the operation log")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Report the item counts after each step of --at without restoring")
+
+	return cmd
+}
+
+func restoreAt(cmd *cobra.Command, app *app.App) (*snapshotter.Snapshot, error) {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return nil, err
+	}
+
+	state, steps, err := app.Snapshotter.StateAt(cmd.Context(), t)
+	if err != nil {
+		return nil, err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintln(w, "STEP\tOPS\tITEMS")
+	for _, step := range steps {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", step.Name, step.Ops, step.Items)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if verify {
+		return nil, nil
+	}
+
+	snapshot, err := app.Snapshotter.ImportState(cmd.Context(), state)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("imported %d items as of %s as %s\n", len(state.Messages), t.Format(time.RFC3339), snapshot.Name)
+	return snapshot, nil
+}
@@ -0,0 +1,34 @@
+package snapshots
+
+import (
+	"errors"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrStorageDisabled = errors.New("storage must be enabled to manage snapshots")
+)
+
+func New(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "Manage queue snapshots",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !app.Config.Storage.Enabled {
+				return ErrStorageDisabled
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(newList(app))
+	cmd.AddCommand(newInspect(app))
+	cmd.AddCommand(newRestore(app))
+	cmd.AddCommand(newExport(app))
+	cmd.AddCommand(newImport(app))
+	cmd.AddCommand(newTake(app))
+
+	return cmd
+}
@@ -0,0 +1,44 @@
+package snapshots
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/spf13/cobra"
+)
+
+var (
+	endpoint string
+)
+
+func newTake(app *app.App) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "take",
+		Short: "Trigger an on-demand snapshot on a running server",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if endpoint == "" {
+				endpoint = fmt.Sprintf("http://127.0.0.1:%d", app.Config.Http.Port)
+			}
+			client, err := sdk.NewClient(cmd.Context(), sdk.ClientConfig{
+				Endpoint:    endpoint,
+				SendTimeout: time.Minute,
+			})
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			if err := client.Snapshot(cmd.Context()); err != nil {
+				return err
+			}
+			fmt.Println("snapshot taken")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "The url of the running server, defaults to the local http port")
+
+	return cmd
+}
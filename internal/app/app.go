@@ -1,6 +1,7 @@
 package app
 
 import (
+	"cmp"
 	"context"
 	"net/http"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/orderly-queue/orderly/internal/metrics"
 	"github.com/orderly-queue/orderly/internal/probes"
 	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/internal/scheduler"
 	"github.com/orderly-queue/orderly/internal/snapshotter"
 	"github.com/orderly-queue/orderly/internal/storage"
 	"github.com/orderly-queue/orderly/pkg/config"
@@ -32,8 +34,11 @@ type App struct {
 
 	Jwt *jwt.Jwt
 
+	// The default queue in the registry
 	Queue       *queue.Queue
+	Queues      *queue.Registry
 	Snapshotter *snapshotter.Snapshotter
+	Scheduler   *scheduler.Scheduler
 
 	Probes  *probes.Probes
 	Metrics *metrics.Metrics
@@ -43,7 +48,16 @@ type App struct {
 	Storage objstore.Bucket
 }
 
-func New(ctx context.Context, conf *config.Config) (*App, error) {
+type Option func(*App)
+
+// Stores snapshots in the bucket rather than the one in the storage config
+func WithStorage(bucket objstore.Bucket) Option {
+	return func(a *App) {
+		a.Storage = bucket
+	}
+}
+
+func New(ctx context.Context, conf *config.Config, opts ...Option) (*App, error) {
 	enc, err := crypto.NewEncryptor(conf.EncryptionKey)
 	if err != nil {
 		return nil, err
@@ -54,7 +68,7 @@ func New(ctx context.Context, conf *config.Config) (*App, error) {
 
 		Jwt: jwt.New(conf.JwtSecret),
 
-		Queue: queue.New(),
+		Queues: newRegistry(conf.Queue),
 
 		Encryption: enc,
 
@@ -62,7 +76,13 @@ func New(ctx context.Context, conf *config.Config) (*App, error) {
 		Metrics: metrics.New(conf.Telemetry.Metrics.Port),
 	}
 
-	if conf.Storage.Enabled {
+	app.Queue = app.Queues.Default()
+
+	for _, opt := range opts {
+		opt(app)
+	}
+
+	if conf.Storage.Enabled && app.Storage == nil {
 		storage, err := storage.New(conf.Storage)
 		if err != nil {
 			return nil, err
@@ -70,7 +90,89 @@ func New(ctx context.Context, conf *config.Config) (*App, error) {
 		app.Storage = storage
 	}
 
-	app.Snapshotter = snapshotter.New(conf.Queue.Snapshot, app.Queue, app.Storage, app.Metrics.Registry)
+	app.Snapshotter = snapshotter.New(conf.Queue.Snapshot, app.Queues, app.Storage, app.Metrics.Registry)
+	if conf.Queue.Snapshot.Log.Enabled {
+		app.Queues.SetJournal(app.Snapshotter)
+	}
+	app.Scheduler = scheduler.New(app.Queues, app.Snapshotter.Leader, app.Metrics.Registry)
+	app.Snapshotter.OnPromote(app.Scheduler.Promote)
 
 	return app, nil
 }
+
+func newRegistry(conf config.Queue) *queue.Registry {
+	reg := queue.NewRegistry(
+		queue.WithMemoryBudget(conf.Spill.MemoryBudget, conf.Spill.Dir),
+		limits(conf.Limits),
+		queue.WithTTL(conf.Expiry.TTL),
+		queue.WithDeadLetter(conf.Expiry.DeadLetter),
+		queue.WithDedup(conf.Dedup.Window, conf.Dedup.MaxKeys),
+		queue.WithAckTimeout(conf.AckTimeout),
+	)
+
+	// Dead letter queues don't inherit the expiry of the queues they collect
+	// from, otherwise messages would expire out of them too
+	deadLetters := map[string]bool{conf.Expiry.DeadLetter: true}
+	for _, named := range conf.Queues {
+		deadLetters[named.Expiry.DeadLetter] = true
+	}
+	for name := range deadLetters {
+		if _, ok := conf.Queues[name]; !ok && name != "" {
+			reg.Configure(name, queue.WithTTL(0), queue.WithDeadLetter(""))
+		}
+	}
+
+	for name, named := range conf.Queues {
+		opts := []queue.Option{}
+		if deadLetters[name] {
+			opts = append(opts, queue.WithTTL(0), queue.WithDeadLetter(""))
+		}
+		if named.Expiry.TTL > 0 {
+			opts = append(opts, queue.WithTTL(named.Expiry.TTL))
+		}
+		if named.Expiry.DeadLetter != "" {
+			opts = append(opts, queue.WithDeadLetter(named.Expiry.DeadLetter))
+		}
+		if named.Limits.MaxLength > 0 || named.Limits.MaxBytes > 0 {
+			if named.Limits.Overflow == "" {
+				named.Limits.Overflow = conf.Limits.Overflow
+			}
+			opts = append(opts, limits(named.Limits))
+		}
+		if named.Dedup.Window > 0 || named.Dedup.MaxKeys > 0 {
+			opts = append(opts, queue.WithDedup(
+				cmp.Or(named.Dedup.Window, conf.Dedup.Window),
+				cmp.Or(named.Dedup.MaxKeys, conf.Dedup.MaxKeys),
+			))
+		}
+		reg.Configure(name, opts...)
+	}
+	reg.SetAlternate(conf.Routing.Alternate)
+	reg.SetJobTTL(conf.Jobs.TTL)
+	reg.SetMaxQueues(conf.MaxQueues)
+	return reg
+}
+
+func limits(conf config.Limits) queue.Option {
+	return queue.WithLimits(queue.Limits{
+		MaxLength:    conf.MaxLength,
+		MaxBytes:     conf.MaxBytes,
+		Overflow:     queue.Overflow(conf.Overflow),
+		BlockTimeout: conf.BlockTimeout,
+	})
+}
+
+// Returns the schedules defined in the config
+func (a *App) Schedules() []queue.Schedule {
+	out := make([]queue.Schedule, 0, len(a.Config.Queue.Schedules))
+	for _, s := range a.Config.Queue.Schedules {
+		out = append(out, queue.Schedule{
+			Name:   s.Name,
+			Cron:   s.Cron,
+			Queue:  s.Queue,
+			Body:   s.Body,
+			Missed: queue.Missed(s.Missed),
+		})
+	}
+	return out
+}
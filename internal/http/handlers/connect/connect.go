@@ -1,33 +1,83 @@
 package connect
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/olahol/melody"
 	"github.com/orderly-queue/orderly/internal/app"
 	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/internal/snapshotter"
 	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
 	"github.com/orderly-queue/orderly/pkg/sdk/response"
 )
 
+var (
+	ErrSnapshotsDisabled = errors.New("snapshots are not enabled")
+)
+
+// The commands that change the registry, they are refused by a standby until
+// it has taken over and restored the registry
+var writes = map[command.Keyword]struct{}{
+	command.Push:        {},
+	command.Batch:       {},
+	command.Publish:     {},
+	command.Bind:        {},
+	command.Unbind:      {},
+	command.Schedule:    {},
+	command.Unschedule:  {},
+	command.Subscribe:   {},
+	command.Unsubscribe: {},
+	command.Temporary:   {},
+}
+
 type ConnectHandler struct {
 	app *app.App
 
 	consumers      map[uuid.UUID]context.CancelFunc
 	consumersMutex *sync.Mutex
+
+	// The messages delivered to each session that are waiting for an ack,
+	// they are put back on the queue when the session closes
+	deliveries      map[*melody.Session]map[delivered]struct{}
+	deliveriesMutex *sync.Mutex
+
+	// The temporary queue of each session, it is deleted when the session
+	// closes
+	temporary      map[*melody.Session]string
+	temporaryMutex *sync.Mutex
+
+	// The pushes waiting to be run for each session
+	producers      map[*melody.Session]chan produced
+	producersMutex *sync.Mutex
+}
+
+type delivered struct {
+	queue string
+	seq   uint64
 }
 
 func NewConnect(app *app.App) *ConnectHandler {
 	return &ConnectHandler{
-		app:            app,
-		consumers:      make(map[uuid.UUID]context.CancelFunc),
-		consumersMutex: &sync.Mutex{},
+		app:             app,
+		consumers:       make(map[uuid.UUID]context.CancelFunc),
+		consumersMutex:  &sync.Mutex{},
+		deliveries:      make(map[*melody.Session]map[delivered]struct{}),
+		deliveriesMutex: &sync.Mutex{},
+		temporary:       make(map[*melody.Session]string),
+		temporaryMutex:  &sync.Mutex{},
+		producers:       make(map[*melody.Session]chan produced),
+		producersMutex:  &sync.Mutex{},
 	}
 }
 
@@ -36,77 +86,344 @@ func (h *ConnectHandler) Handler() echo.HandlerFunc {
 	m.Config.MaxMessageSize = 256000
 	m.Upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 
-	return func(c echo.Context) error {
-		m.HandleMessage(func(s *melody.Session, b []byte) {
-			cmd, err := command.Parse(string(b))
-			if err != nil {
-				fail(s, cmd.ID, err)
-				return
-			}
+	m.HandleMessage(func(s *melody.Session, b []byte) {
+		cmd, err := command.ParseVersion(string(b), version(s))
+		if err != nil {
+			fail(s, cmd.ID, err)
+			return
+		}
 
-			switch cmd.Keyword {
-			case command.Len:
-				h.len(s, cmd)
-			case command.Push:
-				h.push(s, cmd)
-			case command.Pop:
-				h.pop(s, cmd)
-			case command.Consume:
-				go h.consume(s, cmd)
-			case command.Stop:
-				h.stop(cmd)
-			default:
-				fail(s, cmd.ID, command.ErrInvalidSyntax)
-			}
-		})
+		span := h.span(s.Request.Context(), cmd)
+		if _, ok := writes[cmd.Keyword]; ok && !h.app.Snapshotter.Writable() {
+			end(span, fail(s, cmd.ID, snapshotter.ErrNotRestored))
+			return
+		}
+
+		// Commands that run off the read loop end their span once they finish
+		switch cmd.Keyword {
+		case command.Push, command.Batch, command.Publish:
+			h.produce(s, cmd, span)
+		case command.Consume:
+			go func() {
+				end(span, h.consume(s, cmd))
+			}()
+		case command.Snapshot:
+			go func() {
+				end(span, h.snapshot(s, cmd))
+			}()
+		default:
+			end(span, h.handle(s, cmd))
+		}
+	})
+
+	m.HandleDisconnect(h.release)
 
+	return func(c echo.Context) error {
+		// Answer with the version the session will speak, clients that don't
+		// ask for one speak the first
+		if v := protocol.FromHeader(c.Request().Header); v > protocol.V1 {
+			v.Set(c.Response().Header())
+		}
 		return m.HandleRequest(c.Response(), c.Request())
 	}
 }
 
+// Runs the commands that respond straight away
+func (c *ConnectHandler) handle(s *melody.Session, cmd command.Command) error {
+	switch cmd.Keyword {
+	case command.Len:
+		return c.len(s, cmd)
+	case command.Pop:
+		return c.pop(s, cmd)
+	case command.Stop:
+		c.stop(cmd)
+		return nil
+	case command.Ack:
+		return c.ack(s, cmd)
+	case command.Nack:
+		return c.nack(s, cmd)
+	case command.Temporary:
+		return c.temp(s, cmd)
+	case command.Status:
+		return c.status(s, cmd)
+	case command.Result:
+		return c.result(s, cmd)
+	case command.Subscribe:
+		return c.subscribe(s, cmd)
+	case command.Unsubscribe:
+		return c.unsubscribe(s, cmd)
+	case command.Bind:
+		return c.bind(s, cmd)
+	case command.Unbind:
+		return c.unbind(s, cmd)
+	case command.Bindings:
+		return c.bindings(s, cmd)
+	case command.Schedule:
+		return c.schedule(s, cmd)
+	case command.Unschedule:
+		return c.unschedule(s, cmd)
+	case command.Schedules:
+		return c.schedules(s, cmd)
+	default:
+		return fail(s, cmd.ID, command.ErrInvalidSyntax)
+	}
+}
+
+// Returns the queue named by the command, or the default queue
+func (c *ConnectHandler) queue(cmd command.Command) (*queue.Queue, error) {
+	return c.app.Queues.Get(queueName(cmd))
+}
+
+// Returns the name of the queue the command is for, so deliveries are tracked
+// under the same name whether the default queue is named or not
+func queueName(cmd command.Command) string {
+	return cmp.Or(cmd.Option("queue"), queue.DefaultQueue)
+}
+
 func (c *ConnectHandler) len(s *melody.Session, cmd command.Command) error {
-	len := c.app.Queue.Len()
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	len := q.Len()
 	return respond(s, response.Build(cmd.ID, fmt.Sprintf("%d", len)))
 }
 
 func (c *ConnectHandler) push(s *melody.Session, cmd command.Command) error {
-	c.app.Queue.Push(cmd.Args[0])
-	return respond(s, response.Build(cmd.ID, "ok"))
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	ctx, cancel, opts, err := pushOptions(s, cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	defer cancel()
+
+	resp := response.Build(cmd.ID, "ok")
+	if cmd.Option("job") == "true" {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return fail(s, cmd.ID, err)
+		}
+		opts.Job = id.String()
+		resp = resp.With("job", opts.Job)
+	}
+
+	if err := q.PushWith(ctx, cmd.Args[0], opts); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, resp)
+}
+
+// Pushes every message in the json array with the same options, responding
+// with a json array of the error for each message that is empty when it was
+// pushed
+func (c *ConnectHandler) batch(s *melody.Session, cmd command.Command) error {
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	items := []string{}
+	if err := json.Unmarshal([]byte(cmd.Args[0]), &items); err != nil {
+		return fail(s, cmd.ID, fmt.Errorf("%w: batch must be a json array of strings", command.ErrInvalidSyntax))
+	}
+	// Every item is pushed with the same options, so a dedup key would drop
+	// all but the first and there's only one job id to respond with
+	if cmd.Option("dedup") != "" || cmd.Option("job") != "" {
+		return fail(s, cmd.ID, fmt.Errorf("%w: batch does not support dedup or job", command.ErrInvalidSyntax))
+	}
+	ctx, cancel, opts, err := pushOptions(s, cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	defer cancel()
+
+	errs := make([]string, len(items))
+	for i, item := range items {
+		if err := q.PushWith(ctx, item, opts); err != nil {
+			errs[i] = err.Error()
+		}
+	}
+	by, err := json.Marshal(errs)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, string(by)))
 }
 
 func (c *ConnectHandler) pop(s *melody.Session, cmd command.Command) error {
-	item, err := c.app.Queue.Pop()
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	opts := popOptions(cmd)
+	msg, err := q.PopWith(opts)
 	if err != nil {
 		if errors.Is(err, queue.ErrEmptyQueue) {
 			return respond(s, response.Build(cmd.ID, "nil"))
 		}
 		return fail(s, cmd.ID, err)
 	}
-	return respond(s, response.Build(cmd.ID, item))
+	return respond(s, c.delivery(s, cmd, opts, msg))
 }
 
-func (c *ConnectHandler) consume(s *melody.Session, cmd command.Command) {
+// Delivers messages to the session until the consumer is stopped or the
+// session closes
+func (c *ConnectHandler) consume(s *melody.Session, cmd command.Command) error {
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+
 	ctx, cancel := context.WithCancel(s.Request.Context())
 	c.consumersMutex.Lock()
 	c.consumers[cmd.ID] = cancel
 	c.consumersMutex.Unlock()
 
-	msgs, err := c.app.Queue.Consume(ctx)
+	opts := popOptions(cmd)
+	msgs, err := q.ConsumeWith(ctx, opts)
 	if err != nil {
-		fail(s, cmd.ID, errors.New("failed to start consuming"))
-		return
+		return fail(s, cmd.ID, errors.New("failed to start consuming"))
 	}
 
-	respond(s, response.Build(cmd.ID, "ok"))
+	if err := respond(s, response.Build(cmd.ID, "ok")); err != nil {
+		return err
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
-		case msg := <-msgs:
-			respond(s, response.Build(cmd.ID, msg))
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			respond(s, c.delivery(s, cmd, opts, msg))
+		}
+	}
+}
+
+func popOptions(cmd command.Command) queue.PopOptions {
+	return queue.PopOptions{Ack: cmd.Option("ack") == "true"}
+}
+
+// Builds the response that delivers the message. Messages that need an ack
+// carry their sequence number and are tracked against the session.
+func (c *ConnectHandler) delivery(s *melody.Session, cmd command.Command, opts queue.PopOptions, msg queue.Message) response.Response {
+	resp := response.Build(cmd.ID, msg.Body)
+	for k, v := range msg.Headers {
+		resp = resp.With(headerPrefix+k, v)
+	}
+	if !opts.Ack {
+		return resp
+	}
+	c.deliveriesMutex.Lock()
+	defer c.deliveriesMutex.Unlock()
+	if _, ok := c.deliveries[s]; !ok {
+		c.deliveries[s] = map[delivered]struct{}{}
+	}
+	c.deliveries[s][delivered{queue: queueName(cmd), seq: msg.Seq}] = struct{}{}
+
+	resp = resp.With("seq", strconv.FormatUint(msg.Seq, 10))
+	if msg.Group != "" {
+		resp = resp.With("group", msg.Group)
+	}
+	return resp
+}
+
+// Acks the message, finishing its job with the result and failing it when
+// failed=true
+func (c *ConnectHandler) ack(s *melody.Session, cmd command.Command) error {
+	opts := queue.AckOptions{
+		Result: cmd.Option("result"),
+		Failed: cmd.Option("failed") == "true",
+	}
+	return c.settle(s, cmd, func(q *queue.Queue, seq uint64) error {
+		return q.AckWith(seq, opts)
+	})
+}
+
+// Puts the message back on its queue, after the delay when delay is set
+func (c *ConnectHandler) nack(s *melody.Session, cmd command.Command) error {
+	opts := queue.NackOptions{}
+	if delay := cmd.Option("delay"); delay != "" {
+		dur, err := time.ParseDuration(delay)
+		if err != nil {
+			return fail(s, cmd.ID, fmt.Errorf("%w: invalid delay", command.ErrInvalidSyntax))
+		}
+		opts.Delay = dur
+	}
+	return c.settle(s, cmd, func(q *queue.Queue, seq uint64) error {
+		return q.NackWith(seq, opts)
+	})
+}
+
+func (c *ConnectHandler) settle(s *melody.Session, cmd command.Command, f func(*queue.Queue, uint64) error) error {
+	seq, err := strconv.ParseUint(cmd.Args[0], 10, 64)
+	if err != nil {
+		return fail(s, cmd.ID, fmt.Errorf("%w: invalid sequence number", command.ErrInvalidSyntax))
+	}
+	q, err := c.queue(cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+
+	c.deliveriesMutex.Lock()
+	delete(c.deliveries[s], delivered{queue: queueName(cmd), seq: seq})
+	c.deliveriesMutex.Unlock()
+
+	if err := f(q, seq); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// Puts the messages delivered to the session that weren't acked back on
+// their queues and deletes the session's temporary queue
+func (c *ConnectHandler) release(s *melody.Session) {
+	c.deliveriesMutex.Lock()
+	pending := c.deliveries[s]
+	delete(c.deliveries, s)
+	c.deliveriesMutex.Unlock()
+
+	for d := range pending {
+		q, err := c.app.Queues.Get(d.queue)
+		if err != nil {
+			continue
+		}
+		// The message may already have been put back after the ack timeout
+		_ = q.Nack(d.seq)
+	}
+
+	c.temporaryMutex.Lock()
+	name, ok := c.temporary[s]
+	delete(c.temporary, s)
+	c.temporaryMutex.Unlock()
+	if ok {
+		c.app.Queues.Delete(name)
+	}
+
+	// The producer stops with the session's context
+	c.producersMutex.Lock()
+	delete(c.producers, s)
+	c.producersMutex.Unlock()
+}
+
+// Responds with the name of the session's temporary queue, creating it the
+// first time
+func (c *ConnectHandler) temp(s *melody.Session, cmd command.Command) error {
+	c.temporaryMutex.Lock()
+	defer c.temporaryMutex.Unlock()
+	name, ok := c.temporary[s]
+	if !ok {
+		var err error
+		if name, err = c.app.Queues.Temporary(); err != nil {
+			return fail(s, cmd.ID, err)
 		}
+		c.temporary[s] = name
 	}
+	return respond(s, response.Build(cmd.ID, name))
 }
 
 func (c *ConnectHandler) stop(cmd command.Command) {
@@ -118,12 +435,31 @@ func (c *ConnectHandler) stop(cmd command.Command) {
 	}
 }
 
+func (c *ConnectHandler) snapshot(s *melody.Session, cmd command.Command) error {
+	if !c.app.Config.Queue.Snapshot.Enabled {
+		return fail(s, cmd.ID, ErrSnapshotsDisabled)
+	}
+	if err := c.app.Snapshotter.Snapshot(s.Request.Context()); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// The version of the protocol the session agreed on in its handshake
+func version(s *melody.Session) protocol.Version {
+	return protocol.FromHeader(s.Request.Header)
+}
+
 func respond(s *melody.Session, resp response.Response) error {
-	return s.Write([]byte(resp.String()))
+	return s.Write([]byte(resp.Encode(version(s))))
 }
 
+// Responds with the error, returning it so the command's span records it
 func fail(s *melody.Session, id uuid.UUID, err error) error {
-	return s.Write([]byte(response.Error(id, err).String()))
+	if werr := s.Write([]byte(response.Error(id, err).Encode(version(s)))); werr != nil {
+		return errors.Join(err, werr)
+	}
+	return err
 }
 
 func (c *ConnectHandler) Method() string {
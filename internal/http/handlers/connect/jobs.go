@@ -0,0 +1,30 @@
+package connect
+
+import (
+	"github.com/olahol/melody"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// Responds with the status of the job and the queue it was pushed to
+func (c *ConnectHandler) status(s *melody.Session, cmd command.Command) error {
+	job, err := c.app.Queues.Job(cmd.Args[0])
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, string(job.Status)).With("queue", job.Queue))
+}
+
+// Responds with the result of the finished job, along with whether it
+// succeeded or failed
+func (c *ConnectHandler) result(s *melody.Session, cmd command.Command) error {
+	job, err := c.app.Queues.Job(cmd.Args[0])
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	if !job.Done() {
+		return fail(s, cmd.ID, queue.ErrJobNotDone)
+	}
+	return respond(s, response.Build(cmd.ID, job.Result).With("status", string(job.Status)))
+}
@@ -0,0 +1,105 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/olahol/melody"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// The longest a push waits for space in a full queue, the producer's
+	// timeout can only shorten it
+	maxBlock = time.Second * 30
+
+	// The number of pushes a session can queue up behind a blocked one
+	// before its read loop waits too
+	producerBuffer = 256
+)
+
+// A command waiting for the session's producer and the span it ends
+type produced struct {
+	cmd  command.Command
+	span trace.Span
+}
+
+// Runs the session's pushes, batches and publishes in order off its read
+// loop, so a push blocked on a full queue doesn't stop the acks that would
+// make space for it from being read
+func (c *ConnectHandler) produce(s *melody.Session, cmd command.Command, span trace.Span) {
+	c.producersMutex.Lock()
+	cmds, ok := c.producers[s]
+	if !ok {
+		cmds = make(chan produced, producerBuffer)
+		c.producers[s] = cmds
+		go c.producing(s, cmds)
+	}
+	c.producersMutex.Unlock()
+
+	select {
+	case cmds <- produced{cmd: cmd, span: span}:
+	case <-s.Request.Context().Done():
+		end(span, s.Request.Context().Err())
+	}
+}
+
+func (c *ConnectHandler) producing(s *melody.Session, cmds <-chan produced) {
+	ctx := s.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			// The commands still waiting are dropped with the session
+			for {
+				select {
+				case p := <-cmds:
+					end(p.span, ctx.Err())
+				default:
+					return
+				}
+			}
+		case p := <-cmds:
+			var err error
+			switch p.cmd.Keyword {
+			case command.Push:
+				err = c.push(s, p.cmd)
+			case command.Batch:
+				err = c.batch(s, p.cmd)
+			case command.Publish:
+				err = c.publish(s, p.cmd)
+			}
+			end(p.span, err)
+		}
+	}
+}
+
+// Returns the context a push waits for space with, it ends when the session
+// does, after the producer's timeout or after the max block time
+func pushOptions(s *melody.Session, cmd command.Command) (context.Context, context.CancelFunc, queue.PushOptions, error) {
+	wait := maxBlock
+	if timeout := cmd.Option("timeout"); timeout != "" {
+		dur, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, nil, queue.PushOptions{}, fmt.Errorf("%w: invalid timeout", command.ErrInvalidSyntax)
+		}
+		wait = min(dur, maxBlock)
+	}
+
+	opts := queue.PushOptions{
+		Key:     cmd.Option("dedup"),
+		Group:   cmd.Option("group"),
+		Headers: headers(cmd.Options),
+	}
+	if ttl := cmd.Option("ttl"); ttl != "" {
+		dur, err := time.ParseDuration(ttl)
+		if err != nil || dur <= 0 {
+			return nil, nil, queue.PushOptions{}, fmt.Errorf("%w: invalid ttl", command.ErrInvalidSyntax)
+		}
+		opts.TTL = dur
+	}
+	ctx, cancel := context.WithTimeout(s.Request.Context(), wait)
+	return ctx, cancel, opts, nil
+}
@@ -0,0 +1,41 @@
+package connect
+
+import (
+	"encoding/json"
+
+	"github.com/olahol/melody"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// Adds or replaces the schedule from the cron, queue, body and missed options
+func (c *ConnectHandler) schedule(s *melody.Session, cmd command.Command) error {
+	err := c.app.Scheduler.Add(queue.Schedule{
+		Name:   cmd.Args[0],
+		Cron:   cmd.Option("cron"),
+		Queue:  cmd.Option("queue"),
+		Body:   cmd.Option("body"),
+		Missed: queue.Missed(cmd.Option("missed")),
+	})
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+func (c *ConnectHandler) unschedule(s *melody.Session, cmd command.Command) error {
+	if err := c.app.Scheduler.Remove(cmd.Args[0]); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// Responds with the schedules encoded as json
+func (c *ConnectHandler) schedules(s *melody.Session, cmd command.Command) error {
+	by, err := json.Marshal(c.app.Scheduler.Schedules())
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, string(by)))
+}
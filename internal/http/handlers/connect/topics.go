@@ -0,0 +1,94 @@
+package connect
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/olahol/melody"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// Options prefixed with this set a header on the message, headers are sent
+// back as metadata with the same prefix
+const headerPrefix = "header."
+
+func (c *ConnectHandler) publish(s *melody.Session, cmd command.Command) error {
+	ctx, cancel, opts, err := pushOptions(s, cmd)
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	defer cancel()
+
+	if _, err := c.app.Queues.Publish(ctx, cmd.Args[0], cmd.Args[1], opts); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// Responds with the name of the queue that backs the subscription
+func (c *ConnectHandler) subscribe(s *melody.Session, cmd command.Command) error {
+	name, err := c.app.Queues.Subscribe(cmd.Args[0], cmd.Args[1])
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, name))
+}
+
+func (c *ConnectHandler) unsubscribe(s *melody.Session, cmd command.Command) error {
+	if err := c.app.Queues.Unsubscribe(cmd.Args[0], cmd.Args[1]); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// Adds or replaces the binding, the queues are comma separated and headers
+// are matched from the header.<name> options
+func (c *ConnectHandler) bind(s *melody.Session, cmd command.Command) error {
+	b := queue.Binding{
+		Name:    cmd.Args[0],
+		Match:   queue.Match(cmd.Option("match")),
+		Key:     cmd.Option("key"),
+		Headers: headers(cmd.Options),
+	}
+	if queues := cmd.Option("queues"); queues != "" {
+		b.Queues = strings.Split(queues, ",")
+	}
+	if err := c.app.Queues.Bind(b); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+func (c *ConnectHandler) unbind(s *melody.Session, cmd command.Command) error {
+	if err := c.app.Queues.Unbind(cmd.Args[0]); err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, "ok"))
+}
+
+// Responds with the bindings encoded as json
+func (c *ConnectHandler) bindings(s *melody.Session, cmd command.Command) error {
+	by, err := json.Marshal(c.app.Queues.Bindings())
+	if err != nil {
+		return fail(s, cmd.ID, err)
+	}
+	return respond(s, response.Build(cmd.ID, string(by)))
+}
+
+// Returns the headers set by the header.<name> options
+func headers(opts map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range opts {
+		name, ok := strings.CutPrefix(k, headerPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[name] = v
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package connect
+
+import (
+	"context"
+
+	"github.com/orderly-queue/orderly/internal/tracing"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Starts the span of a command. The websocket is a single long-lived request,
+// so each command gets its own span, parented by the trace the producer put
+// in the message's headers. Commands are linked to the connection's span
+// rather than parented by it, which would make one trace of the whole session.
+func (c *ConnectHandler) span(ctx context.Context, cmd command.Command) trace.Span {
+	conn := trace.LinkFromContext(ctx)
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+	if hdrs := headers(cmd.Options); hdrs != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(hdrs))
+	}
+	_, span := tracing.NewSpan(
+		ctx,
+		"orderly."+string(cmd.Keyword),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithLinks(conn),
+		trace.WithAttributes(cmd.Attributes()...),
+	)
+	return span
+}
+
+// Ends the command's span, marking it as failed when the command returned an
+// error
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -48,6 +48,31 @@ var (
 		Name: "orderly_pending_notifications",
 		Help: "The number of pending notifications for consumers",
 	})
+	Bytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orderly_queue_bytes",
+		Help: "The number of bytes of messages in the queue, held in memory or spilled to disk",
+	}, []string{"location"})
+
+	Rejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_messages_rejected_total",
+		Help: "The number of pushes rejected because the queue was full",
+	})
+	Dropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_messages_dropped_total",
+		Help: "The number of messages dropped from the queue to make space for new ones",
+	})
+	Expired = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_messages_expired_total",
+		Help: "The number of messages removed from the queue because their ttl passed",
+	})
+	DeadLettersDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_dead_letters_dropped_total",
+		Help: "The number of expired messages that could not be moved to their dead letter queue",
+	})
+	Deduplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_messages_deduplicated_total",
+		Help: "The number of pushes acknowledged without enqueueing because their dedup key was seen",
+	})
 )
 
 type Metrics struct {
@@ -80,6 +105,12 @@ func New(port int) *Metrics {
 		m.Registry.MustRegister(Consumers)
 		m.Registry.MustRegister(Size)
 		m.Registry.MustRegister(Pending)
+		m.Registry.MustRegister(Bytes)
+		m.Registry.MustRegister(Rejected)
+		m.Registry.MustRegister(Dropped)
+		m.Registry.MustRegister(Expired)
+		m.Registry.MustRegister(DeadLettersDropped)
+		m.Registry.MustRegister(Deduplicated)
 		m.Registry.MustRegister(collectors.NewBuildInfoCollector())
 		m.Registry.MustRegister(collectors.NewGoCollector())
 		m.Registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
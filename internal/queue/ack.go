@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"errors"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+var (
+	ErrNotInFlight = errors.New("message is not waiting for an ack")
+)
+
+// A message delivered to a consumer that is waiting for an ack
+type delivery struct {
+	msg      Message
+	deadline time.Time
+}
+
+// The options for taking a message from the queue
+type PopOptions struct {
+	// Keep the message until it is acked, it is delivered again when it is
+	// nacked or isn't acked within the ack timeout. A group doesn't deliver
+	// its next message until the one before it is acked.
+	Ack bool
+}
+
+// The options for acking a message
+type AckOptions struct {
+	// The result stored on the message's job
+	Result string
+	// Fail the message's job rather than succeed it, the message is removed
+	// from the queue either way
+	Failed bool
+}
+
+// The options for putting a delivered message back on the queue
+type NackOptions struct {
+	// Holds the message for the delay before it is delivered again, a group
+	// doesn't deliver its next message until then
+	Delay time.Duration
+}
+
+// How long a delivered message waits to be acked before it is delivered again
+func WithAckTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout > 0 {
+			o.ackTimeout = timeout
+		}
+	}
+}
+
+// Takes the next message from the queue
+func (q *Queue) PopWith(opts PopOptions) (Message, error) {
+	return measure(string(command.Pop), func() (Message, error) {
+		q.mu.Lock()
+		msg, expired, err := q.next()
+		if err == nil {
+			q.deliver(msg, opts)
+		}
+		q.mu.Unlock()
+		q.expire(expired)
+		return msg, err
+	})
+}
+
+// Called with the lock held
+func (q *Queue) deliver(msg Message, opts PopOptions) {
+	if !opts.Ack {
+		q.record(Op{Type: OpRemove, Seq: msg.Seq})
+		q.track(msg, StatusSucceeded, "")
+		return
+	}
+	q.inflight[msg.Seq] = delivery{msg: msg, deadline: time.Now().Add(q.ackTimeout)}
+	q.track(msg, StatusInFlight, "")
+	if msg.Group != ungrouped {
+		q.groups.lock(msg.Group, msg.Seq)
+		q.notify()
+	}
+}
+
+// Removes a delivered message from the queue once it has been processed
+func (q *Queue) Ack(seq uint64) error {
+	return q.AckWith(seq, AckOptions{})
+}
+
+// Removes a delivered message from the queue, finishing its job
+func (q *Queue) AckWith(seq uint64, opts AckOptions) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d, ok := q.inflight[seq]
+	if !ok {
+		return ErrNotInFlight
+	}
+	delete(q.inflight, seq)
+	q.record(Op{Type: OpRemove, Seq: seq})
+	if opts.Failed {
+		q.track(d.msg, StatusFailed, opts.Result)
+	} else {
+		q.track(d.msg, StatusSucceeded, opts.Result)
+	}
+	if d.msg.Group != ungrouped {
+		q.groups.unlock(d.msg.Group, seq)
+	}
+	q.notify()
+	q.free()
+	return nil
+}
+
+// Puts a delivered message back at the front of the queue so it is delivered
+// again
+func (q *Queue) Nack(seq uint64) error {
+	return q.NackWith(seq, NackOptions{})
+}
+
+// Puts a delivered message back at the front of the queue once the delay has
+// passed
+func (q *Queue) NackWith(seq uint64, opts NackOptions) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d, ok := q.inflight[seq]
+	if !ok {
+		return ErrNotInFlight
+	}
+	if opts.Delay <= 0 {
+		q.requeue(seq)
+		return nil
+	}
+	d.deadline = time.Now().Add(opts.Delay)
+	q.inflight[seq] = d
+	time.AfterFunc(opts.Delay, func() {
+		q.retry(seq, d.deadline)
+	})
+	return nil
+}
+
+// Delivers a delayed message again unless it was settled or nacked again
+// while it was held
+func (q *Queue) retry(seq uint64, deadline time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if d, ok := q.inflight[seq]; ok && d.deadline.Equal(deadline) {
+		q.requeue(seq)
+	}
+}
+
+// Called with the lock held
+func (q *Queue) requeue(seq uint64) {
+	d := q.inflight[seq]
+	delete(q.inflight, seq)
+	if d.msg.Group == ungrouped {
+		q.buf.pushFront(d.msg)
+	} else {
+		q.groups.unlock(d.msg.Group, seq)
+		q.groups.pushFront(d.msg)
+	}
+	q.track(d.msg, StatusQueued, "")
+	q.notify()
+}
+
+// Delivers the messages that weren't acked in time again, called with the lock
+// held
+func (q *Queue) redeliver(now time.Time) int {
+	count := 0
+	for seq, d := range q.inflight {
+		if now.After(d.deadline) {
+			q.requeue(seq)
+			count++
+		}
+	}
+	return count
+}
+
+// The number of messages in the queue including those waiting for an ack,
+// called with the lock held
+func (q *Queue) length() int {
+	return q.buf.len() + q.groups.length + len(q.inflight)
+}
+
+// The bytes of the messages in the queue including those waiting for an ack,
+// called with the lock held
+func (q *Queue) size() int64 {
+	out := q.buf.bytes() + q.groups.bytes
+	for _, d := range q.inflight {
+		out += d.msg.size()
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"container/list"
+	"sort"
+	"time"
+)
+
+// Records that a message with the dedup key in the body was pushed, the key
+// is remembered until the op's expiry
+var OpDedup OpType = "dedup"
+
+// A dedup key remembered by the queue
+type DedupKey struct {
+	Key string `json:"key"`
+	// The unix time in nanoseconds the key is forgotten at
+	Expires int64 `json:"expires"`
+}
+
+// Remembers the dedup keys of pushed messages for the window so that retried
+// pushes aren't enqueued twice
+func WithDedup(window time.Duration, maxKeys uint) Option {
+	return func(o *options) {
+		o.dedupWindow = window
+		o.dedupKeys = maxKeys
+	}
+}
+
+// Remembers keys in the order they were pushed, which is also the order they
+// expire in as every key is remembered for the same window
+type dedup struct {
+	window time.Duration
+	max    uint
+
+	keys  map[string]*list.Element
+	order *list.List
+}
+
+func newDedup(window time.Duration, max uint) *dedup {
+	return &dedup{
+		window: window,
+		max:    max,
+		keys:   map[string]*list.Element{},
+		order:  list.New(),
+	}
+}
+
+func (d *dedup) enabled() bool {
+	return d.window > 0
+}
+
+// Whether the key has been seen within the window
+func (d *dedup) seen(key string, now time.Time) bool {
+	d.evict(now)
+	_, ok := d.keys[key]
+	return ok
+}
+
+// Remembers the key, returning when it will be forgotten
+func (d *dedup) remember(key string, now time.Time) int64 {
+	expires := now.Add(d.window).UnixNano()
+	d.add(DedupKey{Key: key, Expires: expires})
+	d.evict(now)
+	return expires
+}
+
+func (d *dedup) add(key DedupKey) {
+	if e, ok := d.keys[key.Key]; ok {
+		d.order.Remove(e)
+	}
+	d.keys[key.Key] = d.order.PushBack(key)
+}
+
+// Forgets expired keys and the oldest keys over the limit
+func (d *dedup) evict(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		key := e.Value.(DedupKey)
+		if key.Expires > now.UnixNano() && (d.max == 0 || uint(d.order.Len()) <= d.max) {
+			return
+		}
+		d.order.Remove(e)
+		delete(d.keys, key.Key)
+	}
+}
+
+func (d *dedup) state() []DedupKey {
+	if d.order.Len() == 0 {
+		return nil
+	}
+	out := make([]DedupKey, 0, d.order.Len())
+	for e := d.order.Front(); e != nil; e = e.Next() {
+		out = append(out, e.Value.(DedupKey))
+	}
+	return out
+}
+
+func (d *dedup) restore(keys []DedupKey, now time.Time) {
+	d.keys = map[string]*list.Element{}
+	d.order.Init()
+	sorted := make([]DedupKey, len(keys))
+	copy(sorted, keys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Expires < sorted[j].Expires
+	})
+	for _, key := range sorted {
+		d.add(key)
+	}
+	d.evict(now)
+}
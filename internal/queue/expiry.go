@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/metrics"
+)
+
+// The longest the expired messages wait for space in a dead letter queue that
+// blocks producers when it is full
+const deadLetterTimeout = time.Second
+
+// Expires messages pushed without their own TTL after the duration
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// Moves expired messages to the named queue in the same registry instead of
+// discarding them
+func WithDeadLetter(name string) Option {
+	return func(o *options) {
+		o.deadLetter = name
+	}
+}
+
+func (q *Queue) deadline(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		ttl = q.ttl
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+func (m Message) expired(now time.Time) bool {
+	return m.Expires > 0 && m.Expires <= now.UnixNano()
+}
+
+// Removes the expired messages from anywhere in the queue and delivers the
+// messages that weren't acked in time again, returning the number expired
+func (q *Queue) Sweep() int {
+	q.mu.Lock()
+	now := time.Now()
+	match := func(msg Message) bool {
+		return msg.expired(now)
+	}
+	expired, err := q.buf.removeIf(match)
+	if err != nil {
+		logger.Logger(context.Background()).Errorw("failed to sweep spilled messages", "error", err)
+	}
+	expired = append(expired, q.groups.removeIf(match)...)
+	for _, msg := range expired {
+		q.record(Op{Type: OpRemove, Seq: msg.Seq})
+	}
+	q.redeliver(now)
+	q.notify()
+	if len(expired) > 0 {
+		q.free()
+	}
+	q.mu.Unlock()
+
+	q.expire(expired)
+	return len(expired)
+}
+
+// Counts the expired messages and moves them to the dead letter queue, called
+// without the lock held as the dead letter queue may be this queue
+func (q *Queue) expire(msgs []Message) {
+	if len(msgs) == 0 {
+		return
+	}
+	metrics.Expired.Add(float64(len(msgs)))
+	q.deadLetters(msgs)
+	// Tracked after the move, so their jobs are failed rather than queued in
+	// the dead letter queue
+	for _, msg := range msgs {
+		q.track(msg, StatusFailed, "expired")
+	}
+}
+
+// Moves the messages to the dead letter queue with their group and headers
+func (q *Queue) deadLetters(msgs []Message) {
+	if q.deadLetter == "" || q.deadLetter == q.name || q.registry == nil {
+		return
+	}
+	dlq, err := q.registry.Get(q.deadLetter)
+	if err != nil {
+		metrics.DeadLettersDropped.Add(float64(len(msgs)))
+		logger.Logger(context.Background()).Errorw("failed to get dead letter queue", "queue", q.deadLetter, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadLetterTimeout)
+	defer cancel()
+	for _, msg := range msgs {
+		if err := dlq.PushWith(ctx, msg.Body, PushOptions{Group: msg.Group, Headers: msg.Headers}); err != nil {
+			metrics.DeadLettersDropped.Inc()
+			logger.Logger(ctx).Warnw("failed to move expired message to the dead letter queue", "queue", q.deadLetter, "error", err)
+		}
+	}
+}
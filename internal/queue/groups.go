@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"container/list"
+)
+
+// Schedules delivery round robin across the ungrouped messages and each group
+// of messages. Grouped messages are kept in memory in a list per group so a
+// busy group doesn't hold up the others. A group that is waiting for a
+// delivered message to be acked is taken out of the rotation until it is.
+type groups struct {
+	lanes map[string]*list.List
+
+	// The lanes ready to deliver in the order they take turns, the ungrouped
+	// lane is always in the rotation
+	ring  *list.List
+	turns map[string]*list.Element
+
+	// The sequence number of the message each group is waiting on
+	locked map[string]uint64
+
+	length int
+	bytes  int64
+	// The number of messages in locked groups
+	waiting int
+}
+
+// The lane of messages without a group
+const ungrouped = ""
+
+func newGroups() *groups {
+	g := &groups{}
+	g.reset()
+	return g
+}
+
+func (g *groups) reset() {
+	g.lanes = map[string]*list.List{}
+	g.ring = list.New()
+	g.turns = map[string]*list.Element{ungrouped: g.ring.PushBack(ungrouped)}
+	g.locked = map[string]uint64{}
+	g.length = 0
+	g.bytes = 0
+	g.waiting = 0
+}
+
+func (g *groups) pushBack(msg Message) {
+	lane, ok := g.lanes[msg.Group]
+	if !ok {
+		lane = list.New()
+		g.lanes[msg.Group] = lane
+	}
+	lane.PushBack(msg)
+	g.count(msg, 1)
+	g.ready(msg.Group)
+}
+
+// Puts a message back at the front of its group
+func (g *groups) pushFront(msg Message) {
+	lane, ok := g.lanes[msg.Group]
+	if !ok {
+		lane = list.New()
+		g.lanes[msg.Group] = lane
+	}
+	lane.PushFront(msg)
+	g.count(msg, 1)
+	g.ready(msg.Group)
+}
+
+// Adds the group to the rotation if it has messages and isn't locked
+func (g *groups) ready(group string) {
+	if _, ok := g.turns[group]; ok {
+		return
+	}
+	if _, ok := g.locked[group]; ok {
+		return
+	}
+	if lane, ok := g.lanes[group]; !ok || lane.Len() == 0 {
+		return
+	}
+	g.turns[group] = g.ring.PushBack(group)
+}
+
+func (g *groups) count(msg Message, delta int) {
+	g.length += delta
+	g.bytes += int64(delta) * msg.size()
+	if _, ok := g.locked[msg.Group]; ok {
+		g.waiting += delta
+	}
+}
+
+// Returns the lanes in the order they should be tried
+func (g *groups) order() []string {
+	out := make([]string, 0, g.ring.Len())
+	for e := g.ring.Front(); e != nil; e = e.Next() {
+		out = append(out, e.Value.(string))
+	}
+	return out
+}
+
+// Moves the lane to the back of the rotation once it has delivered a message
+func (g *groups) served(lane string) {
+	if e, ok := g.turns[lane]; ok {
+		g.ring.MoveToBack(e)
+	}
+}
+
+func (g *groups) popFront(group string) (Message, bool) {
+	lane, ok := g.lanes[group]
+	if !ok || lane.Len() == 0 {
+		return Message{}, false
+	}
+	msg := lane.Remove(lane.Front()).(Message)
+	g.count(msg, -1)
+	if lane.Len() == 0 {
+		delete(g.lanes, group)
+		g.unready(group)
+	}
+	return msg, true
+}
+
+// Removes the message with the lowest sequence number across every group
+func (g *groups) popOldest() (Message, bool) {
+	oldest := ""
+	var seq uint64
+	found := false
+	for group, lane := range g.lanes {
+		msg := lane.Front().Value.(Message)
+		if !found || msg.Seq < seq {
+			oldest, seq, found = group, msg.Seq, true
+		}
+	}
+	if !found {
+		return Message{}, false
+	}
+	return g.popFront(oldest)
+}
+
+func (g *groups) unready(group string) {
+	if group == ungrouped {
+		return
+	}
+	if e, ok := g.turns[group]; ok {
+		g.ring.Remove(e)
+		delete(g.turns, group)
+	}
+}
+
+// Stops delivering from the group until it is unlocked
+func (g *groups) lock(group string, seq uint64) {
+	if _, ok := g.locked[group]; !ok {
+		if lane, ok := g.lanes[group]; ok {
+			g.waiting += lane.Len()
+		}
+	}
+	g.locked[group] = seq
+	g.unready(group)
+}
+
+// Starts delivering from the group again if it is locked by the message
+func (g *groups) unlock(group string, seq uint64) {
+	if locked, ok := g.locked[group]; !ok || locked != seq {
+		return
+	}
+	delete(g.locked, group)
+	if lane, ok := g.lanes[group]; ok {
+		g.waiting -= lane.Len()
+	}
+	g.ready(group)
+}
+
+func (g *groups) each(f func(Message)) {
+	for _, lane := range g.lanes {
+		for e := lane.Front(); e != nil; e = e.Next() {
+			f(e.Value.(Message))
+		}
+	}
+}
+
+// Removes the messages that match from every group
+func (g *groups) removeIf(match func(Message) bool) []Message {
+	out := []Message{}
+	for group, lane := range g.lanes {
+		for e := lane.Front(); e != nil; {
+			next := e.Next()
+			if msg := e.Value.(Message); match(msg) {
+				out = append(out, msg)
+				lane.Remove(e)
+				g.count(msg, -1)
+			}
+			e = next
+		}
+		if lane.Len() == 0 {
+			delete(g.lanes, group)
+			g.unready(group)
+		}
+	}
+	return out
+}
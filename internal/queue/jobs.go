@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+const (
+	// The header that holds the id of the job a message belongs to
+	HeaderJob = "job_id"
+)
+
+var (
+	// Records the status of a job, the job is stored in the op
+	OpJob OpType = "job"
+
+	ErrJobMissing = response.ErrJobMissing
+	ErrJobNotDone = response.ErrJobNotDone
+)
+
+type Status string
+
+var (
+	// The message is waiting in the queue
+	StatusQueued Status = "queued"
+	// The message was delivered and is waiting for an ack
+	StatusInFlight Status = "in_flight"
+	// The message was acked, or delivered to a consumer that doesn't ack
+	StatusSucceeded Status = "succeeded"
+	// The message was failed by its consumer, expired or was dropped
+	StatusFailed Status = "failed"
+)
+
+// The status of a message pushed as a job, finished jobs are kept until they
+// expire
+type Job struct {
+	ID      string `json:"id"`
+	Queue   string `json:"queue"`
+	Status  Status `json:"status"`
+	Result  string `json:"result,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+// Whether the job has succeeded or failed
+func (j Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+func (j Job) expired(now time.Time) bool {
+	return j.Expires > 0 && now.UnixNano() >= j.Expires
+}
+
+// Tracks the jobs of every queue in a registry. It has its own lock as queues
+// update it with their lock held.
+type jobs struct {
+	mu      *sync.Mutex
+	byID    map[string]Job
+	ttl     time.Duration
+	journal Journal
+}
+
+func newJobs() *jobs {
+	return &jobs{
+		mu:   &sync.Mutex{},
+		byID: map[string]Job{},
+		ttl:  time.Hour * 24,
+	}
+}
+
+func (j *jobs) set(job Job) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job.Done() {
+		job.Expires = time.Now().Add(j.ttl).UnixNano()
+	}
+	j.byID[job.ID] = job
+	if j.journal != nil {
+		j.journal.Record(Op{Time: time.Now(), Type: OpJob, Job: &job})
+	}
+}
+
+// Removes the finished jobs that have expired
+func (j *jobs) sweep(now time.Time) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for id, job := range j.byID {
+		if job.expired(now) {
+			delete(j.byID, id)
+		}
+	}
+}
+
+// Sets how long finished jobs are kept for
+func (r *Registry) SetJobTTL(ttl time.Duration) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	if ttl > 0 {
+		r.jobs.ttl = ttl
+	}
+}
+
+// Returns the job with the id
+func (r *Registry) Job(id string) (Job, error) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	job, ok := r.jobs.byID[id]
+	if !ok || job.expired(time.Now()) {
+		return Job{}, ErrJobMissing
+	}
+	return job, nil
+}
+
+// Returns the jobs sorted by id, nil when there are none
+func (r *Registry) jobsState() []Job {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	if len(r.jobs.byID) == 0 {
+		return nil
+	}
+	out := make([]Job, 0, len(r.jobs.byID))
+	for _, id := range slices.Sorted(maps.Keys(r.jobs.byID)) {
+		out = append(out, r.jobs.byID[id])
+	}
+	return out
+}
+
+func (r *Registry) restoreJobs(jobs []Job) {
+	r.jobs.mu.Lock()
+	defer r.jobs.mu.Unlock()
+	now := time.Now()
+	r.jobs.byID = make(map[string]Job, len(jobs))
+	for _, job := range jobs {
+		if !job.expired(now) {
+			r.jobs.byID[job.ID] = job
+		}
+	}
+}
+
+// Updates the status of the message's job, messages that weren't pushed as
+// jobs or to a queue outside a registry aren't tracked
+func (q *Queue) track(msg Message, status Status, result string) {
+	id := msg.Headers[HeaderJob]
+	if id == "" || q.registry == nil {
+		return
+	}
+	q.registry.jobs.set(Job{ID: id, Queue: q.name, Status: status, Result: result})
+}
@@ -0,0 +1,101 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/metrics"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+var (
+	ErrQueueFull = response.ErrQueueFull
+)
+
+// What happens when a push would take the queue over its limits
+type Overflow string
+
+var (
+	// Reject the push with ErrQueueFull
+	OverflowReject Overflow = "reject"
+	// Drop the oldest messages until the new one fits
+	OverflowDropOldest Overflow = "drop_oldest"
+	// Block the producer until there is space or its timeout is hit
+	OverflowBlock Overflow = "block"
+)
+
+type Limits struct {
+	// The max number of messages in the queue, 0 is unlimited
+	MaxLength uint
+	// The max number of bytes of messages in the queue, 0 is unlimited
+	MaxBytes int64
+	Overflow Overflow
+	// The longest a producer is blocked for, 0 only waits for the producer's
+	// own timeout
+	BlockTimeout time.Duration
+}
+
+func (l Limits) enabled() bool {
+	return l.MaxLength > 0 || l.MaxBytes > 0
+}
+
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// Whether the message fits in the queue, called with the lock held
+func (q *Queue) fits(msg Message) bool {
+	if q.limits.MaxLength > 0 && uint(q.length())+1 > q.limits.MaxLength {
+		return false
+	}
+	if q.limits.MaxBytes > 0 && q.size()+msg.size() > q.limits.MaxBytes {
+		return false
+	}
+	return true
+}
+
+// Makes space for the message according to the overflow policy, called with
+// the lock held. When the policy is to block, the returned channel is closed
+// when space may have been freed.
+func (q *Queue) overflow(msg Message) (<-chan struct{}, error) {
+	if q.limits.MaxBytes > 0 && msg.size() > q.limits.MaxBytes {
+		metrics.Rejected.Inc()
+		return nil, fmt.Errorf("%w: message is larger than the queue", ErrQueueFull)
+	}
+
+	switch q.limits.Overflow {
+	case OverflowDropOldest:
+		for !q.fits(msg) {
+			dropped, err := q.remove()
+			if errors.Is(err, ErrEmptyQueue) {
+				// The messages waiting for an ack fill the queue on their own
+				metrics.Rejected.Inc()
+				return nil, fmt.Errorf("%w: no messages left to drop", ErrQueueFull)
+			}
+			if err != nil {
+				return nil, err
+			}
+			q.track(dropped, StatusFailed, "dropped")
+			metrics.Dropped.Inc()
+		}
+		return nil, nil
+	case OverflowBlock:
+		return q.freed, nil
+	default:
+		metrics.Rejected.Inc()
+		return nil, ErrQueueFull
+	}
+}
+
+// Signals any blocked producers that space may have been freed, called with
+// the lock held
+func (q *Queue) free() {
+	if !q.limits.enabled() {
+		return
+	}
+	close(q.freed)
+	q.freed = make(chan struct{})
+}
@@ -1,9 +1,13 @@
 package queue
 
 import (
-	"container/list"
 	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -20,9 +24,94 @@ var (
 	ErrUnknown    = errors.New("unknown error")
 )
 
+type Message struct {
+	// The sequence number of the message, assigned when it is pushed and
+	// increases with every push
+	Seq  uint64 `json:"seq"`
+	Body string `json:"body"`
+	// The unix time in nanoseconds the message expires at, 0 never expires
+	Expires int64 `json:"expires,omitempty"`
+	// Messages in the same group are delivered in order, one at a time to
+	// consumers that ack them
+	Group   string            `json:"group,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// The state of the queue, used to snapshot and restore it
+type State struct {
+	// The sequence number that will be assigned to the next message
+	Seq      uint64    `json:"seq"`
+	Messages []Message `json:"messages"`
+
+	// The dedup keys remembered by the queue
+	Dedup []DedupKey `json:"dedup,omitempty"`
+
+	// The state of the other named queues in the registry
+	Queues map[string]State `json:"queues,omitempty"`
+	// The subscriptions to each topic
+	Topics map[string][]string `json:"topics,omitempty"`
+	// The bindings that route published messages to queues
+	Bindings []Binding `json:"bindings,omitempty"`
+	// The jobs of every queue in the registry
+	Jobs []Job `json:"jobs,omitempty"`
+	// The schedules that push messages to the queues
+	Schedules []Schedule `json:"schedules,omitempty"`
+}
+
+type OpType string
+
+var (
+	OpPush   OpType = "push"
+	OpRemove OpType = "remove"
+	// Removes all the messages with a sequence number lower than the op's
+	OpDrain OpType = "drain"
+)
+
+// An operation that changed the queue, recorded so the queue can be rebuilt
+// from a snapshot and the operations that came after it
+type Op struct {
+	Time time.Time `json:"time"`
+	Type OpType    `json:"type"`
+	// The named queue the op was made on, empty for the default queue
+	Queue   string `json:"queue,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	Seq     uint64 `json:"seq"`
+	Body    string `json:"body,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+	Group   string `json:"group,omitempty"`
+
+	Headers  map[string]string `json:"headers,omitempty"`
+	Binding  *Binding          `json:"binding,omitempty"`
+	Job      *Job              `json:"job,omitempty"`
+	Schedule *Schedule         `json:"schedule,omitempty"`
+}
+
+type Journal interface {
+	Record(Op)
+}
+
 type Queue struct {
-	list *list.List
-	mu   *sync.RWMutex
+	buf    *buffer
+	groups *groups
+	mu     *sync.RWMutex
+	seq    uint64
+
+	// Messages delivered to consumers that haven't been acked yet
+	inflight   map[uint64]delivery
+	ackTimeout time.Duration
+
+	limits Limits
+	freed  chan struct{}
+
+	// The name of the queue in its registry
+	name       string
+	ttl        time.Duration
+	deadLetter string
+	registry   *Registry
+
+	dedup *dedup
+
+	journal Journal
 
 	pending *atomic.Int64
 
@@ -30,10 +119,52 @@ type Queue struct {
 	listeners  map[uuid.UUID]chan struct{}
 }
 
-func New() *Queue {
+type options struct {
+	budget     int64
+	dir        string
+	limits     Limits
+	ttl        time.Duration
+	deadLetter string
+
+	dedupWindow time.Duration
+	dedupKeys   uint
+
+	ackTimeout time.Duration
+}
+
+type Option func(*options)
+
+// Spills the middle of the queue to segment files in the directory when the
+// messages held in memory exceed the budget in bytes
+func WithMemoryBudget(budget int64, dir string) Option {
+	return func(o *options) {
+		o.budget = budget
+		if dir != "" {
+			o.dir = dir
+		}
+	}
+}
+
+func New(opts ...Option) *Queue {
+	o := &options{
+		dir:        filepath.Join(os.TempDir(), "orderly"),
+		ackTimeout: time.Second * 30,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return &Queue{
-		list:       list.New(),
+		buf:        newBuffer(o.budget, o.dir),
+		groups:     newGroups(),
 		mu:         &sync.RWMutex{},
+		inflight:   map[uint64]delivery{},
+		ackTimeout: o.ackTimeout,
+		limits:     o.limits,
+		freed:      make(chan struct{}),
+		ttl:        o.ttl,
+		deadLetter: o.deadLetter,
+		dedup:      newDedup(o.dedupWindow, o.dedupKeys),
 		pending:    &atomic.Int64{},
 		listenLock: &sync.RWMutex{},
 		listeners:  make(map[uuid.UUID]chan struct{}),
@@ -44,54 +175,213 @@ func (q *Queue) Len() uint {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 	len, _ := measure(string(command.Len), func() (uint, error) {
-		return uint(q.list.Len()), nil
+		return uint(q.buf.len() + q.groups.length), nil
 	})
 	return len
 }
 
-func (q *Queue) Push(item string) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	measure(string(command.Push), func() (struct{}, error) {
-		q.list.PushBack(item)
-		q.notify()
-		return struct{}{}, nil
+// The optional attributes of a pushed message
+type PushOptions struct {
+	// How long the message lives for before it expires, 0 uses the queue's
+	// default
+	TTL time.Duration
+
+	// Pushes with the same key within the queue's dedup window are only
+	// enqueued once
+	Key string
+
+	// The group the message is delivered in order with
+	Group string
+
+	Headers map[string]string
+
+	// Tracks the status of the message as a job with the id, stored in the
+	// job_id header. Pushes that are deduplicated don't create a job.
+	Job string
+}
+
+func (q *Queue) Push(item string) error {
+	return q.PushContext(context.Background(), item)
+}
+
+// Pushes the message to the queue, blocking when the queue is full and the
+// overflow policy is to block
+func (q *Queue) PushContext(ctx context.Context, item string) error {
+	return q.PushWith(ctx, item, PushOptions{})
+}
+
+// Pushes the message to the queue with the options, blocking when the queue is
+// full and the overflow policy is to block
+func (q *Queue) PushWith(ctx context.Context, item string, opts PushOptions) error {
+	_, err := measure(string(command.Push), func() (struct{}, error) {
+		if q.limits.BlockTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, q.limits.BlockTimeout)
+			defer cancel()
+		}
+		msg := Message{Body: item, Expires: q.deadline(opts.TTL), Group: opts.Group, Headers: opts.Headers}
+		if opts.Job != "" {
+			msg.Headers = maps.Clone(opts.Headers)
+			if msg.Headers == nil {
+				msg.Headers = map[string]string{}
+			}
+			msg.Headers[HeaderJob] = opts.Job
+		}
+		for {
+			q.mu.Lock()
+			if opts.Key != "" && q.dedup.enabled() && q.dedup.seen(opts.Key, time.Now()) {
+				q.mu.Unlock()
+				metrics.Deduplicated.Inc()
+				return struct{}{}, nil
+			}
+			var freed <-chan struct{}
+			if q.limits.enabled() && !q.fits(msg) {
+				var err error
+				if freed, err = q.overflow(msg); err != nil {
+					q.mu.Unlock()
+					return struct{}{}, err
+				}
+			}
+			if freed == nil {
+				q.pushMessage(msg)
+				if opts.Key != "" && q.dedup.enabled() {
+					expires := q.dedup.remember(opts.Key, time.Now())
+					q.record(Op{Type: OpDedup, Body: opts.Key, Expires: expires})
+				}
+				q.notify()
+				q.mu.Unlock()
+				return struct{}{}, nil
+			}
+			q.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				metrics.Rejected.Inc()
+				return struct{}{}, fmt.Errorf("%w: %w", ErrQueueFull, ctx.Err())
+			case <-freed:
+			}
+		}
 	})
+	return err
 }
 
 func (q *Queue) Pop() (string, error) {
-	q.mu.Lock()
-	defer q.mu.Unlock()
-	return measure(string(command.Pop), func() (string, error) {
-		front := q.list.Front()
-		if front == nil {
-			return "", ErrEmptyQueue
+	msg, err := q.PopWith(PopOptions{})
+	if err != nil {
+		return "", err
+	}
+	return msg.Body, nil
+}
+
+// Removes the next message that hasn't expired, along with the expired
+// messages in front of it. Called with the lock held.
+func (q *Queue) next() (Message, []Message, error) {
+	expired := []Message{}
+	now := time.Now()
+	for {
+		msg, err := q.take()
+		if err != nil {
+			return Message{}, expired, err
 		}
-		item, ok := q.list.Remove(front).(string)
-		if !ok {
-			return "", ErrUnknown
+		if msg.expired(now) {
+			q.record(Op{Type: OpRemove, Seq: msg.Seq})
+			expired = append(expired, msg)
+			continue
 		}
-		q.pending.Add(-1)
-		return item, nil
-	})
+		return msg, expired, nil
+	}
+}
+
+// Takes the next message to deliver, taking turns between the ungrouped
+// messages and each group that isn't waiting on an ack. Called with the lock
+// held.
+func (q *Queue) take() (Message, error) {
+	for _, lane := range q.groups.order() {
+		var msg Message
+		var ok bool
+		if lane == ungrouped {
+			var err error
+			if msg, ok, err = q.buf.popFront(); err != nil {
+				return Message{}, fmt.Errorf("%w: %w", ErrUnknown, err)
+			}
+		} else {
+			msg, ok = q.groups.popFront(lane)
+		}
+		if ok {
+			q.groups.served(lane)
+			q.notify()
+			q.free()
+			return msg, nil
+		}
+	}
+	return Message{}, ErrEmptyQueue
+}
+
+// Removes the oldest message from the queue, called with the lock held
+func (q *Queue) remove() (Message, error) {
+	msg, ok, err := q.buf.popFront()
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %w", ErrUnknown, err)
+	}
+	if !ok {
+		if msg, ok = q.groups.popOldest(); !ok {
+			return Message{}, ErrEmptyQueue
+		}
+	}
+	q.record(Op{Type: OpRemove, Seq: msg.Seq})
+	q.notify()
+	q.free()
+	return msg, nil
+}
+
+// Removes the segments the queue spilled to disk and their directory, the
+// messages in them are lost
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buf.reset()
+	// Delayed nacks find nothing to deliver again
+	clear(q.inflight)
 }
 
 func (q *Queue) Drain() {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	measure(string(command.Drain), func() (struct{}, error) {
-		q.list.Init()
+		q.buf.reset()
+		q.groups.reset()
+		clear(q.inflight)
+		q.record(Op{Type: OpDrain, Seq: q.seq})
+		q.notify()
+		q.free()
 		return struct{}{}, nil
 	})
 }
 
 func (q *Queue) Consume(ctx context.Context) (<-chan string, error) {
+	msgs, err := q.ConsumeWith(ctx, PopOptions{})
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan string, 100)
+	go func() {
+		defer close(out)
+		for msg := range msgs {
+			out <- msg.Body
+		}
+	}()
+	return out, nil
+}
+
+// Delivers messages to the channel as they are pushed until the context is
+// done
+func (q *Queue) ConsumeWith(ctx context.Context, opts PopOptions) (<-chan Message, error) {
 	id, _, err := q.listen()
 	if err != nil {
 		return nil, err
 	}
 	defer q.ignore(id)
-	out := make(chan string, 100)
+	out := make(chan Message, 100)
 
 	go func() {
 		metrics.Consumers.Inc()
@@ -99,14 +389,16 @@ func (q *Queue) Consume(ctx context.Context) (<-chan string, error) {
 		tick := time.NewTicker(time.Second)
 		defer tick.Stop()
 
+		defer close(out)
+
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-tick.C:
-				q.tryPop(ctx, out)
+				q.tryPop(ctx, opts, out)
 			case <-q.recv():
-				q.tryPop(ctx, out)
+				q.tryPop(ctx, opts, out)
 			}
 		}
 	}()
@@ -114,15 +406,22 @@ func (q *Queue) Consume(ctx context.Context) (<-chan string, error) {
 	return out, nil
 }
 
-func (q *Queue) tryPop(ctx context.Context, out chan<- string) {
-	item, err := q.Pop()
+func (q *Queue) tryPop(ctx context.Context, opts PopOptions, out chan<- Message) {
+	msg, err := q.PopWith(opts)
 	if err != nil {
 		if !errors.Is(err, ErrEmptyQueue) {
 			logger.Logger(ctx).Errorw("failed to pop from queue", "error", err)
 		}
 		return
 	}
-	out <- item
+	select {
+	case out <- msg:
+	case <-ctx.Done():
+		// The consumer has gone, so the message goes back to the queue
+		if opts.Ack {
+			q.Nack(msg.Seq)
+		}
+	}
 }
 
 // Returns a channel that notifies when an item is pushed to the queue
@@ -149,15 +448,40 @@ func (q *Queue) ignore(id uuid.UUID) {
 }
 
 func (q *Queue) Snapshot() []string {
-	out, _ := measure("snapshot", func() ([]string, error) {
-		out := []string{}
+	out := []string{}
+	for _, msg := range q.State().Messages {
+		out = append(out, msg.Body)
+	}
+	return out
+}
+
+// Returns the messages in the queue along with their sequence numbers, in the
+// order they were pushed. Messages that haven't been acked are included so
+// they are delivered again after a restore.
+func (q *Queue) State() State {
+	out, _ := measure("snapshot", func() (State, error) {
 		q.mu.Lock()
 		defer q.mu.Unlock()
-		for e := q.list.Front(); e != nil; e = e.Next() {
-			o, ok := e.Value.(string)
-			if ok {
-				out = append(out, o)
-			}
+		out := State{
+			Seq:      q.seq,
+			Messages: make([]Message, 0, q.buf.len()+q.groups.length+len(q.inflight)),
+			Dedup:    q.dedup.state(),
+		}
+		add := func(msg Message) {
+			out.Messages = append(out.Messages, msg)
+		}
+		err := q.buf.each(add)
+		if err != nil {
+			logger.Logger(context.Background()).Errorw("failed to read spilled messages", "error", err)
+		}
+		q.groups.each(add)
+		for _, d := range q.inflight {
+			add(d.msg)
+		}
+		if q.groups.length > 0 || len(q.inflight) > 0 {
+			sort.Slice(out.Messages, func(i, j int) bool {
+				return out.Messages[i].Seq < out.Messages[j].Seq
+			})
 		}
 		return out, nil
 	})
@@ -170,10 +494,65 @@ func (q *Queue) Load(data []string) {
 	defer q.mu.Unlock()
 	for _, d := range data {
 		if d != "" {
-			q.list.PushBack(d)
+			q.push(d)
 		}
 	}
-	q.pending.Swap(int64(q.list.Len()))
+	q.notify()
+}
+
+// Empties the queue and restores the messages from the state, keeping their
+// sequence numbers
+func (q *Queue) Restore(state State) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buf.reset()
+	q.groups.reset()
+	clear(q.inflight)
+	for _, msg := range state.Messages {
+		q.add(msg)
+		q.seq = max(q.seq, msg.Seq+1)
+	}
+	q.seq = max(q.seq, state.Seq)
+	q.dedup.restore(state.Dedup, time.Now())
+	q.notify()
+	q.free()
+}
+
+func (q *Queue) push(body string) {
+	q.pushMessage(Message{Body: body})
+}
+
+// Pushes the message with the next sequence number, called with the lock held
+func (q *Queue) pushMessage(msg Message) {
+	msg.Seq = q.seq
+	q.add(msg)
+	q.record(Op{Type: OpPush, Seq: msg.Seq, Body: msg.Body, Expires: msg.Expires, Group: msg.Group, Headers: msg.Headers})
+	q.track(msg, StatusQueued, "")
+	q.seq++
+}
+
+// Adds the message to the back of its group, called with the lock held
+func (q *Queue) add(msg Message) {
+	if msg.Group == ungrouped {
+		q.buf.pushBack(msg)
+	} else {
+		q.groups.pushBack(msg)
+	}
+}
+
+// Sets the journal that every operation on the queue is recorded to
+func (q *Queue) SetJournal(j Journal) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.journal = j
+}
+
+func (q *Queue) record(op Op) {
+	if q.journal == nil {
+		return
+	}
+	op.Time = time.Now()
+	q.journal.Record(op)
 }
 
 // Blocking loop that reports queue size every 500ms
@@ -187,12 +566,28 @@ func (q *Queue) Report(ctx context.Context) {
 		case <-tick.C:
 			metrics.Size.Set(float64(q.Len()))
 			metrics.Pending.Set(float64(q.pending.Load()))
+			mem, disk := q.Bytes()
+			metrics.Bytes.With(prometheus.Labels{"location": "memory"}).Set(float64(mem))
+			metrics.Bytes.With(prometheus.Labels{"location": "disk"}).Set(float64(disk))
 		}
 	}
 }
 
+// Returns the number of bytes of messages held in memory and on disk
+func (q *Queue) Bytes() (int64, int64) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	var inflight int64
+	for _, d := range q.inflight {
+		inflight += d.msg.size()
+	}
+	return q.buf.memBytes + q.groups.bytes + inflight, q.buf.diskBytes
+}
+
+// Updates the number of messages that can be delivered to consumers, called
+// with the lock held after the queue changes
 func (q *Queue) notify() {
-	q.pending.Add(1)
+	q.pending.Store(int64(q.buf.len() + q.groups.length - q.groups.waiting))
 }
 
 func (q *Queue) recv() <-chan struct{} {
@@ -1,9 +1,16 @@
 package queue
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/orderly-queue/orderly/internal/metrics"
 	"github.com/orderly-queue/orderly/internal/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 )
 
@@ -56,6 +63,97 @@ func TestItSnapshotsEmptyList(t *testing.T) {
 	require.Len(t, snap, 0)
 }
 
+func TestItRestoresState(t *testing.T) {
+	queue := New()
+	queue.Push("bongo")
+	queue.Push("bingo")
+	_, err := queue.Pop()
+	require.Nil(t, err)
+
+	state := queue.State()
+	require.Equal(t, uint64(2), state.Seq)
+	require.Equal(t, []Message{{Seq: 1, Body: "bingo"}}, state.Messages)
+
+	restored := New()
+	restored.Restore(state)
+	require.Equal(t, uint(1), restored.Len())
+	restored.Push("bango")
+	require.Equal(t, []Message{{Seq: 1, Body: "bingo"}, {Seq: 2, Body: "bango"}}, restored.State().Messages)
+}
+
+func TestItSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	queue := New(WithMemoryBudget(50, dir))
+
+	items := []string{}
+	for i := range 100 {
+		item := fmt.Sprintf("item-%03d", i)
+		items = append(items, item)
+		queue.Push(item)
+	}
+
+	require.Equal(t, uint(100), queue.Len())
+	mem, disk := queue.Bytes()
+	require.LessOrEqual(t, mem, int64(50))
+	require.Greater(t, disk, int64(0))
+	require.Equal(t, items, queue.Snapshot())
+
+	// Pop half, then push some more so the tail builds up again
+	for i := range 50 {
+		item, err := queue.Pop()
+		require.Nil(t, err)
+		require.Equal(t, items[i], item)
+	}
+	for i := 100; i < 120; i++ {
+		item := fmt.Sprintf("item-%03d", i)
+		items = append(items, item)
+		queue.Push(item)
+	}
+	require.Equal(t, items[50:], queue.Snapshot())
+
+	for i := 50; i < 120; i++ {
+		item, err := queue.Pop()
+		require.Nil(t, err)
+		require.Equal(t, items[i], item)
+	}
+	require.Equal(t, uint(0), queue.Len())
+	mem, disk = queue.Bytes()
+	require.Equal(t, int64(0), mem)
+	require.Equal(t, int64(0), disk)
+}
+
+func TestItRemovesSpilledSegmentsWhenDrained(t *testing.T) {
+	dir := t.TempDir()
+	queue := New(WithMemoryBudget(10, dir))
+	for i := range 20 {
+		queue.Push(fmt.Sprintf("item-%03d", i))
+	}
+	_, disk := queue.Bytes()
+	require.Greater(t, disk, int64(0))
+
+	queue.Drain()
+	require.Equal(t, uint(0), queue.Len())
+	_, disk = queue.Bytes()
+	require.Equal(t, int64(0), disk)
+	require.Len(t, queue.Snapshot(), 0)
+}
+
+func TestItRemovesTheSpillDirectoryWhenClosed(t *testing.T) {
+	dir := t.TempDir()
+	reg := NewRegistry(WithMemoryBudget(10, dir))
+	for i := range 20 {
+		reg.Default().Push(fmt.Sprintf("item-%03d", i))
+	}
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+
+	reg.Close()
+	entries, err = os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Empty(t, entries)
+}
+
 func BenchmarkQueuePush(b *testing.B) {
 	queue := New()
 
@@ -78,3 +176,552 @@ func BenchmarkQueuePush(b *testing.B) {
 		}
 	})
 }
+
+func TestItRejectsPushesWhenFull(t *testing.T) {
+	queue := New(WithLimits(Limits{MaxLength: 2, Overflow: OverflowReject}))
+	require.Nil(t, queue.Push("apple"))
+	require.Nil(t, queue.Push("banana"))
+	require.ErrorIs(t, queue.Push("cherry"), ErrQueueFull)
+	require.Equal(t, []string{"apple", "banana"}, queue.Snapshot())
+
+	bytes := New(WithLimits(Limits{MaxBytes: 10, Overflow: OverflowReject}))
+	require.Nil(t, bytes.Push("apple"))
+	require.ErrorIs(t, bytes.Push("banana"), ErrQueueFull)
+	require.ErrorIs(t, bytes.Push("elevenbytes"), ErrQueueFull)
+	require.Nil(t, bytes.Push("pear"))
+}
+
+func TestItDropsTheOldestWhenFull(t *testing.T) {
+	queue := New(WithLimits(Limits{MaxLength: 2, Overflow: OverflowDropOldest}))
+	require.Nil(t, queue.Push("apple"))
+	require.Nil(t, queue.Push("banana"))
+	require.Nil(t, queue.Push("cherry"))
+	require.Equal(t, []string{"banana", "cherry"}, queue.Snapshot())
+
+	bytes := New(WithLimits(Limits{MaxBytes: 10, Overflow: OverflowDropOldest}))
+	require.Nil(t, bytes.Push("apple"))
+	require.Nil(t, bytes.Push("pear"))
+	require.Nil(t, bytes.Push("banana"))
+	require.Equal(t, []string{"pear", "banana"}, bytes.Snapshot())
+}
+
+func TestItRejectsPushesWhenOnlyDeliveredMessagesAreLeftToDrop(t *testing.T) {
+	queue := New(WithLimits(Limits{MaxLength: 2, Overflow: OverflowDropOldest}))
+	require.Nil(t, queue.Push("apple"))
+	require.Nil(t, queue.Push("banana"))
+	for range 2 {
+		_, err := queue.PopWith(PopOptions{Ack: true})
+		require.Nil(t, err)
+	}
+
+	err := queue.Push("cherry")
+	require.ErrorIs(t, err, ErrQueueFull)
+	require.NotErrorIs(t, err, ErrEmptyQueue)
+	require.Equal(t, []string{"apple", "banana"}, queue.Snapshot())
+}
+
+func TestItBlocksPushesWhenFull(t *testing.T) {
+	queue := New(WithLimits(Limits{MaxLength: 1, Overflow: OverflowBlock}))
+	require.Nil(t, queue.Push("apple"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	require.ErrorIs(t, queue.PushContext(ctx, "banana"), ErrQueueFull)
+
+	pushed := make(chan error, 1)
+	go func() {
+		pushed <- queue.PushContext(context.Background(), "banana")
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("push did not block")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	item, err := queue.Pop()
+	require.Nil(t, err)
+	require.Equal(t, "apple", item)
+
+	select {
+	case err := <-pushed:
+		require.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("push was not unblocked")
+	}
+	require.Equal(t, []string{"banana"}, queue.Snapshot())
+}
+
+func TestItStopsBlockingAfterTheBlockTimeout(t *testing.T) {
+	queue := New(WithLimits(Limits{MaxLength: 1, Overflow: OverflowBlock, BlockTimeout: time.Millisecond * 50}))
+	require.Nil(t, queue.Push("apple"))
+	require.ErrorIs(t, queue.Push("banana"), ErrQueueFull)
+}
+
+func TestItSkipsExpiredMessages(t *testing.T) {
+	queue := New(WithTTL(time.Hour))
+	require.Nil(t, queue.PushWith(context.Background(), "apple", PushOptions{TTL: time.Millisecond * 10}))
+	require.Nil(t, queue.Push("banana"))
+	time.Sleep(time.Millisecond * 20)
+
+	item, err := queue.Pop()
+	require.Nil(t, err)
+	require.Equal(t, "banana", item)
+	_, err = queue.Pop()
+	require.ErrorIs(t, err, ErrEmptyQueue)
+}
+
+func TestItSweepsExpiredMessages(t *testing.T) {
+	queue := New(WithMemoryBudget(20, t.TempDir()))
+	items := []string{}
+	for i := range 20 {
+		item := fmt.Sprintf("item-%03d", i)
+		ttl := time.Hour
+		if i%2 == 0 {
+			ttl = time.Millisecond * 10
+		} else {
+			items = append(items, item)
+		}
+		require.Nil(t, queue.PushWith(context.Background(), item, PushOptions{TTL: ttl}))
+	}
+	_, disk := queue.Bytes()
+	require.Greater(t, disk, int64(0))
+	time.Sleep(time.Millisecond * 20)
+
+	require.Equal(t, 10, queue.Sweep())
+	require.Equal(t, uint(10), queue.Len())
+	require.Equal(t, items, queue.Snapshot())
+}
+
+func TestItMovesExpiredMessagesToTheDeadLetterQueue(t *testing.T) {
+	reg := NewRegistry(WithTTL(time.Millisecond*10), WithDeadLetter("dead"))
+	reg.Configure("dead", WithTTL(0), WithDeadLetter(""))
+
+	require.Nil(t, reg.Default().Push("apple"))
+	time.Sleep(time.Millisecond * 20)
+	require.Equal(t, 1, reg.Default().Sweep())
+
+	dead, err := reg.Get("dead")
+	require.Nil(t, err)
+	require.Equal(t, []string{"apple"}, dead.Snapshot())
+	require.Equal(t, 0, dead.Sweep())
+}
+
+func TestItWaitsForSpaceInABlockingDeadLetterQueue(t *testing.T) {
+	reg := NewRegistry(WithTTL(time.Millisecond*10), WithDeadLetter("dead"))
+	reg.Configure("dead", WithTTL(0), WithDeadLetter(""), WithLimits(Limits{MaxLength: 1, Overflow: OverflowBlock}))
+	dead, err := reg.Get("dead")
+	require.Nil(t, err)
+	require.Nil(t, dead.Push("banana"))
+
+	require.Nil(t, reg.Default().Push("apple"))
+	time.Sleep(time.Millisecond * 20)
+	swept := make(chan int, 1)
+	go func() {
+		swept <- reg.Default().Sweep()
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+	_, err = dead.Pop()
+	require.Nil(t, err)
+	require.Equal(t, 1, <-swept)
+	require.Equal(t, []string{"apple"}, dead.Snapshot())
+}
+
+func TestItCountsTheDeadLettersItCannotMove(t *testing.T) {
+	reg := NewRegistry(WithTTL(time.Millisecond*10), WithDeadLetter("dead"))
+	reg.Configure("dead", WithTTL(0), WithDeadLetter(""), WithLimits(Limits{MaxLength: 1, Overflow: OverflowReject}))
+	dead, err := reg.Get("dead")
+	require.Nil(t, err)
+	require.Nil(t, dead.Push("banana"))
+
+	before := testutil.ToFloat64(metrics.DeadLettersDropped)
+	require.Nil(t, reg.Default().Push("apple"))
+	time.Sleep(time.Millisecond * 20)
+	require.Equal(t, 1, reg.Default().Sweep())
+
+	require.Equal(t, before+1, testutil.ToFloat64(metrics.DeadLettersDropped))
+	require.Equal(t, []string{"banana"}, dead.Snapshot())
+}
+
+func TestItKeepsTheHeadersAndGroupOfDeadLetters(t *testing.T) {
+	reg := NewRegistry(WithTTL(time.Millisecond*10), WithDeadLetter("dead"))
+	reg.Configure("dead", WithTTL(0), WithDeadLetter(""))
+
+	headers := map[string]string{"traceparent": "00-abc", "codec": "json"}
+	require.Nil(t, reg.Default().PushWith(context.Background(), "apple", PushOptions{Group: "a", Headers: headers, Job: "job"}))
+	time.Sleep(time.Millisecond * 20)
+	require.Equal(t, 1, reg.Default().Sweep())
+
+	job, err := reg.Job("job")
+	require.Nil(t, err)
+	require.Equal(t, StatusFailed, job.Status)
+
+	dead, err := reg.Get("dead")
+	require.Nil(t, err)
+	msg, err := dead.PopWith(PopOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "a", msg.Group)
+	require.Equal(t, "00-abc", msg.Headers["traceparent"])
+	require.Equal(t, "json", msg.Headers["codec"])
+	require.Equal(t, "job", msg.Headers[HeaderJob])
+}
+
+func TestItLimitsTheQueuesCreatedOnFirstUse(t *testing.T) {
+	reg := NewRegistry()
+	reg.Configure("configured")
+	reg.SetMaxQueues(1)
+
+	_, err := reg.Get("first")
+	require.Nil(t, err)
+	_, err = reg.Get("second")
+	require.ErrorIs(t, err, ErrTooManyQueues)
+
+	// Existing, configured and the default queue are still returned
+	_, err = reg.Get("first")
+	require.Nil(t, err)
+	_, err = reg.Get("configured")
+	require.Nil(t, err)
+	_, err = reg.Get("")
+	require.Nil(t, err)
+
+	// Queues in a snapshot are restored over the max
+	reg.Restore(State{Queues: map[string]State{"first": {}, "restored": {Messages: []Message{{Body: "apple"}}}}})
+	require.Contains(t, reg.Names(), "restored")
+}
+
+func TestItSnapshotsNamedQueues(t *testing.T) {
+	reg := NewRegistry()
+	require.Nil(t, reg.Default().Push("apple"))
+	other, err := reg.Get("other")
+	require.Nil(t, err)
+	require.Nil(t, other.Push("banana"))
+
+	_, err = reg.Get("no::good")
+	require.ErrorIs(t, err, ErrInvalidName)
+
+	state := reg.State()
+	require.Equal(t, []Message{{Seq: 0, Body: "apple"}}, state.Messages)
+	require.Equal(t, []Message{{Seq: 0, Body: "banana"}}, state.Queues["other"].Messages)
+
+	restored := NewRegistry()
+	stale, err := restored.Get("stale")
+	require.Nil(t, err)
+	require.Nil(t, stale.Push("cherry"))
+	restored.Restore(state)
+	require.Equal(t, []string{"apple"}, restored.Default().Snapshot())
+	other, err = restored.Get("other")
+	require.Nil(t, err)
+	require.Equal(t, []string{"banana"}, other.Snapshot())
+	require.Equal(t, uint(0), stale.Len())
+}
+
+func TestItDeduplicatesPushes(t *testing.T) {
+	ctx := context.Background()
+	queue := New(WithDedup(time.Millisecond*50, 2))
+	require.Nil(t, queue.PushWith(ctx, "apple", PushOptions{Key: "a"}))
+	require.Nil(t, queue.PushWith(ctx, "apple", PushOptions{Key: "a"}))
+	require.Nil(t, queue.Push("apple"))
+	require.Equal(t, []string{"apple", "apple"}, queue.Snapshot())
+
+	// The oldest key is forgotten once there are too many
+	require.Nil(t, queue.PushWith(ctx, "banana", PushOptions{Key: "b"}))
+	require.Nil(t, queue.PushWith(ctx, "cherry", PushOptions{Key: "c"}))
+	require.Nil(t, queue.PushWith(ctx, "apple", PushOptions{Key: "a"}))
+	require.Equal(t, uint(5), queue.Len())
+
+	// And every key is forgotten after the window
+	time.Sleep(time.Millisecond * 60)
+	require.Nil(t, queue.PushWith(ctx, "cherry", PushOptions{Key: "c"}))
+	require.Equal(t, uint(6), queue.Len())
+}
+
+func TestItRestoresDedupKeys(t *testing.T) {
+	ctx := context.Background()
+	queue := New(WithDedup(time.Minute, 10))
+	require.Nil(t, queue.PushWith(ctx, "apple", PushOptions{Key: "a"}))
+
+	state := queue.State()
+	require.Len(t, state.Dedup, 1)
+	require.Equal(t, "a", state.Dedup[0].Key)
+
+	restored := New(WithDedup(time.Minute, 10))
+	restored.Restore(state)
+	require.Nil(t, restored.PushWith(ctx, "apple", PushOptions{Key: "a"}))
+	require.Equal(t, uint(1), restored.Len())
+}
+
+func TestItDeliversGroupsInOrder(t *testing.T) {
+	ctx := context.Background()
+	queue := New()
+	for _, item := range []struct{ body, group string }{
+		{"a1", "a"}, {"a2", "a"}, {"a3", "a"}, {"b1", "b"}, {"x1", ""}, {"b2", "b"},
+	} {
+		require.Nil(t, queue.PushWith(ctx, item.body, PushOptions{Group: item.group}))
+	}
+
+	// Each group is waiting on an ack after its first message, so the others
+	// take their turns
+	delivered := []Message{}
+	for range 3 {
+		msg, err := queue.PopWith(PopOptions{Ack: true})
+		require.Nil(t, err)
+		delivered = append(delivered, msg)
+	}
+	require.ElementsMatch(t, []string{"a1", "b1", "x1"}, []string{delivered[0].Body, delivered[1].Body, delivered[2].Body})
+	_, err := queue.PopWith(PopOptions{Ack: true})
+	require.ErrorIs(t, err, ErrEmptyQueue)
+	require.Equal(t, uint(3), queue.Len())
+
+	for _, msg := range delivered {
+		if msg.Body == "a1" {
+			require.Nil(t, queue.Ack(msg.Seq))
+		}
+	}
+	msg, err := queue.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Equal(t, "a2", msg.Body)
+
+	// A nacked message is delivered again before the rest of its group
+	require.Nil(t, queue.Nack(msg.Seq))
+	msg, err = queue.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Equal(t, "a2", msg.Body)
+	require.ErrorIs(t, queue.Ack(1000), ErrNotInFlight)
+
+	// Messages waiting for an ack are kept in the state
+	require.Equal(t, []string{"a2", "a3", "b1", "x1", "b2"}, queue.Snapshot())
+}
+
+func TestItTakesTurnsBetweenGroups(t *testing.T) {
+	ctx := context.Background()
+	queue := New()
+	for i := range 3 {
+		require.Nil(t, queue.PushWith(ctx, fmt.Sprintf("a%d", i), PushOptions{Group: "a"}))
+	}
+	require.Nil(t, queue.PushWith(ctx, "b0", PushOptions{Group: "b"}))
+	require.Nil(t, queue.PushWith(ctx, "c0", PushOptions{Group: "c"}))
+
+	items := []string{}
+	for range 5 {
+		item, err := queue.Pop()
+		require.Nil(t, err)
+		items = append(items, item)
+	}
+	require.Equal(t, []string{"a0", "b0", "c0", "a1", "a2"}, items)
+}
+
+func TestItRedeliversMessagesThatArentAcked(t *testing.T) {
+	queue := New(WithAckTimeout(time.Millisecond * 10))
+	require.Nil(t, queue.PushWith(context.Background(), "apple", PushOptions{Group: "a"}))
+	msg, err := queue.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+
+	time.Sleep(time.Millisecond * 20)
+	queue.Sweep()
+	again, err := queue.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Equal(t, msg, again)
+	require.Nil(t, queue.Ack(again.Seq))
+	require.Equal(t, uint(0), queue.Len())
+	require.Empty(t, queue.Snapshot())
+}
+
+func TestItHoldsADelayedNackUntilTheDelayHasPassed(t *testing.T) {
+	queue := New()
+	require.Nil(t, queue.PushWith(context.Background(), "apple", PushOptions{Group: "a"}))
+	require.Nil(t, queue.PushWith(context.Background(), "banana", PushOptions{Group: "a"}))
+	msg, err := queue.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+
+	// The group stays locked while the message is held
+	require.Nil(t, queue.NackWith(msg.Seq, NackOptions{Delay: time.Millisecond * 50}))
+	_, err = queue.PopWith(PopOptions{Ack: true})
+	require.ErrorIs(t, err, ErrEmptyQueue)
+
+	require.Eventually(t, func() bool {
+		again, err := queue.PopWith(PopOptions{Ack: true})
+		return err == nil && again.Body == "apple"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestItFansOutToSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	reg := NewRegistry()
+
+	count, err := reg.Publish(ctx, "orders", "lost", PushOptions{})
+	require.Nil(t, err)
+	require.Equal(t, 0, count)
+
+	billing, err := reg.Subscribe("orders", "billing")
+	require.Nil(t, err)
+	require.Equal(t, "orders.billing", billing)
+	shipping, err := reg.Subscribe("orders", "shipping")
+	require.Nil(t, err)
+	_, err = reg.Subscribe("orders", "no.dots")
+	require.ErrorIs(t, err, ErrInvalidTopic)
+
+	count, err = reg.Publish(ctx, "orders", "apple", PushOptions{})
+	require.Nil(t, err)
+	require.Equal(t, 2, count)
+
+	// Each subscription has its own cursor
+	b, err := reg.Get(billing)
+	require.Nil(t, err)
+	item, err := b.Pop()
+	require.Nil(t, err)
+	require.Equal(t, "apple", item)
+	s, err := reg.Get(shipping)
+	require.Nil(t, err)
+	require.Equal(t, []string{"apple"}, s.Snapshot())
+
+	state := reg.State()
+	require.Equal(t, map[string][]string{"orders": {"billing", "shipping"}}, state.Topics)
+
+	require.Nil(t, reg.Unsubscribe("orders", "shipping"))
+	require.ErrorIs(t, reg.Unsubscribe("orders", "shipping"), ErrSubscriptionMissing)
+	require.NotContains(t, reg.Names(), shipping)
+
+	restored := NewRegistry()
+	restored.Restore(state)
+	require.Equal(t, []string{"billing", "shipping"}, restored.Subscriptions("orders"))
+}
+
+func TestItMatchesBindings(t *testing.T) {
+	tcs := []struct {
+		name    string
+		binding Binding
+		key     string
+		headers map[string]string
+		matches bool
+	}{
+		{name: "exact", binding: Binding{Match: MatchExact, Key: "orders.eu"}, key: "orders.eu", matches: true},
+		{name: "exact mismatch", binding: Binding{Match: MatchExact, Key: "orders.eu"}, key: "orders.us"},
+		{name: "prefix", binding: Binding{Match: MatchPrefix, Key: "orders."}, key: "orders.eu", matches: true},
+		{name: "star matches one word", binding: Binding{Match: MatchWildcard, Key: "orders.*.created"}, key: "orders.eu.created", matches: true},
+		{name: "star doesn't match two words", binding: Binding{Match: MatchWildcard, Key: "orders.*.created"}, key: "orders.eu.west.created"},
+		{name: "hash matches no words", binding: Binding{Match: MatchWildcard, Key: "orders.#"}, key: "orders", matches: true},
+		{name: "hash matches many words", binding: Binding{Match: MatchWildcard, Key: "#.created"}, key: "orders.eu.created", matches: true},
+		{name: "headers", binding: Binding{Match: MatchHeaders, Headers: map[string]string{"region": "eu"}}, headers: map[string]string{"region": "eu", "tier": "gold"}, matches: true},
+		{name: "headers mismatch", binding: Binding{Match: MatchHeaders, Headers: map[string]string{"region": "eu"}}, headers: map[string]string{"region": "us"}},
+	}
+
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.matches, c.binding.matches(c.key, c.headers))
+		})
+	}
+}
+
+func TestItRoutesThroughBindings(t *testing.T) {
+	ctx := context.Background()
+	reg := NewRegistry()
+	reg.SetAlternate("unroutable")
+
+	require.ErrorIs(t, reg.Bind(Binding{Name: "eu", Match: MatchExact}), ErrInvalidBinding)
+	require.Nil(t, reg.Bind(Binding{Name: "eu", Match: MatchWildcard, Key: "orders.eu.*", Queues: []string{"eu", "audit"}}))
+	require.Nil(t, reg.Bind(Binding{Name: "gold", Match: MatchHeaders, Headers: map[string]string{"tier": "gold"}, Queues: []string{"gold", "audit"}}))
+
+	count, err := reg.Publish(ctx, "orders.eu.created", "apple", PushOptions{Headers: map[string]string{"tier": "gold"}})
+	require.Nil(t, err)
+	require.Equal(t, 3, count)
+	for _, name := range []string{"eu", "gold", "audit"} {
+		q, err := reg.Get(name)
+		require.Nil(t, err)
+		msg, err := q.PopWith(PopOptions{})
+		require.Nil(t, err)
+		require.Equal(t, "apple", msg.Body)
+		require.Equal(t, map[string]string{"tier": "gold"}, msg.Headers)
+	}
+
+	count, err = reg.Publish(ctx, "orders.us.created", "pear", PushOptions{})
+	require.Nil(t, err)
+	require.Equal(t, 1, count)
+	q, err := reg.Get("unroutable")
+	require.Nil(t, err)
+	require.Equal(t, []string{"pear"}, q.Snapshot())
+
+	state := reg.State()
+	require.Len(t, state.Bindings, 2)
+	require.Nil(t, reg.Unbind("eu"))
+	require.ErrorIs(t, reg.Unbind("eu"), ErrBindingMissing)
+
+	restored := NewRegistry()
+	restored.Restore(state)
+	require.Equal(t, state.Bindings, restored.Bindings())
+}
+
+func TestItKeepsTemporaryQueuesOutOfTheState(t *testing.T) {
+	reg := NewRegistry()
+
+	name, err := reg.Temporary()
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(name, TemporaryPrefix))
+	q, err := reg.Get(name)
+	require.Nil(t, err)
+	require.Nil(t, q.Push("apple"))
+	require.Nil(t, reg.Default().Push("pear"))
+
+	state := reg.State()
+	require.Empty(t, state.Queues)
+	reg.Restore(state)
+	require.Equal(t, uint(1), q.Len())
+
+	reg.Delete(name)
+	_, err = reg.Get(name)
+	require.ErrorIs(t, err, ErrTemporaryMissing)
+}
+
+func TestItTracksJobs(t *testing.T) {
+	ctx := context.Background()
+	reg := NewRegistry()
+	q, err := reg.Get("work")
+	require.Nil(t, err)
+
+	require.Nil(t, q.PushWith(ctx, "apple", PushOptions{Job: "a"}))
+	require.Nil(t, q.PushWith(ctx, "pear", PushOptions{Job: "b"}))
+	job, err := reg.Job("a")
+	require.Nil(t, err)
+	require.Equal(t, Job{ID: "a", Queue: "work", Status: StatusQueued}, job)
+	_, err = reg.Job("c")
+	require.ErrorIs(t, err, ErrJobMissing)
+
+	msg, err := q.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Equal(t, "a", msg.Headers[HeaderJob])
+	job, err = reg.Job("a")
+	require.Nil(t, err)
+	require.Equal(t, StatusInFlight, job.Status)
+
+	require.Nil(t, q.Nack(msg.Seq))
+	job, err = reg.Job("a")
+	require.Nil(t, err)
+	require.Equal(t, StatusQueued, job.Status)
+
+	msg, err = q.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Nil(t, q.AckWith(msg.Seq, AckOptions{Result: "done"}))
+	job, err = reg.Job("a")
+	require.Nil(t, err)
+	require.Equal(t, StatusSucceeded, job.Status)
+	require.Equal(t, "done", job.Result)
+	require.True(t, job.Done())
+
+	msg, err = q.PopWith(PopOptions{Ack: true})
+	require.Nil(t, err)
+	require.Nil(t, q.AckWith(msg.Seq, AckOptions{Result: "boom", Failed: true}))
+	job, err = reg.Job("b")
+	require.Nil(t, err)
+	require.Equal(t, StatusFailed, job.Status)
+
+	restored := NewRegistry()
+	restored.Restore(reg.State())
+	job, err = restored.Job("a")
+	require.Nil(t, err)
+	require.Equal(t, "done", job.Result)
+
+	// Finished jobs are removed once they expire
+	reg.jobs.sweep(time.Now().Add(time.Hour * 25))
+	_, err = reg.Job("a")
+	require.ErrorIs(t, err, ErrJobMissing)
+}
@@ -0,0 +1,301 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The name of the queue commands use when they don't name one
+	DefaultQueue = "default"
+)
+
+var (
+	ErrInvalidName   = errors.New("queue names can only contain letters, numbers, dots, dashes and underscores")
+	ErrTooManyQueues = errors.New("too many queues")
+
+	validName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+)
+
+// Holds the named queues, creating them the first time they are used
+type Registry struct {
+	mu     *sync.RWMutex
+	queues map[string]*Queue
+
+	defaults []Option
+	named    map[string][]Option
+
+	// The subscriptions to each topic
+	topics map[string]map[string]struct{}
+	// The bindings that route published messages, by name
+	bindings  map[string]Binding
+	alternate string
+	schedules map[string]Schedule
+	// The queues that aren't recorded or snapshotted
+	temporary map[string]struct{}
+	jobs      *jobs
+
+	// The max number of queues created on first use, 0 is unlimited
+	max uint
+
+	journal Journal
+}
+
+// Creates a registry where every queue is created with the options
+func NewRegistry(opts ...Option) *Registry {
+	return &Registry{
+		mu:        &sync.RWMutex{},
+		queues:    map[string]*Queue{},
+		defaults:  opts,
+		named:     map[string][]Option{},
+		topics:    map[string]map[string]struct{}{},
+		bindings:  map[string]Binding{},
+		schedules: map[string]Schedule{},
+		temporary: map[string]struct{}{},
+		jobs:      newJobs(),
+	}
+}
+
+// Sets the options for the named queue, applied on top of the registry's
+// defaults. Only affects queues that haven't been created yet.
+func (r *Registry) Configure(name string, opts ...Option) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.named[name] = opts
+}
+
+func (r *Registry) Default() *Queue {
+	q, _ := r.Get(DefaultQueue)
+	return q
+}
+
+// Sets the max number of queues that are created on first use, the default
+// queue and the configured queues don't count towards it
+func (r *Registry) SetMaxQueues(max uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.max = max
+}
+
+// Returns the named queue, creating it if it doesn't exist. An empty name is
+// the default queue. ErrTooManyQueues is returned when creating it would go
+// over the max.
+func (r *Registry) Get(name string) (*Queue, error) {
+	return r.get(name, true)
+}
+
+func (r *Registry) get(name string, limited bool) (*Queue, error) {
+	if name == "" {
+		name = DefaultQueue
+	}
+	r.mu.RLock()
+	q, ok := r.queues[name]
+	r.mu.RUnlock()
+	if ok {
+		return q, nil
+	}
+
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	if strings.HasPrefix(name, TemporaryPrefix) {
+		return nil, fmt.Errorf("%w: %s", ErrTemporaryMissing, name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if q, ok := r.queues[name]; ok {
+		return q, nil
+	}
+	if limited && r.max > 0 && !r.configured(name) && r.created() >= r.max {
+		return nil, fmt.Errorf("%w: the max is %d", ErrTooManyQueues, r.max)
+	}
+	q = New(append(slices.Clone(r.defaults), r.named[name]...)...)
+	q.name = name
+	q.registry = r
+	if r.journal != nil {
+		q.journal = r.journalFor(name)
+	}
+	r.queues[name] = q
+	return q, nil
+}
+
+// Whether the queue is the default queue or has its own options, called with
+// the lock held
+func (r *Registry) configured(name string) bool {
+	_, ok := r.named[name]
+	return ok || name == DefaultQueue
+}
+
+// The number of queues that were created on first use, called with the lock
+// held
+func (r *Registry) created() uint {
+	var n uint
+	for name := range r.queues {
+		if !r.configured(name) && !r.isTemporary(name) {
+			n++
+		}
+	}
+	return n
+}
+
+// Removes the named queue and its messages from the registry
+func (r *Registry) Delete(name string) {
+	r.mu.Lock()
+	q, ok := r.queues[name]
+	delete(r.queues, name)
+	delete(r.temporary, name)
+	r.mu.Unlock()
+	if ok {
+		q.Drain()
+	}
+}
+
+// Closes every queue, removing the segments they spilled to disk
+func (r *Registry) Close() {
+	r.mu.RLock()
+	queues := slices.Collect(maps.Values(r.queues))
+	r.mu.RUnlock()
+	for _, q := range queues {
+		q.Close()
+	}
+}
+
+// Returns the names of the queues in the registry, sorted
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.queues))
+}
+
+// Sets the journal that every operation on every queue is recorded to
+func (r *Registry) SetJournal(j Journal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.journal = j
+	r.jobs.mu.Lock()
+	r.jobs.journal = j
+	r.jobs.mu.Unlock()
+	for name, q := range r.queues {
+		if !r.isTemporary(name) {
+			q.SetJournal(r.journalFor(name))
+		}
+	}
+}
+
+func (r *Registry) journalFor(name string) Journal {
+	if name == DefaultQueue {
+		return r.journal
+	}
+	return namedJournal{name: name, journal: r.journal}
+}
+
+// Stamps the name of the queue on each op
+type namedJournal struct {
+	name    string
+	journal Journal
+}
+
+func (j namedJournal) Record(op Op) {
+	op.Queue = j.name
+	j.journal.Record(op)
+}
+
+func (r *Registry) queuesByName() map[string]*Queue {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.queues)
+}
+
+// Returns the state of the default queue, with the state of the other queues
+// and the topics, bindings, jobs and schedules nested inside it
+func (r *Registry) State() State {
+	out := State{}
+	for name, q := range r.persistentQueues() {
+		if name == DefaultQueue {
+			queues := out.Queues
+			out = q.State()
+			out.Queues = queues
+			continue
+		}
+		if out.Queues == nil {
+			out.Queues = map[string]State{}
+		}
+		out.Queues[name] = q.State()
+	}
+	out.Topics = r.topicsState()
+	if bindings := r.Bindings(); len(bindings) > 0 {
+		out.Bindings = bindings
+	}
+	out.Jobs = r.jobsState()
+	if schedules := r.Schedules(); len(schedules) > 0 {
+		out.Schedules = schedules
+	}
+	return out
+}
+
+// Restores every queue from the state, emptying the queues that aren't in it
+func (r *Registry) Restore(state State) {
+	named := state.Queues
+	r.restoreTopics(state.Topics)
+	r.restoreBindings(state.Bindings)
+	r.restoreJobs(state.Jobs)
+	r.restoreSchedules(state.Schedules)
+	state.Queues = nil
+	state.Topics = nil
+	state.Bindings = nil
+	state.Jobs = nil
+	state.Schedules = nil
+	r.Default().Restore(state)
+	for name, q := range r.persistentQueues() {
+		if _, ok := named[name]; !ok && name != DefaultQueue {
+			q.Restore(State{})
+		}
+	}
+	// Queues in the snapshot are restored even when they are over the max
+	for name, st := range named {
+		q, err := r.get(name, false)
+		if err != nil {
+			continue
+		}
+		q.Restore(st)
+	}
+}
+
+// Blocking loop that removes expired messages from every queue and expired
+// jobs on the interval
+func (r *Registry) Sweep(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			for _, q := range r.queuesByName() {
+				q.Sweep()
+			}
+			r.jobs.sweep(time.Now())
+		}
+	}
+}
+
+// Returns the queues other than the temporary queues
+func (r *Registry) persistentQueues() map[string]*Queue {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]*Queue, len(r.queues))
+	for name, q := range r.queues {
+		if !r.isTemporary(name) {
+			out[name] = q
+		}
+	}
+	return out
+}
@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	// Records that a binding was added or replaced, the binding is stored in
+	// the op
+	OpBind OpType = "bind"
+	// Records that a binding was removed, its name is stored in the body
+	OpUnbind OpType = "unbind"
+
+	ErrInvalidBinding = errors.New("invalid binding")
+	ErrBindingMissing = errors.New("binding does not exist")
+)
+
+// How a binding matches published messages
+type Match string
+
+var (
+	// The routing key equals the binding's key
+	MatchExact Match = "exact"
+	// The routing key matches the binding's pattern of dot separated words,
+	// where * matches exactly one word and # matches zero or more
+	MatchWildcard Match = "wildcard"
+	// The routing key starts with the binding's key
+	MatchPrefix Match = "prefix"
+	// Every one of the binding's headers is set to the same value on the
+	// message
+	MatchHeaders Match = "headers"
+)
+
+// Routes published messages that match it to the queues
+type Binding struct {
+	Name    string            `json:"name"`
+	Match   Match             `json:"match"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Queues  []string          `json:"queues"`
+}
+
+func (b Binding) validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidBinding)
+	}
+	if len(b.Queues) == 0 {
+		return fmt.Errorf("%w: at least one queue is required", ErrInvalidBinding)
+	}
+	for _, q := range b.Queues {
+		if !validName.MatchString(q) {
+			return fmt.Errorf("%w: %w: %s", ErrInvalidBinding, ErrInvalidName, q)
+		}
+	}
+	switch b.Match {
+	case MatchExact, MatchWildcard, MatchPrefix:
+		if b.Key == "" {
+			return fmt.Errorf("%w: %s bindings require a key", ErrInvalidBinding, b.Match)
+		}
+	case MatchHeaders:
+		if len(b.Headers) == 0 {
+			return fmt.Errorf("%w: header bindings require headers", ErrInvalidBinding)
+		}
+	default:
+		return fmt.Errorf("%w: match must be one of exact, wildcard, prefix or headers", ErrInvalidBinding)
+	}
+	return nil
+}
+
+func (b Binding) matches(key string, headers map[string]string) bool {
+	switch b.Match {
+	case MatchExact:
+		return key == b.Key
+	case MatchWildcard:
+		return wildcard(strings.Split(b.Key, "."), strings.Split(key, "."))
+	case MatchPrefix:
+		return strings.HasPrefix(key, b.Key)
+	case MatchHeaders:
+		for k, v := range b.Headers {
+			if got, ok := headers[k]; !ok || got != v {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func wildcard(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if wildcard(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && wildcard(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && wildcard(pattern[1:], words[1:])
+	}
+}
+
+// Sends messages that no subscription or binding matched to the named queue
+func (r *Registry) SetAlternate(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alternate = name
+}
+
+// Adds the binding, replacing any binding with the same name
+func (r *Registry) Bind(b Binding) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bindings[b.Name] = b
+	r.record(Op{Type: OpBind, Binding: &b})
+	return nil
+}
+
+func (r *Registry) Unbind(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.bindings[name]; !ok {
+		return ErrBindingMissing
+	}
+	delete(r.bindings, name)
+	r.record(Op{Type: OpUnbind, Body: name})
+	return nil
+}
+
+// Returns the bindings sorted by name
+func (r *Registry) Bindings() []Binding {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Binding, 0, len(r.bindings))
+	for _, name := range slices.Sorted(maps.Keys(r.bindings)) {
+		out = append(out, r.bindings[name])
+	}
+	return out
+}
+
+// Returns the queues a message published with the key is routed to, sorted.
+// These are the subscriptions to the topic with the same name as the key and
+// the queues of every binding that matches, or the alternate queue when
+// nothing matches.
+func (r *Registry) Route(key string, headers map[string]string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	queues := map[string]struct{}{}
+	for subscription := range r.topics[key] {
+		queues[SubscriptionQueue(key, subscription)] = struct{}{}
+	}
+	for _, b := range r.bindings {
+		if b.matches(key, headers) {
+			for _, q := range b.Queues {
+				queues[q] = struct{}{}
+			}
+		}
+	}
+	if len(queues) == 0 && r.alternate != "" {
+		return []string{r.alternate}
+	}
+	return slices.Sorted(maps.Keys(queues))
+}
+
+// Pushes a copy of the message to every queue it is routed to, returning the
+// number of queues it was pushed to
+func (r *Registry) Publish(ctx context.Context, key, item string, opts PushOptions) (int, error) {
+	var errs error
+	count := 0
+	for _, name := range r.Route(key, opts.Headers) {
+		q, err := r.Get(name)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if err := q.PushWith(ctx, item, opts); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		count++
+	}
+	return count, errs
+}
+
+func (r *Registry) restoreBindings(bindings []Binding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bindings = make(map[string]Binding, len(bindings))
+	for _, b := range bindings {
+		r.bindings[b.Name] = b
+	}
+}
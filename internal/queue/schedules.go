@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+var (
+	// Records that a schedule was added, replaced or ran, the schedule is
+	// stored in the op
+	OpSchedule OpType = "schedule"
+	// Records that a schedule was removed, its name is stored in the body
+	OpUnschedule OpType = "unschedule"
+
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	ErrScheduleMissing = errors.New("schedule does not exist")
+)
+
+// What a schedule does about the runs it missed while the server was down
+type Missed string
+
+var (
+	// Missed runs are skipped, the schedule carries on from the next run
+	MissedSkip Missed = "skip"
+	// Every missed run pushes its message when the server starts
+	MissedCatchUp Missed = "catch_up"
+)
+
+// Pushes a templated message to a queue on a cron expression. The definition
+// lives in the registry so it is snapshotted along with the time it last ran,
+// the scheduler runs it.
+type Schedule struct {
+	Name string `json:"name"`
+	// A standard five field cron expression
+	Cron string `json:"cron"`
+	// The queue the message is pushed to, empty for the default queue
+	Queue string `json:"queue,omitempty"`
+	// A text/template rendered with the schedule's name and the time of the
+	// run as .Name and .Time
+	Body   string `json:"body"`
+	Missed Missed `json:"missed,omitempty"`
+	// When the schedule last ran in unix nanoseconds, 0 if it hasn't
+	LastRun int64 `json:"last_run,omitempty"`
+}
+
+func (s Schedule) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	if s.Cron == "" {
+		return fmt.Errorf("%w: cron is required", ErrInvalidSchedule)
+	}
+	if s.Queue != "" && !validName.MatchString(s.Queue) {
+		return fmt.Errorf("%w: %w: %s", ErrInvalidSchedule, ErrInvalidName, s.Queue)
+	}
+	switch s.Missed {
+	case "", MissedSkip, MissedCatchUp:
+	default:
+		return fmt.Errorf("%w: missed must be one of skip or catch_up", ErrInvalidSchedule)
+	}
+	return nil
+}
+
+// Adds the schedule, replacing any schedule with the same name. The time the
+// replaced schedule last ran is kept.
+func (r *Registry) SetSchedule(s Schedule) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.schedules[s.Name]; ok && s.LastRun == 0 {
+		s.LastRun = existing.LastRun
+	}
+	r.schedules[s.Name] = s
+	r.record(Op{Type: OpSchedule, Schedule: &s})
+	return nil
+}
+
+func (r *Registry) RemoveSchedule(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.schedules[name]; !ok {
+		return ErrScheduleMissing
+	}
+	delete(r.schedules, name)
+	r.record(Op{Type: OpUnschedule, Body: name})
+	return nil
+}
+
+func (r *Registry) Schedule(name string) (Schedule, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schedules[name]
+	if !ok {
+		return Schedule{}, ErrScheduleMissing
+	}
+	return s, nil
+}
+
+// Returns the schedules sorted by name
+func (r *Registry) Schedules() []Schedule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Schedule, 0, len(r.schedules))
+	for _, name := range slices.Sorted(maps.Keys(r.schedules)) {
+		out = append(out, r.schedules[name])
+	}
+	return out
+}
+
+// Records that the schedule ran at the time
+func (r *Registry) Ran(name string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.schedules[name]
+	if !ok {
+		return
+	}
+	s.LastRun = at.UnixNano()
+	r.schedules[name] = s
+	r.record(Op{Type: OpSchedule, Schedule: &s})
+}
+
+func (r *Registry) restoreSchedules(schedules []Schedule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedules = make(map[string]Schedule, len(schedules))
+	for _, s := range schedules {
+		r.schedules[s.Name] = s
+	}
+}
@@ -0,0 +1,339 @@
+package queue
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/orderly-queue/orderly/internal/uuid"
+)
+
+// A segment of messages from the middle of the queue that has been spilled
+// to disk
+type segment struct {
+	path  string
+	count int
+	bytes int64
+	size  int64
+}
+
+// Holds the messages in the queue. When the messages in memory exceed the
+// budget, the middle of the queue is spilled to segment files on disk whilst
+// the head and tail are kept in memory.
+type buffer struct {
+	head     *list.List
+	segments []segment
+	tail     *list.List
+
+	// The max number of bytes kept in memory, 0 disables spilling
+	budget int64
+	dir    string
+	next   int
+
+	length    int
+	memBytes  int64
+	diskBytes int64
+}
+
+func newBuffer(budget int64, dir string) *buffer {
+	return &buffer{
+		head:     list.New(),
+		segments: []segment{},
+		tail:     list.New(),
+		budget:   budget,
+		dir:      filepath.Join(dir, uuid.MustNew().UUID().String()),
+	}
+}
+
+func (b *buffer) len() int {
+	return b.length
+}
+
+func (b *buffer) bytes() int64 {
+	return b.memBytes + b.diskBytes
+}
+
+func (b *buffer) pushBack(msg Message) {
+	// Whilst nothing is on disk, the whole queue lives in the head
+	if len(b.segments) == 0 {
+		b.head.PushBack(msg)
+	} else {
+		b.tail.PushBack(msg)
+	}
+	b.length++
+	b.memBytes += msg.size()
+
+	if b.budget > 0 && b.memBytes > b.budget {
+		// If the spill fails the messages stay in memory, so nothing is lost
+		_ = b.spill()
+	}
+}
+
+// Puts a message back at the front of the queue
+func (b *buffer) pushFront(msg Message) {
+	b.head.PushFront(msg)
+	b.length++
+	b.memBytes += msg.size()
+}
+
+func (b *buffer) front() (Message, bool, error) {
+	if b.head.Len() == 0 {
+		if err := b.refill(); err != nil {
+			return Message{}, false, err
+		}
+	}
+	front := b.head.Front()
+	if front == nil {
+		return Message{}, false, nil
+	}
+	return front.Value.(Message), true, nil
+}
+
+func (b *buffer) popFront() (Message, bool, error) {
+	msg, ok, err := b.front()
+	if err != nil || !ok {
+		return msg, ok, err
+	}
+	b.head.Remove(b.head.Front())
+	b.length--
+	b.memBytes -= msg.size()
+	return msg, true, nil
+}
+
+// Calls the function for every message in order, including the ones on disk
+func (b *buffer) each(f func(Message)) error {
+	for e := b.head.Front(); e != nil; e = e.Next() {
+		f(e.Value.(Message))
+	}
+	for _, seg := range b.segments {
+		msgs, err := b.read(seg)
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			f(msg)
+		}
+	}
+	for e := b.tail.Front(); e != nil; e = e.Next() {
+		f(e.Value.(Message))
+	}
+	return nil
+}
+
+// Removes the messages that match from anywhere in the queue, returning them
+// in order
+func (b *buffer) removeIf(match func(Message) bool) ([]Message, error) {
+	out := b.removeFromList(b.head, match)
+	removed, err := b.removeFromSegments(match)
+	out = append(out, removed...)
+	out = append(out, b.removeFromList(b.tail, match)...)
+
+	// Once the disk is empty, the tail joins the head again
+	if len(b.segments) == 0 {
+		b.head.PushBackList(b.tail)
+		b.tail.Init()
+	}
+	return out, err
+}
+
+func (b *buffer) removeFromList(l *list.List, match func(Message) bool) []Message {
+	out := []Message{}
+	for e := l.Front(); e != nil; {
+		next := e.Next()
+		if msg := e.Value.(Message); match(msg) {
+			out = append(out, msg)
+			l.Remove(e)
+			b.length--
+			b.memBytes -= msg.size()
+		}
+		e = next
+	}
+	return out
+}
+
+// Rewrites the segments without the messages that match, a segment that
+// can't be rewritten is kept as it is
+func (b *buffer) removeFromSegments(match func(Message) bool) ([]Message, error) {
+	out := []Message{}
+	segments := b.segments
+	b.segments = make([]segment, 0, len(segments))
+	var errs error
+	for _, seg := range segments {
+		msgs, err := b.read(seg)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			b.segments = append(b.segments, seg)
+			continue
+		}
+		kept := make([]Message, 0, len(msgs))
+		removed := []Message{}
+		for _, msg := range msgs {
+			if match(msg) {
+				removed = append(removed, msg)
+			} else {
+				kept = append(kept, msg)
+			}
+		}
+		if len(removed) == 0 {
+			b.segments = append(b.segments, seg)
+			continue
+		}
+		if err := b.write(kept); err != nil {
+			errs = errors.Join(errs, err)
+			b.segments = append(b.segments, seg)
+			continue
+		}
+		os.Remove(seg.path)
+		b.length -= len(removed)
+		b.diskBytes -= seg.size
+		out = append(out, removed...)
+	}
+	return out, errs
+}
+
+// Empties the buffer and removes its directory, it is created again if the
+// buffer spills
+func (b *buffer) reset() {
+	b.head.Init()
+	b.tail.Init()
+	os.RemoveAll(b.dir)
+	b.segments = []segment{}
+	b.length = 0
+	b.memBytes = 0
+	b.diskBytes = 0
+}
+
+func (b *buffer) spill() error {
+	if len(b.segments) == 0 {
+		// Move the newest messages out of the head until it is back under
+		// half the budget, new messages will then build up the tail
+		msgs := []Message{}
+		var bytes int64
+		for b.head.Len() > 0 && b.memBytes-bytes > b.budget/2 {
+			msg := b.head.Back().Value.(Message)
+			msgs = append([]Message{msg}, msgs...)
+			bytes += msg.size()
+			b.head.Remove(b.head.Back())
+		}
+		if err := b.write(msgs); err != nil {
+			for _, msg := range msgs {
+				b.head.PushBack(msg)
+			}
+			return err
+		}
+		b.memBytes -= bytes
+		return nil
+	}
+
+	msgs := make([]Message, 0, b.tail.Len())
+	var bytes int64
+	for e := b.tail.Front(); e != nil; e = e.Next() {
+		msg := e.Value.(Message)
+		msgs = append(msgs, msg)
+		bytes += msg.size()
+	}
+	if err := b.write(msgs); err != nil {
+		return err
+	}
+	b.tail.Init()
+	b.memBytes -= bytes
+	return nil
+}
+
+// Loads the oldest segment from disk into the head
+func (b *buffer) refill() error {
+	if len(b.segments) == 0 {
+		return nil
+	}
+	seg := b.segments[0]
+	msgs, err := b.read(seg)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		b.head.PushBack(msg)
+	}
+	b.segments = b.segments[1:]
+	b.memBytes += seg.bytes
+	b.diskBytes -= seg.size
+	os.Remove(seg.path)
+
+	// Once the disk is empty, the tail joins the head again
+	if len(b.segments) == 0 {
+		b.head.PushBackList(b.tail)
+		b.tail.Init()
+	}
+	return nil
+}
+
+func (b *buffer) write(msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(b.dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(b.dir, fmt.Sprintf("%d.segment", b.next))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	seg := segment{path: path, count: len(msgs)}
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			os.Remove(path)
+			return err
+		}
+		seg.bytes += msg.size()
+	}
+	if err := w.Flush(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	seg.size = info.Size()
+
+	b.next++
+	b.segments = append(b.segments, seg)
+	b.diskBytes += seg.size
+	return nil
+}
+
+func (b *buffer) read(seg segment) ([]Message, error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	out := make([]Message, 0, seg.count)
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for range seg.count {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			return nil, fmt.Errorf("failed to read segment %s: %w", seg.path, err)
+		}
+		out = append(out, msg)
+	}
+	return out, nil
+}
+
+func (m Message) size() int64 {
+	size := len(m.Body)
+	for k, v := range m.Headers {
+		size += len(k) + len(v)
+	}
+	return int64(size)
+}
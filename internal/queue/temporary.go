@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/orderly-queue/orderly/internal/uuid"
+)
+
+const (
+	// Temporary queues are named with this prefix, names with it are
+	// reserved so other queues can't be created with them
+	TemporaryPrefix = "tmp."
+)
+
+var (
+	ErrTemporaryMissing = errors.New("temporary queue does not exist")
+)
+
+// Creates a queue with a unique name that lives until it is deleted. Its
+// messages don't expire and it is never recorded to the journal or included
+// in the registry's state.
+func (r *Registry) Temporary() (string, error) {
+	id, err := uuid.New()
+	if err != nil {
+		return "", err
+	}
+	name := TemporaryPrefix + id.UUID().String()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q := New(append(slices.Clone(r.defaults), WithTTL(0), WithDeadLetter(""))...)
+	q.name = name
+	q.registry = r
+	r.queues[name] = q
+	r.temporary[name] = struct{}{}
+	return name, nil
+}
+
+// Called with the lock held for reading at least
+func (r *Registry) isTemporary(name string) bool {
+	_, ok := r.temporary[name]
+	return ok
+}
@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var (
+	// Records that a subscription was added to the topic, the subscription
+	// name is stored in the body
+	OpSubscribe OpType = "subscribe"
+	// Records that a subscription was removed from the topic
+	OpUnsubscribe OpType = "unsubscribe"
+
+	ErrInvalidTopic        = errors.New("topic and subscription names can only contain letters, numbers, dashes and underscores")
+	ErrSubscriptionMissing = errors.New("subscription does not exist")
+
+	validTopic = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Returns the name of the queue that backs the subscription
+func SubscriptionQueue(topic, subscription string) string {
+	return fmt.Sprintf("%s.%s", topic, subscription)
+}
+
+// Adds a durable subscription to the topic, every message published to the
+// topic from then on is pushed to the subscription's queue. Returns the name
+// of the queue.
+func (r *Registry) Subscribe(topic, subscription string) (string, error) {
+	if !validTopic.MatchString(topic) || !validTopic.MatchString(subscription) {
+		return "", ErrInvalidTopic
+	}
+	name := SubscriptionQueue(topic, subscription)
+	if _, err := r.Get(name); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.topics[topic][subscription]; ok {
+		return name, nil
+	}
+	if _, ok := r.topics[topic]; !ok {
+		r.topics[topic] = map[string]struct{}{}
+	}
+	r.topics[topic][subscription] = struct{}{}
+	r.record(Op{Type: OpSubscribe, Topic: topic, Body: subscription})
+	return name, nil
+}
+
+// Removes the subscription from the topic along with its queue
+func (r *Registry) Unsubscribe(topic, subscription string) error {
+	r.mu.Lock()
+	if _, ok := r.topics[topic][subscription]; !ok {
+		r.mu.Unlock()
+		return ErrSubscriptionMissing
+	}
+	delete(r.topics[topic], subscription)
+	if len(r.topics[topic]) == 0 {
+		delete(r.topics, topic)
+	}
+	r.mu.Unlock()
+
+	// Recorded after the queue is drained so replaying the log doesn't bring
+	// the queue back
+	r.Delete(SubscriptionQueue(topic, subscription))
+	r.mu.RLock()
+	r.record(Op{Type: OpUnsubscribe, Topic: topic, Body: subscription})
+	r.mu.RUnlock()
+	return nil
+}
+
+// Returns the subscriptions to the topic, sorted
+func (r *Registry) Subscriptions(topic string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.topics[topic]))
+}
+
+// Records an op made on the registry rather than a queue, called with the
+// lock held for reading at least
+func (r *Registry) record(op Op) {
+	if r.journal == nil {
+		return
+	}
+	op.Time = time.Now()
+	r.journal.Record(op)
+}
+
+func (r *Registry) topicsState() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.topics) == 0 {
+		return nil
+	}
+	out := make(map[string][]string, len(r.topics))
+	for topic, subscriptions := range r.topics {
+		out[topic] = slices.Sorted(maps.Keys(subscriptions))
+	}
+	return out
+}
+
+func (r *Registry) restoreTopics(topics map[string][]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics = make(map[string]map[string]struct{}, len(topics))
+	for topic, subscriptions := range topics {
+		r.topics[topic] = make(map[string]struct{}, len(subscriptions))
+		for _, subscription := range subscriptions {
+			r.topics[topic][subscription] = struct{}{}
+		}
+	}
+}
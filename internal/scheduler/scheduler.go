@@ -0,0 +1,321 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// The most missed runs of a schedule that are caught up on start or on
+	// taking over from the leader
+	maxCatchUp = 100
+
+	// How long a run waits for space in a full queue
+	pushTimeout = time.Second * 5
+)
+
+var (
+	ErrInvalidCron     = errors.New("invalid cron expression")
+	ErrInvalidTemplate = errors.New("invalid body template")
+)
+
+// The data the body template of a schedule is rendered with
+type run struct {
+	Name string
+	Time time.Time
+}
+
+// Runs the schedules in the registry, pushing their messages to their queues
+type Scheduler struct {
+	queues *queue.Registry
+	leader func() bool
+
+	mu    *sync.Mutex
+	sched gocron.Scheduler
+	jobs  map[string]gocron.Job
+	ctx   context.Context
+
+	lastRun *prometheus.GaugeVec
+	nextRun *prometheus.GaugeVec
+}
+
+// Creates a scheduler for the registry's schedules, they only run while
+// leader returns true so standby instances don't push them too
+func New(queues *queue.Registry, leader func() bool, reg prometheus.Registerer) *Scheduler {
+	lastRun := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orderly_schedule_last_run_timestamp_seconds",
+		Help: "The unix time each schedule last pushed its message",
+	}, []string{"schedule"})
+	nextRun := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "orderly_schedule_next_run_timestamp_seconds",
+		Help: "The unix time each schedule next pushes its message",
+	}, []string{"schedule"})
+	reg.MustRegister(lastRun)
+	reg.MustRegister(nextRun)
+	return &Scheduler{
+		queues:  queues,
+		leader:  leader,
+		mu:      &sync.Mutex{},
+		jobs:    map[string]gocron.Job{},
+		lastRun: lastRun,
+		nextRun: nextRun,
+	}
+}
+
+// Adds the schedules from the config, catches up on the runs that were
+// missed by the schedules that ask for it and starts running them all
+func (s *Scheduler) Start(ctx context.Context, schedules []queue.Schedule) error {
+	logger := logger.Logger(ctx)
+	for _, sched := range schedules {
+		if err := validate(sched); err != nil {
+			return fmt.Errorf("schedule %s: %w", sched.Name, err)
+		}
+		if err := s.queues.SetSchedule(sched); err != nil {
+			return err
+		}
+	}
+
+	sched, err := gocron.NewScheduler()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.sched = sched
+	s.ctx = ctx
+	started := []queue.Schedule{}
+	for _, sched := range s.queues.Schedules() {
+		if err := validate(sched); err != nil {
+			logger.Errorw("skipping invalid schedule", "schedule", sched.Name, "error", err)
+			continue
+		}
+		if err := s.start(sched); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		started = append(started, sched)
+	}
+	s.mu.Unlock()
+
+	// Standby instances catch up when they take over
+	if s.isLeader() {
+		s.catchUpAll(ctx, started)
+	}
+
+	sched.Start()
+	go func() {
+		<-ctx.Done()
+		sched.Shutdown()
+		logger.Info("stopping scheduler")
+	}()
+	return nil
+}
+
+// Replaces the running schedules with the ones in the registry and catches
+// up on the runs they missed, called when a standby takes over and restores
+// the registry from a snapshot
+func (s *Scheduler) Promote(ctx context.Context) {
+	logger := logger.Logger(ctx)
+	s.mu.Lock()
+	if s.sched == nil {
+		s.mu.Unlock()
+		return
+	}
+	for name := range s.jobs {
+		s.stop(name)
+	}
+	started := []queue.Schedule{}
+	for _, sched := range s.queues.Schedules() {
+		if err := validate(sched); err != nil {
+			logger.Errorw("skipping invalid schedule", "schedule", sched.Name, "error", err)
+			continue
+		}
+		if err := s.start(sched); err != nil {
+			logger.Errorw("failed to start schedule", "schedule", sched.Name, "error", err)
+			continue
+		}
+		started = append(started, sched)
+	}
+	s.mu.Unlock()
+
+	s.catchUpAll(ctx, started)
+}
+
+// Adds the schedule, replacing any schedule with the same name
+func (s *Scheduler) Add(sched queue.Schedule) error {
+	if err := validate(sched); err != nil {
+		return err
+	}
+	if err := s.queues.SetSchedule(sched); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sched == nil {
+		return nil
+	}
+	s.stop(sched.Name)
+	return s.start(sched)
+}
+
+func (s *Scheduler) Remove(name string) error {
+	if err := s.queues.RemoveSchedule(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop(name)
+	return nil
+}
+
+// Returns the schedules sorted by name
+func (s *Scheduler) Schedules() []queue.Schedule {
+	return s.queues.Schedules()
+}
+
+// Called with the lock held
+func (s *Scheduler) start(sched queue.Schedule) error {
+	job, err := s.sched.NewJob(
+		gocron.CronJob(sched.Cron, false),
+		gocron.NewTask(s.run, sched.Name),
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCron, err)
+	}
+	s.jobs[sched.Name] = job
+	if sched.LastRun > 0 {
+		s.lastRun.WithLabelValues(sched.Name).Set(float64(sched.LastRun) / float64(time.Second))
+	}
+	s.reportNext(sched.Name, job)
+	return nil
+}
+
+// Called with the lock held
+func (s *Scheduler) stop(name string) {
+	job, ok := s.jobs[name]
+	if !ok {
+		return
+	}
+	if err := s.sched.RemoveJob(job.ID()); err != nil {
+		logger.Logger(s.ctx).Errorw("failed to remove schedule", "schedule", name, "error", err)
+	}
+	delete(s.jobs, name)
+	s.lastRun.DeleteLabelValues(name)
+	s.nextRun.DeleteLabelValues(name)
+}
+
+func (s *Scheduler) run(name string) {
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if job, ok := s.jobs[name]; ok {
+			s.reportNext(name, job)
+		}
+	}()
+	if !s.isLeader() {
+		return
+	}
+	sched, err := s.queues.Schedule(name)
+	if err != nil {
+		return
+	}
+	s.push(s.ctx, sched, time.Now())
+}
+
+// Catches up on the schedules that ask for it, called without the lock held
+// as the pushes can wait for space in their queues
+func (s *Scheduler) catchUpAll(ctx context.Context, schedules []queue.Schedule) {
+	for _, sched := range schedules {
+		if sched.Missed == queue.MissedCatchUp {
+			s.catchUp(ctx, sched, time.Now())
+		}
+	}
+}
+
+// Pushes the messages of the runs missed since the schedule last ran, up to
+// maxCatchUp of them
+func (s *Scheduler) catchUp(ctx context.Context, sched queue.Schedule, now time.Time) {
+	if sched.LastRun == 0 {
+		return
+	}
+	spec, err := cron.ParseStandard(sched.Cron)
+	if err != nil {
+		return
+	}
+	at := time.Unix(0, sched.LastRun)
+	for range maxCatchUp {
+		at = spec.Next(at)
+		if at.After(now) {
+			return
+		}
+		s.push(ctx, sched, at)
+	}
+}
+
+func (s *Scheduler) push(ctx context.Context, sched queue.Schedule, at time.Time) {
+	logger := logger.Logger(ctx)
+	body, err := render(sched, at)
+	if err != nil {
+		logger.Errorw("failed to render schedule body", "schedule", sched.Name, "error", err)
+		return
+	}
+	q, err := s.queues.Get(sched.Queue)
+	if err != nil {
+		logger.Errorw("failed to get schedule queue", "schedule", sched.Name, "queue", sched.Queue, "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+	defer cancel()
+	if err := q.PushContext(ctx, body); err != nil {
+		logger.Errorw("failed to push scheduled message", "schedule", sched.Name, "queue", sched.Queue, "error", err)
+		return
+	}
+	s.queues.Ran(sched.Name, at)
+	s.lastRun.WithLabelValues(sched.Name).Set(float64(at.UnixNano()) / float64(time.Second))
+}
+
+func (s *Scheduler) reportNext(name string, job gocron.Job) {
+	next, err := job.NextRun()
+	if err != nil {
+		return
+	}
+	s.nextRun.WithLabelValues(name).Set(float64(next.UnixNano()) / float64(time.Second))
+}
+
+func (s *Scheduler) isLeader() bool {
+	return s.leader == nil || s.leader()
+}
+
+func validate(sched queue.Schedule) error {
+	if _, err := cron.ParseStandard(sched.Cron); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCron, err)
+	}
+	if _, err := template.New(sched.Name).Parse(sched.Body); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return nil
+}
+
+func render(sched queue.Schedule, at time.Time) (string, error) {
+	tmpl, err := template.New(sched.Name).Parse(sched.Body)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, run{Name: sched.Name, Time: at}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,133 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItValidatesSchedules(t *testing.T) {
+	s := New(queue.NewRegistry(), nil, prometheus.NewRegistry())
+
+	require.ErrorIs(t, s.Add(queue.Schedule{Name: "bad", Cron: "every minute"}), ErrInvalidCron)
+	require.ErrorIs(t, s.Add(queue.Schedule{Name: "bad", Cron: "* * * * *", Body: "{{.Nope"}), ErrInvalidTemplate)
+	require.ErrorIs(t, s.Add(queue.Schedule{Name: "bad", Cron: "* * * * *", Missed: "sometimes"}), queue.ErrInvalidSchedule)
+	require.Nil(t, s.Add(queue.Schedule{Name: "good", Cron: "* * * * *"}))
+	require.Len(t, s.Schedules(), 1)
+}
+
+func TestItCatchesUpOnMissedRuns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	now := time.Now()
+	last := now.Truncate(time.Hour).Add(-time.Hour * 3)
+	for _, missed := range []queue.Missed{queue.MissedSkip, queue.MissedCatchUp} {
+		require.Nil(t, reg.SetSchedule(queue.Schedule{
+			Name:    string(missed),
+			Cron:    "0 * * * *",
+			Queue:   string(missed),
+			Body:    "{{.Name}} {{.Time.Hour}}",
+			Missed:  missed,
+			LastRun: last.UnixNano(),
+		}))
+	}
+
+	s := New(reg, nil, prometheus.NewRegistry())
+	require.Nil(t, s.Start(ctx, nil))
+
+	skipped, err := reg.Get(string(queue.MissedSkip))
+	require.Nil(t, err)
+	require.Equal(t, uint(0), skipped.Len())
+
+	caught, err := reg.Get(string(queue.MissedCatchUp))
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		fmt.Sprintf("catch_up %d", last.Add(time.Hour).Hour()),
+		fmt.Sprintf("catch_up %d", last.Add(time.Hour*2).Hour()),
+		fmt.Sprintf("catch_up %d", last.Add(time.Hour*3).Hour()),
+	}, caught.Snapshot())
+
+	sched, err := reg.Schedule(string(queue.MissedCatchUp))
+	require.Nil(t, err)
+	require.Equal(t, now.Truncate(time.Hour).UnixNano(), sched.LastRun)
+}
+
+func TestAStandbyCatchesUpWhenItTakesOver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	last := time.Now().Truncate(time.Hour).Add(-time.Hour * 2)
+	require.Nil(t, reg.SetSchedule(queue.Schedule{
+		Name:    "hourly",
+		Cron:    "0 * * * *",
+		Queue:   "hourly",
+		Missed:  queue.MissedCatchUp,
+		LastRun: last.UnixNano(),
+	}))
+
+	leader := false
+	s := New(reg, func() bool { return leader }, prometheus.NewRegistry())
+	require.Nil(t, s.Start(ctx, nil))
+	q, err := reg.Get("hourly")
+	require.Nil(t, err)
+	require.Equal(t, uint(0), q.Len())
+
+	leader = true
+	s.Promote(ctx)
+	require.Equal(t, uint(2), q.Len())
+}
+
+func TestCatchingUpDoesNotBlockChangesToSchedules(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	reg.Configure("full", queue.WithLimits(queue.Limits{MaxLength: 1, Overflow: queue.OverflowBlock}))
+	require.Nil(t, reg.SetSchedule(queue.Schedule{
+		Name:    "hourly",
+		Cron:    "0 * * * *",
+		Queue:   "full",
+		Missed:  queue.MissedCatchUp,
+		LastRun: time.Now().Truncate(time.Hour).Add(-time.Hour * 3).UnixNano(),
+	}))
+
+	s := New(reg, nil, prometheus.NewRegistry())
+	started := make(chan error, 1)
+	go func() {
+		started <- s.Start(ctx, nil)
+	}()
+
+	// The second catch up push waits for space in the full queue
+	require.Eventually(t, func() bool {
+		q, err := reg.Get("full")
+		return err == nil && q.Len() == 1
+	}, time.Second, time.Millisecond*10)
+	added := make(chan error, 1)
+	go func() {
+		added <- s.Add(queue.Schedule{Name: "other", Cron: "* * * * *"})
+	}()
+	select {
+	case err := <-added:
+		require.Nil(t, err)
+	case <-time.After(time.Second):
+		require.FailNow(t, "adding a schedule waited for the catch up")
+	}
+
+	cancel()
+	require.Nil(t, <-started)
+}
+
+func TestItRendersTheBody(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	out, err := render(queue.Schedule{Name: "report", Body: `{{.Name}} at {{.Time.Format "2006-01-02"}}`}, at)
+	require.Nil(t, err)
+	require.Equal(t, "report at 2024-01-02", out)
+}
@@ -0,0 +1,205 @@
+// Package server runs orderly, it backs the orderly binary and the public
+// pkg/server package that embeds it
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/henrywhitaker3/ctxgen"
+	"github.com/orderly-queue/orderly/internal/app"
+	ohttp "github.com/orderly-queue/orderly/internal/http"
+	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/thanos-io/objstore"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAlreadyStarted = errors.New("server has already been started")
+)
+
+type options struct {
+	bucket  objstore.Bucket
+	version string
+}
+
+type Option func(*options)
+
+// Stores snapshots in the bucket rather than the one in the storage config,
+// storage is enabled when it's set
+func WithBucket(bucket objstore.Bucket) Option {
+	return func(o *options) {
+		o.bucket = bucket
+	}
+}
+
+// Stores snapshots in memory, they are lost when the process exits
+func WithMemoryStorage() Option {
+	return WithBucket(objstore.NewInMemBucket())
+}
+
+// The version reported by the server
+func WithVersion(version string) Option {
+	return func(o *options) {
+		o.version = version
+	}
+}
+
+type Server struct {
+	app *app.App
+
+	mu      *sync.Mutex
+	started bool
+	cancel  context.CancelFunc
+	// Closed once Start has returned
+	done chan struct{}
+}
+
+// Builds a server from a copy of the config with its defaults set, the copy
+// is validated
+func New(ctx context.Context, conf *config.Config, opts ...Option) (*Server, error) {
+	o := &options{version: "dev"}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	copied := *conf
+	conf = &copied
+
+	if o.bucket != nil {
+		conf.Storage.Enabled = true
+	}
+	conf.SetDefaults()
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	appOpts := []app.Option{}
+	if o.bucket != nil {
+		appOpts = append(appOpts, app.WithStorage(o.bucket))
+	}
+	a, err := app.New(ctx, conf, appOpts...)
+	if err != nil {
+		return nil, err
+	}
+	a.Version = o.version
+	a.Http = ohttp.New(a)
+
+	return &Server{
+		app:  a,
+		mu:   &sync.Mutex{},
+		done: make(chan struct{}),
+	}, nil
+}
+
+// The app the server runs, for the commands built into the orderly binary
+func (s *Server) App() *app.App {
+	return s.app
+}
+
+// The queues, topics, bindings and schedules the server holds
+func (s *Server) Queues() *queue.Registry {
+	return s.app.Queues
+}
+
+// The handler serving the api, for mounting it on another http server rather
+// than calling Start
+func (s *Server) Handler() http.Handler {
+	return s.app.Http
+}
+
+// Restores the latest snapshot and serves the api until the context is
+// cancelled or Stop is called. A final snapshot is taken before it returns.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return ErrAlreadyStarted
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+	defer close(s.done)
+	defer s.cancel()
+
+	app := s.app
+
+	// Embedders may not have set up a logger, which the app logs through
+	if _, ok := ctxgen.ValueOk[*zap.SugaredLogger](ctx, "logger"); !ok {
+		ctx = logger.Wrap(ctx, app.Config.LogLevel.Level())
+	}
+
+	// Runs after the final snapshot, which reads any spilled messages
+	defer app.Queues.Close()
+
+	go app.Probes.Start(ctx)
+
+	go func() {
+		<-ctx.Done()
+		ctx := context.Background()
+		app.Probes.Unready()
+
+		app.Metrics.Stop(ctx)
+		app.Probes.Stop(ctx)
+		app.Http.Stop(ctx)
+	}()
+
+	if app.Config.Queue.Snapshot.Enabled {
+		if err := app.Snapshotter.Acquire(ctx); err != nil {
+			return err
+		}
+		// Standby instances restore the snapshot once they take over the lease
+		if app.Snapshotter.Leader() {
+			if err := app.Snapshotter.Restore(ctx); err != nil {
+				return err
+			}
+		}
+		if err := app.Snapshotter.Work(ctx); err != nil {
+			return err
+		}
+		// Run a snapshot before shutdown so we don't load up stale data
+		defer func() {
+			ctx := context.Background()
+			app.Snapshotter.Snapshot(ctx)
+			app.Snapshotter.Ship(ctx)
+			app.Snapshotter.Release(ctx)
+		}()
+	}
+
+	if err := app.Scheduler.Start(ctx, app.Schedules()); err != nil {
+		return err
+	}
+
+	go app.Queue.Report(ctx)
+	go app.Queues.Sweep(ctx, app.Config.Queue.SweepInterval)
+
+	go app.Metrics.Start(ctx)
+
+	app.Probes.Ready()
+	app.Probes.Healthy()
+
+	return app.Http.Start(ctx)
+}
+
+// Stops the server and waits for Start to return, or for the context to be
+// cancelled
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	started, cancel := s.started, s.cancel
+	s.mu.Unlock()
+	if !started {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,146 @@
+package snapshotter
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+)
+
+// Sorted, non-overlapping, inclusive ranges of sequence numbers
+type ranges [][2]uint64
+
+func toRanges(seqs []uint64) ranges {
+	sorted := slices.Clone(seqs)
+	slices.Sort(sorted)
+	out := ranges{}
+	for _, seq := range sorted {
+		if len(out) > 0 && out[len(out)-1][1]+1 >= seq {
+			out[len(out)-1][1] = max(out[len(out)-1][1], seq)
+			continue
+		}
+		out = append(out, [2]uint64{seq, seq})
+	}
+	return out
+}
+
+func (r ranges) contains(seq uint64) bool {
+	i := sort.Search(len(r), func(i int) bool {
+		return r[i][1] >= seq
+	})
+	return i < len(r) && r[i][0] <= seq
+}
+
+// Returns the ranges in r that are not in o
+func (r ranges) subtract(o ranges) ranges {
+	out := ranges{}
+	j := 0
+	for _, rng := range r {
+		from, to := rng[0], rng[1]
+		for j < len(o) && o[j][1] < from {
+			j++
+		}
+		k := j
+		for ; k < len(o) && o[k][0] <= to; k++ {
+			if o[k][0] > from {
+				out = append(out, [2]uint64{from, o[k][0] - 1})
+			}
+			if o[k][1] >= to {
+				from = to + 1
+				break
+			}
+			from = o[k][1] + 1
+		}
+		if from <= to {
+			out = append(out, [2]uint64{from, to})
+		}
+	}
+	return out
+}
+
+// The changes made to the queue since the previous snapshot in the chain
+type delta struct {
+	Version  int             `json:"version"`
+	Base     string          `json:"base"`
+	Seq      uint64          `json:"seq"`
+	Removed  ranges          `json:"removed"`
+	Appended []queue.Message `json:"appended"`
+
+	// The dedup keys, topics, bindings, jobs, schedules and named queues other
+	// than the default are stored in full
+	Dedup     []queue.DedupKey       `json:"dedup,omitempty"`
+	Queues    map[string]queue.State `json:"queues,omitempty"`
+	Topics    map[string][]string    `json:"topics,omitempty"`
+	Bindings  []queue.Binding        `json:"bindings,omitempty"`
+	Jobs      []queue.Job            `json:"jobs,omitempty"`
+	Schedules []queue.Schedule       `json:"schedules,omitempty"`
+}
+
+func (d delta) apply(state queue.State) queue.State {
+	out := queue.State{
+		Seq:       d.Seq,
+		Messages:  make([]queue.Message, 0, len(state.Messages)+len(d.Appended)),
+		Dedup:     d.Dedup,
+		Queues:    d.Queues,
+		Topics:    d.Topics,
+		Bindings:  d.Bindings,
+		Jobs:      d.Jobs,
+		Schedules: d.Schedules,
+	}
+	for _, msg := range state.Messages {
+		if !d.Removed.contains(msg.Seq) {
+			out.Messages = append(out.Messages, msg)
+		}
+	}
+	out.Messages = append(out.Messages, d.Appended...)
+	return out
+}
+
+// Tracks the state of the last snapshot uploaded so the next delta can be
+// calculated from it
+type chain struct {
+	base   Snapshot
+	deltas uint
+	seqs   ranges
+	next   uint64
+}
+
+func newChain(base Snapshot, state queue.State) *chain {
+	c := &chain{base: base}
+	c.advance(state)
+	return c
+}
+
+func (c *chain) advance(state queue.State) {
+	seqs := make([]uint64, 0, len(state.Messages))
+	for _, msg := range state.Messages {
+		seqs = append(seqs, msg.Seq)
+	}
+	c.seqs = toRanges(seqs)
+	c.next = state.Seq
+}
+
+func (c *chain) diff(state queue.State) delta {
+	d := delta{
+		Version:   version,
+		Base:      c.base.Name,
+		Seq:       state.Seq,
+		Appended:  []queue.Message{},
+		Dedup:     state.Dedup,
+		Queues:    state.Queues,
+		Topics:    state.Topics,
+		Bindings:  state.Bindings,
+		Jobs:      state.Jobs,
+		Schedules: state.Schedules,
+	}
+	existing := []uint64{}
+	for _, msg := range state.Messages {
+		if msg.Seq < c.next {
+			existing = append(existing, msg.Seq)
+		} else {
+			d.Appended = append(d.Appended, msg)
+		}
+	}
+	d.Removed = c.seqs.subtract(toRanges(existing))
+	return d
+}
@@ -0,0 +1,142 @@
+package snapshotter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func TestItSubtractsRanges(t *testing.T) {
+	type testCase struct {
+		name     string
+		r        ranges
+		o        ranges
+		expected ranges
+	}
+
+	tcs := []testCase{
+		{
+			name:     "subtracts nothing",
+			r:        ranges{{0, 10}},
+			o:        ranges{},
+			expected: ranges{{0, 10}},
+		},
+		{
+			name:     "subtracts everything",
+			r:        ranges{{0, 10}},
+			o:        ranges{{0, 10}},
+			expected: ranges{},
+		},
+		{
+			name:     "subtracts the head",
+			r:        ranges{{0, 10}},
+			o:        ranges{{3, 10}},
+			expected: ranges{{0, 2}},
+		},
+		{
+			name:     "subtracts the middle",
+			r:        ranges{{0, 10}, {15, 20}},
+			o:        ranges{{0, 2}, {5, 6}, {9, 16}},
+			expected: ranges{{3, 4}, {7, 8}, {17, 20}},
+		},
+	}
+
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.expected, c.r.subtract(c.o))
+		})
+	}
+}
+
+func TestItBuildsRanges(t *testing.T) {
+	r := toRanges([]uint64{5, 1, 2, 3, 7, 8, 10})
+	require.Equal(t, ranges{{1, 3}, {5, 5}, {7, 8}, {10, 10}}, r)
+	require.True(t, r.contains(2))
+	require.True(t, r.contains(10))
+	require.False(t, r.contains(4))
+	require.False(t, r.contains(11))
+}
+
+func TestItTakesDeltaSnapshots(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	q := queue.New()
+	snap := New(config.Snapshot{
+		Enabled:    true,
+		Schedule:   "* * * *",
+		NamePrefix: "bongo",
+		Deltas: config.Deltas{
+			Enabled:   true,
+			FullEvery: 2,
+		},
+	}, q, bucket, prometheus.NewRegistry())
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		q.Push(item)
+	}
+	require.Nil(t, snap.Snapshot(ctx))
+
+	// The names are only precise to the second
+	time.Sleep(time.Second)
+	_, err = q.Pop()
+	require.Nil(t, err)
+	q.Push("e")
+	require.Nil(t, snap.Snapshot(ctx))
+
+	time.Sleep(time.Second)
+	q.Push("f")
+	_, err = q.Pop()
+	require.Nil(t, err)
+	require.Nil(t, snap.Snapshot(ctx))
+
+	snaps, err := snap.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 3)
+	require.False(t, snaps[0].IsDelta())
+	require.True(t, snaps[1].IsDelta())
+	require.True(t, snaps[2].IsDelta())
+	require.Equal(t, snaps[0].Name, snaps[2].Base)
+
+	latest, err := snap.Latest(ctx)
+	require.Nil(t, err)
+	state, err := snap.OpenState(ctx, *latest)
+	require.Nil(t, err)
+	require.Equal(t, q.State(), state)
+
+	items, err := snap.Open(ctx, snaps[1])
+	require.Nil(t, err)
+	require.Equal(t, []string{"b", "c", "d", "e"}, items)
+
+	// After the configured number of deltas a full snapshot is taken
+	time.Sleep(time.Second)
+	require.Nil(t, snap.Snapshot(ctx))
+	latest, err = snap.Latest(ctx)
+	require.Nil(t, err)
+	require.False(t, latest.IsDelta())
+
+	items, err = snap.Open(ctx, *latest)
+	require.Nil(t, err)
+	require.Equal(t, []string{"c", "d", "e", "f"}, items)
+}
+
+func TestItKeepsTheSnapshotsADeltaDependsOn(t *testing.T) {
+	now := time.Now()
+	full := Snapshot{Name: "full", Time: now.Add(-time.Hour * 3)}
+	first := Snapshot{Name: "first", Time: now.Add(-time.Hour * 2), Base: "full"}
+	second := Snapshot{Name: "second", Time: now.Add(-time.Hour), Base: "full"}
+	old := Snapshot{Name: "old", Time: now.Add(-time.Hour * 4)}
+
+	kept, pruned := retain(config.Snapshot{}, []Snapshot{old, full, first, second}, nil, now)
+	require.Equal(t, []Snapshot{second, first, full}, kept)
+	require.Equal(t, []Snapshot{old}, pruned)
+}
@@ -0,0 +1,184 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/uuid"
+	"github.com/thanos-io/objstore"
+)
+
+var (
+	ErrLeaseHeld    = errors.New("snapshot lease is held by another instance")
+	ErrLeaseNotHeld = errors.New("snapshot lease is not held by this instance")
+)
+
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Token   uint64    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// A lease stored as an object in the bucket, only the holder of the lease
+// should write snapshots. Object storage has no conditional writes, so the
+// lease is read back after every write and the fencing token is verified
+// before each snapshot is uploaded.
+type Lease struct {
+	bucket objstore.Bucket
+	name   string
+	holder string
+	ttl    time.Duration
+
+	mu      *sync.RWMutex
+	token   uint64
+	expires time.Time
+}
+
+func NewLease(bucket objstore.Bucket, name string, ttl time.Duration) *Lease {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "orderly"
+	}
+	return &Lease{
+		bucket: bucket,
+		name:   name,
+		holder: fmt.Sprintf("%s-%s", host, uuid.MustNew().UUID().String()),
+		ttl:    ttl,
+		mu:     &sync.RWMutex{},
+	}
+}
+
+// Acquires or renews the lease, returns ErrLeaseHeld when another instance
+// holds a lease that has not expired
+func (l *Lease) Acquire(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	next := leaseRecord{
+		Holder:  l.holder,
+		Token:   1,
+		Expires: now.Add(l.ttl),
+	}
+	if current != nil {
+		if current.Holder != l.holder && current.Expires.After(now) {
+			l.expires = time.Time{}
+			return fmt.Errorf("%w: %s", ErrLeaseHeld, current.Holder)
+		}
+		next.Token = current.Token
+		if current.Holder != l.holder || current.Token != l.token {
+			next.Token++
+		}
+	}
+
+	if err := l.write(ctx, next); err != nil {
+		return err
+	}
+
+	// Read the lease back in case another instance wrote at the same time
+	written, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if written == nil || written.Holder != l.holder || written.Token != next.Token {
+		l.expires = time.Time{}
+		return ErrLeaseHeld
+	}
+
+	l.token = next.Token
+	l.expires = next.Expires
+	return nil
+}
+
+// Checks the lease in the bucket still has this instance's fencing token
+func (l *Lease) Verify(ctx context.Context) error {
+	if !l.Held() {
+		return ErrLeaseNotHeld
+	}
+	current, err := l.read(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Holder != l.holder || current.Token != l.Token() {
+		l.mu.Lock()
+		l.expires = time.Time{}
+		l.mu.Unlock()
+		return ErrLeaseNotHeld
+	}
+	return nil
+}
+
+// Expires the lease so another instance can acquire it straight away, the
+// token is kept so it keeps increasing
+func (l *Lease) Release(ctx context.Context) error {
+	if err := l.Verify(ctx); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.write(ctx, leaseRecord{
+		Holder:  l.holder,
+		Token:   l.token,
+		Expires: time.Now(),
+	}); err != nil {
+		return err
+	}
+	l.expires = time.Time{}
+	return nil
+}
+
+func (l *Lease) Held() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return time.Now().Before(l.expires)
+}
+
+func (l *Lease) Token() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.token
+}
+
+func (l *Lease) Holder() string {
+	return l.holder
+}
+
+func (l *Lease) read(ctx context.Context) (*leaseRecord, error) {
+	raw, err := l.bucket.Get(ctx, l.name)
+	if err != nil {
+		if l.bucket.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer raw.Close()
+	by, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	var out leaseRecord
+	if err := json.Unmarshal(by, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (l *Lease) write(ctx context.Context, record leaseRecord) error {
+	by, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return l.bucket.Upload(ctx, l.name, bytes.NewReader(by))
+}
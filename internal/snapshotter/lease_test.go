@@ -0,0 +1,146 @@
+package snapshotter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func TestOnlyOneInstanceHoldsTheLease(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	first := NewLease(bucket, "bongo/lease", time.Minute)
+	second := NewLease(bucket, "bongo/lease", time.Minute)
+
+	require.Nil(t, first.Acquire(ctx))
+	require.True(t, first.Held())
+	require.Equal(t, uint64(1), first.Token())
+
+	require.ErrorIs(t, second.Acquire(ctx), ErrLeaseHeld)
+	require.False(t, second.Held())
+
+	// Renewing keeps the same fencing token
+	require.Nil(t, first.Acquire(ctx))
+	require.Equal(t, uint64(1), first.Token())
+
+	require.Nil(t, first.Release(ctx))
+	require.False(t, first.Held())
+
+	require.Nil(t, second.Acquire(ctx))
+	require.Equal(t, uint64(2), second.Token())
+	require.ErrorIs(t, first.Verify(ctx), ErrLeaseNotHeld)
+}
+
+func TestTheLeaseCanBeTakenOverWhenItExpires(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	first := NewLease(bucket, "lease", time.Millisecond*50)
+	second := NewLease(bucket, "lease", time.Minute)
+
+	require.Nil(t, first.Acquire(ctx))
+	time.Sleep(time.Millisecond * 100)
+
+	require.Nil(t, second.Acquire(ctx))
+	require.Equal(t, uint64(2), second.Token())
+	require.ErrorIs(t, first.Acquire(ctx), ErrLeaseHeld)
+}
+
+func TestItRefusesToStartWithoutTheLeaseUnlessStandby(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	conf := config.Snapshot{
+		Enabled:    true,
+		Schedule:   "* * * *",
+		NamePrefix: "bongo",
+		Lease: config.Lease{
+			Enabled: true,
+			TTL:     time.Minute,
+		},
+	}
+
+	leader := New(conf, queue.New(), bucket, prometheus.NewRegistry())
+	require.Nil(t, leader.Acquire(ctx))
+	require.True(t, leader.Leader())
+
+	follower := New(conf, queue.New(), bucket, prometheus.NewRegistry())
+	require.ErrorIs(t, follower.Acquire(ctx), ErrLeaseHeld)
+
+	conf.Lease.Standby = true
+	standby := New(conf, queue.New(), bucket, prometheus.NewRegistry())
+	require.Nil(t, standby.Acquire(ctx))
+	require.False(t, standby.Leader())
+	require.ErrorIs(t, standby.Snapshot(ctx), ErrLeaseNotHeld)
+
+	// The leader only snapshots once it has restored the queue
+	require.ErrorIs(t, leader.Snapshot(ctx), ErrNotRestored)
+	require.Nil(t, leader.Restore(ctx))
+	require.Nil(t, leader.Snapshot(ctx))
+	snaps, err := leader.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 1)
+}
+
+func TestAStandbyRestoresTheQueueWhenItTakesOverTheLease(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	conf := config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Lease: config.Lease{
+			Enabled: true,
+			Standby: true,
+			TTL:     time.Minute,
+		},
+	}
+
+	leaderQueue := queue.New()
+	leader := New(conf, leaderQueue, bucket, prometheus.NewRegistry())
+	require.Nil(t, leader.Acquire(ctx))
+	require.Nil(t, leader.Restore(ctx))
+	require.Nil(t, leaderQueue.Push("hello"))
+	require.Nil(t, leader.Snapshot(ctx))
+
+	standbyQueue := queue.New()
+	standby := New(conf, standbyQueue, bucket, prometheus.NewRegistry())
+	promoted := false
+	standby.OnPromote(func(context.Context) { promoted = true })
+	require.Nil(t, standby.Acquire(ctx))
+	require.False(t, standby.Writable())
+
+	require.Nil(t, leader.Release(ctx))
+	require.Nil(t, standby.renew(ctx))
+	require.True(t, standby.Leader())
+	require.True(t, standby.Writable())
+	require.True(t, promoted)
+	require.Equal(t, uint(1), standbyQueue.Len())
+
+	// The standby's snapshots carry on from the leader's state
+	require.Nil(t, standby.Snapshot(ctx))
+	latest, err := standby.Latest(ctx)
+	require.Nil(t, err)
+	state, err := standby.Open(ctx, *latest)
+	require.Nil(t, err)
+	require.Equal(t, []string{"hello"}, state)
+}
@@ -0,0 +1,476 @@
+package snapshotter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrNoSnapshotBefore = errors.New("there is no snapshot before the given time")
+)
+
+const (
+	logDir    = "log"
+	logSuffix = ".log"
+
+	// Recorded when the queue is restored from a snapshot, the snapshot name
+	// is stored in the body
+	opRestore queue.OpType = "restore"
+)
+
+// A sealed segment of the operation log
+type Segment struct {
+	Start time.Time
+	End   time.Time
+	Name  string
+}
+
+// Buffers the operations recorded by the queue until they are sealed into a
+// segment and shipped to the bucket
+type oplog struct {
+	mu      *sync.Mutex
+	current []queue.Op
+	sealed  [][]queue.Op
+
+	// The max number of sealed segments held, 0 is unlimited
+	max     uint
+	dropped prometheus.Counter
+}
+
+func newOplog(max uint, dropped prometheus.Counter) *oplog {
+	return &oplog{
+		mu:      &sync.Mutex{},
+		current: []queue.Op{},
+		sealed:  [][]queue.Op{},
+		max:     max,
+		dropped: dropped,
+	}
+}
+
+// Records an operation to the log, implements queue.Journal
+func (s *Snapshotter) Record(op queue.Op) {
+	if !s.conf.Log.Enabled {
+		return
+	}
+	s.log.mu.Lock()
+	defer s.log.mu.Unlock()
+	s.log.current = append(s.log.current, op)
+	if uint(len(s.log.current)) >= s.conf.Log.SegmentSize {
+		s.log.seal()
+	}
+}
+
+// Records that the queue was restored from the snapshot, so replaying the log
+// starts from the snapshot again
+func (s *Snapshotter) Restored(snapshot *Snapshot) {
+	name := ""
+	if snapshot != nil {
+		name = snapshot.Name
+	}
+	s.Record(queue.Op{Time: time.Now(), Type: opRestore, Body: name})
+}
+
+func (l *oplog) seal() {
+	if len(l.current) == 0 {
+		return
+	}
+	l.sealed = append(l.sealed, l.current)
+	l.current = []queue.Op{}
+	l.trim()
+}
+
+// Drops the oldest sealed segments past the max, so segments that keep
+// failing to ship don't grow without limit
+func (l *oplog) trim() {
+	if l.max == 0 || uint(len(l.sealed)) <= l.max {
+		return
+	}
+	over := len(l.sealed) - int(l.max)
+	l.sealed = l.sealed[over:]
+	l.dropped.Add(float64(over))
+}
+
+// Seals the current segment and uploads all the sealed segments, segments
+// that fail to upload are retried on the next run
+func (s *Snapshotter) Ship(ctx context.Context) error {
+	logger := logger.Logger(ctx)
+
+	s.log.mu.Lock()
+	s.log.seal()
+	sealed := s.log.sealed
+	s.log.sealed = [][]queue.Op{}
+	s.log.mu.Unlock()
+
+	if !s.Leader() || !s.Writable() {
+		logger.Debugw("discarding log segments as the lease is not held", "count", len(sealed))
+		return nil
+	}
+
+	var failed [][]queue.Op
+	var err error
+	for i, ops := range sealed {
+		if err = s.uploadSegment(ctx, ops); err != nil {
+			logger.Errorw("failed to ship log segment", "error", err)
+			failed = sealed[i:]
+			break
+		}
+	}
+
+	if len(failed) > 0 {
+		s.log.mu.Lock()
+		s.log.sealed = append(failed, s.log.sealed...)
+		s.log.trim()
+		s.log.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Snapshotter) uploadSegment(ctx context.Context, ops []queue.Op) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			return err
+		}
+	}
+	return s.bucket.Upload(ctx, s.segmentName(ops[0].Time, ops[len(ops)-1].Time), buf)
+}
+
+func (s *Snapshotter) segmentName(start, end time.Time) string {
+	return s.prefixed(fmt.Sprintf(
+		"%s/%s_%s%s",
+		logDir,
+		start.UTC().Format(time.RFC3339Nano),
+		end.UTC().Format(time.RFC3339Nano),
+		logSuffix,
+	))
+}
+
+// Returns the log segments in the bucket, ordered from oldest to newest
+func (s *Snapshotter) Segments(ctx context.Context) ([]Segment, error) {
+	logger := logger.Logger(ctx)
+	out := []Segment{}
+	if err := s.bucket.Iter(ctx, s.prefixed(logDir)+"/", func(name string) error {
+		if !strings.HasSuffix(name, logSuffix) {
+			return nil
+		}
+		times := strings.TrimSuffix(strings.TrimPrefix(name, s.prefixed(logDir)+"/"), logSuffix)
+		start, end, ok := strings.Cut(times, "_")
+		if !ok {
+			logger.Errorw("failed to parse log segment name", "name", name)
+			return nil
+		}
+		seg := Segment{Name: name}
+		var err error
+		if seg.Start, err = time.Parse(time.RFC3339Nano, start); err != nil {
+			logger.Errorw("failed to parse log segment name", "name", name, "error", err)
+			return nil
+		}
+		if seg.End, err = time.Parse(time.RFC3339Nano, end); err != nil {
+			logger.Errorw("failed to parse log segment name", "name", name, "error", err)
+			return nil
+		}
+		out = append(out, seg)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+	return out, nil
+}
+
+func (s *Snapshotter) readSegment(ctx context.Context, seg Segment) ([]queue.Op, error) {
+	by, err := s.get(ctx, seg.Name)
+	if err != nil {
+		return nil, err
+	}
+	out := []queue.Op{}
+	scanner := bufio.NewScanner(bytes.NewReader(by))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var op queue.Op
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return nil, err
+		}
+		out = append(out, op)
+	}
+	return out, scanner.Err()
+}
+
+// Deletes the log segments that end before the time, they can't be replayed
+// without a snapshot from before them
+func (s *Snapshotter) pruneSegments(ctx context.Context, before time.Time) error {
+	logger := logger.Logger(ctx)
+	segments, err := s.Segments(ctx)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, seg := range segments {
+		if !seg.End.Before(before) {
+			continue
+		}
+		if s.conf.Retention.DryRun {
+			logger.Infow("would prune log segment", "segment", seg.Name, "dry_run", true)
+			continue
+		}
+		if err := s.bucket.Delete(ctx, seg.Name); err != nil {
+			logger.Errorw("failed to delete log segment", "segment", seg.Name, "error", err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		logger.Infow("pruned log segments", "count", deleted)
+	}
+	return nil
+}
+
+// A step taken whilst rebuilding the state of the queue
+type Step struct {
+	// The name of the snapshot or log segment
+	Name string
+	// The number of operations replayed from a log segment
+	Ops int
+	// The number of items in the queue after the step
+	Items int
+}
+
+// Rebuilds the state of the queue at the given time from the latest snapshot
+// before it and the log segments that came after the snapshot
+func (s *Snapshotter) StateAt(ctx context.Context, at time.Time) (queue.State, []Step, error) {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return queue.State{}, nil, err
+	}
+	var base *Snapshot
+	for _, sn := range snapshots {
+		if !sn.Time.After(at) {
+			base = &sn
+		}
+	}
+	if base == nil {
+		return queue.State{}, nil, fmt.Errorf("%w: %s", ErrNoSnapshotBefore, at.Format(time.RFC3339))
+	}
+
+	state, err := s.OpenState(ctx, *base)
+	if err != nil {
+		return queue.State{}, nil, err
+	}
+	r := newReplay(state)
+	steps := []Step{{Name: base.Name, Items: r.len()}}
+
+	segments, err := s.Segments(ctx)
+	if err != nil {
+		return queue.State{}, nil, err
+	}
+	for _, seg := range segments {
+		// Snapshot names are only precise to the second, so anything from
+		// that second is replayed, the operations are idempotent
+		if seg.End.Before(base.Time) || seg.Start.After(at) {
+			continue
+		}
+		ops, err := s.readSegment(ctx, seg)
+		if err != nil {
+			return queue.State{}, nil, err
+		}
+		replayed := 0
+		for _, op := range ops {
+			if op.Time.Before(base.Time) || op.Time.After(at) {
+				continue
+			}
+			if op.Type == opRestore {
+				restored := queue.State{}
+				if op.Body != "" {
+					sn, err := s.Find(ctx, op.Body)
+					if err != nil {
+						return queue.State{}, nil, err
+					}
+					if restored, err = s.OpenState(ctx, *sn); err != nil {
+						return queue.State{}, nil, err
+					}
+				}
+				r = newReplay(restored)
+			} else {
+				r.apply(op)
+			}
+			replayed++
+		}
+		steps = append(steps, Step{Name: seg.Name, Ops: replayed, Items: r.len()})
+	}
+
+	return r.state(), steps, nil
+}
+
+type replay struct {
+	seq       uint64
+	messages  map[uint64]queue.Message
+	dedup     map[string]int64
+	queues    map[string]*replay
+	topics    map[string]map[string]struct{}
+	bindings  map[string]queue.Binding
+	jobs      map[string]queue.Job
+	schedules map[string]queue.Schedule
+}
+
+func newReplay(state queue.State) *replay {
+	r := &replay{
+		seq:       state.Seq,
+		messages:  make(map[uint64]queue.Message, len(state.Messages)),
+		dedup:     make(map[string]int64, len(state.Dedup)),
+		queues:    make(map[string]*replay, len(state.Queues)),
+		topics:    make(map[string]map[string]struct{}, len(state.Topics)),
+		bindings:  make(map[string]queue.Binding, len(state.Bindings)),
+		jobs:      make(map[string]queue.Job, len(state.Jobs)),
+		schedules: make(map[string]queue.Schedule, len(state.Schedules)),
+	}
+	for _, s := range state.Schedules {
+		r.schedules[s.Name] = s
+	}
+	for _, job := range state.Jobs {
+		r.jobs[job.ID] = job
+	}
+	for _, b := range state.Bindings {
+		r.bindings[b.Name] = b
+	}
+	for topic, subscriptions := range state.Topics {
+		r.topics[topic] = map[string]struct{}{}
+		for _, subscription := range subscriptions {
+			r.topics[topic][subscription] = struct{}{}
+		}
+	}
+	for _, msg := range state.Messages {
+		r.messages[msg.Seq] = msg
+	}
+	for _, key := range state.Dedup {
+		r.dedup[key.Key] = key.Expires
+	}
+	for name, st := range state.Queues {
+		r.queues[name] = newReplay(st)
+	}
+	return r
+}
+
+func (r *replay) apply(op queue.Op) {
+	if op.Queue != "" {
+		named, ok := r.queues[op.Queue]
+		if !ok {
+			named = newReplay(queue.State{})
+			r.queues[op.Queue] = named
+		}
+		op.Queue = ""
+		named.apply(op)
+		return
+	}
+
+	switch op.Type {
+	case queue.OpPush:
+		// Pushes with a lower sequence number are already in the state
+		if op.Seq >= r.seq {
+			r.messages[op.Seq] = queue.Message{Seq: op.Seq, Body: op.Body, Expires: op.Expires, Group: op.Group, Headers: op.Headers}
+			r.seq = op.Seq + 1
+		}
+	case queue.OpRemove:
+		delete(r.messages, op.Seq)
+	case queue.OpDedup:
+		r.dedup[op.Body] = op.Expires
+	case queue.OpSubscribe:
+		if _, ok := r.topics[op.Topic]; !ok {
+			r.topics[op.Topic] = map[string]struct{}{}
+		}
+		r.topics[op.Topic][op.Body] = struct{}{}
+		if _, ok := r.queues[queue.SubscriptionQueue(op.Topic, op.Body)]; !ok {
+			r.queues[queue.SubscriptionQueue(op.Topic, op.Body)] = newReplay(queue.State{})
+		}
+	case queue.OpUnsubscribe:
+		delete(r.topics[op.Topic], op.Body)
+		if len(r.topics[op.Topic]) == 0 {
+			delete(r.topics, op.Topic)
+		}
+		delete(r.queues, queue.SubscriptionQueue(op.Topic, op.Body))
+	case queue.OpBind:
+		if op.Binding != nil {
+			r.bindings[op.Binding.Name] = *op.Binding
+		}
+	case queue.OpUnbind:
+		delete(r.bindings, op.Body)
+	case queue.OpSchedule:
+		if op.Schedule != nil {
+			r.schedules[op.Schedule.Name] = *op.Schedule
+		}
+	case queue.OpUnschedule:
+		delete(r.schedules, op.Body)
+	case queue.OpJob:
+		if op.Job != nil {
+			r.jobs[op.Job.ID] = *op.Job
+		}
+	case queue.OpDrain:
+		for seq := range r.messages {
+			if seq < op.Seq {
+				delete(r.messages, seq)
+			}
+		}
+		r.seq = max(r.seq, op.Seq)
+	}
+}
+
+func (r *replay) len() int {
+	return len(r.messages)
+}
+
+func (r *replay) state() queue.State {
+	out := queue.State{
+		Seq:      r.seq,
+		Messages: make([]queue.Message, 0, len(r.messages)),
+	}
+	for _, msg := range r.messages {
+		out.Messages = append(out.Messages, msg)
+	}
+	sort.Slice(out.Messages, func(i, j int) bool {
+		return out.Messages[i].Seq < out.Messages[j].Seq
+	})
+	for key, expires := range r.dedup {
+		out.Dedup = append(out.Dedup, queue.DedupKey{Key: key, Expires: expires})
+	}
+	sort.Slice(out.Dedup, func(i, j int) bool {
+		return out.Dedup[i].Expires < out.Dedup[j].Expires
+	})
+	for topic, subscriptions := range r.topics {
+		if out.Topics == nil {
+			out.Topics = map[string][]string{}
+		}
+		out.Topics[topic] = slices.Sorted(maps.Keys(subscriptions))
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.bindings)) {
+		out.Bindings = append(out.Bindings, r.bindings[name])
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.jobs)) {
+		out.Jobs = append(out.Jobs, r.jobs[id])
+	}
+	for _, name := range slices.Sorted(maps.Keys(r.schedules)) {
+		out.Schedules = append(out.Schedules, r.schedules[name])
+	}
+	for name, named := range r.queues {
+		if out.Queues == nil {
+			out.Queues = map[string]queue.State{}
+		}
+		out.Queues[name] = named.state()
+	}
+	return out
+}
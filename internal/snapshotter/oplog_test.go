@@ -0,0 +1,260 @@
+package snapshotter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func TestItRestoresToAPointInTime(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	q := queue.New()
+	snap := New(config.Snapshot{
+		Enabled:    true,
+		Schedule:   "* * * *",
+		NamePrefix: "bongo",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     2,
+		},
+	}, q, bucket, prometheus.NewRegistry())
+	q.SetJournal(snap)
+
+	_, _, err = snap.StateAt(ctx, time.Now())
+	require.ErrorIs(t, err, ErrNoSnapshotBefore)
+
+	q.Push("a")
+	q.Push("b")
+	q.Push("c")
+	require.Nil(t, snap.Snapshot(ctx))
+
+	time.Sleep(time.Second)
+	_, err = q.Pop()
+	require.Nil(t, err)
+	q.Push("d")
+	time.Sleep(time.Millisecond * 10)
+	mid := time.Now()
+	time.Sleep(time.Millisecond * 10)
+	q.Drain()
+	q.Push("e")
+	require.Nil(t, snap.Ship(ctx))
+
+	segments, err := snap.Segments(ctx)
+	require.Nil(t, err)
+	require.Len(t, segments, 4)
+
+	state, steps, err := snap.StateAt(ctx, mid)
+	require.Nil(t, err)
+	require.Equal(t, []queue.Message{{Seq: 1, Body: "b"}, {Seq: 2, Body: "c"}, {Seq: 3, Body: "d"}}, state.Messages)
+	require.Equal(t, 3, steps[0].Items)
+	require.Equal(t, 3, steps[len(steps)-1].Items)
+
+	state, _, err = snap.StateAt(ctx, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, q.State(), state)
+}
+
+func TestItReplaysRestoresFromTheLog(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	q := queue.New()
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     100,
+		},
+	}, q, bucket, prometheus.NewRegistry())
+	q.SetJournal(snap)
+
+	q.Push("a")
+	require.Nil(t, snap.Snapshot(ctx))
+	time.Sleep(time.Second)
+	q.Push("b")
+
+	// Simulate a restart that restored an empty queue
+	q.Restore(queue.State{})
+	snap.Restored(nil)
+	q.Push("c")
+	require.Nil(t, snap.Ship(ctx))
+
+	state, _, err := snap.StateAt(ctx, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, []queue.Message{{Seq: 2, Body: "c"}}, state.Messages)
+}
+
+func TestItReplaysNamedQueuesFromTheLog(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     100,
+		},
+	}, reg, bucket, prometheus.NewRegistry())
+	reg.SetJournal(snap)
+
+	require.Nil(t, reg.Default().Push("a"))
+	require.Nil(t, snap.Snapshot(ctx))
+	time.Sleep(time.Second)
+
+	other, err := reg.Get("other")
+	require.Nil(t, err)
+	require.Nil(t, other.PushWith(ctx, "b", queue.PushOptions{TTL: time.Hour}))
+	require.Nil(t, snap.Ship(ctx))
+
+	state, _, err := snap.StateAt(ctx, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, reg.State(), state)
+	require.NotZero(t, state.Queues["other"].Messages[0].Expires)
+}
+
+func TestItImportsTheWholeStateAtAPointInTime(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     100,
+		},
+	}, reg, bucket, prometheus.NewRegistry())
+	reg.SetJournal(snap)
+
+	headers := map[string]string{"traceparent": "00-abc"}
+	require.Nil(t, reg.Default().PushWith(ctx, "a", queue.PushOptions{Group: "orders", Headers: headers}))
+	require.Nil(t, snap.Snapshot(ctx))
+	time.Sleep(time.Second)
+
+	other, err := reg.Get("other")
+	require.Nil(t, err)
+	require.Nil(t, other.PushWith(ctx, "b", queue.PushOptions{Group: "emails", Headers: headers}))
+	require.Nil(t, snap.Ship(ctx))
+
+	state, _, err := snap.StateAt(ctx, time.Now())
+	require.Nil(t, err)
+	imported, err := snap.ImportState(ctx, state)
+	require.Nil(t, err)
+
+	restored, err := snap.OpenState(ctx, *imported)
+	require.Nil(t, err)
+	require.Equal(t, reg.State(), restored)
+	require.Equal(t, "orders", restored.Messages[0].Group)
+	require.Equal(t, headers, restored.Messages[0].Headers)
+	require.Equal(t, "emails", restored.Queues["other"].Messages[0].Group)
+	require.Equal(t, headers, restored.Queues["other"].Messages[0].Headers)
+}
+
+func TestItReplaysSubscriptionsFromTheLog(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	reg := queue.NewRegistry()
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     100,
+		},
+	}, reg, bucket, prometheus.NewRegistry())
+	reg.SetJournal(snap)
+
+	_, err = reg.Subscribe("orders", "billing")
+	require.Nil(t, err)
+	require.Nil(t, snap.Snapshot(ctx))
+	time.Sleep(time.Second)
+
+	_, err = reg.Subscribe("orders", "shipping")
+	require.Nil(t, err)
+	_, err = reg.Publish(ctx, "orders", "apple", queue.PushOptions{})
+	require.Nil(t, err)
+	require.Nil(t, reg.Unsubscribe("orders", "billing"))
+	require.Nil(t, reg.Bind(queue.Binding{Name: "all", Match: queue.MatchPrefix, Key: "ord", Queues: []string{"audit"}}))
+	require.Nil(t, snap.Ship(ctx))
+
+	state, _, err := snap.StateAt(ctx, time.Now())
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{"orders": {"shipping"}}, state.Topics)
+	require.Equal(t, reg.Bindings(), state.Bindings)
+	require.Equal(t, reg.State().Queues, state.Queues)
+}
+
+type failingBucket struct {
+	objstore.Bucket
+}
+
+func (failingBucket) Upload(context.Context, string, io.Reader) error {
+	return errors.New("upload failed")
+}
+
+func TestItDropsTheOldestSegmentsThatFailToShip(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	q := queue.New()
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+		Log: config.Log{
+			Enabled:         true,
+			SegmentDuration: time.Minute,
+			SegmentSize:     1,
+			MaxSealed:       2,
+		},
+	}, q, failingBucket{bucket}, prometheus.NewRegistry())
+	q.SetJournal(snap)
+
+	for _, body := range []string{"a", "b", "c", "d", "e"} {
+		require.Nil(t, q.Push(body))
+	}
+	require.Error(t, snap.Ship(ctx))
+
+	require.Len(t, snap.log.sealed, 2)
+	require.Equal(t, "d", snap.log.sealed[0][0].Body)
+	require.Equal(t, float64(3), testutil.ToFloat64(snap.log.dropped))
+}
@@ -0,0 +1,140 @@
+package snapshotter
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+)
+
+func TestItResolvesThePinnedSnapshot(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:       true,
+		Schedule:      "* * * *",
+		RetentionDays: 1,
+		NamePrefix:    "bongo",
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	twoHours := snap.name(time.Now().Add(-(time.Hour * 2)))
+	hour := snap.name(time.Now().Add(-time.Hour))
+	require.Nil(t, bucket.Upload(ctx, twoHours, bytes.NewReader([]byte(`["hello"]`))))
+	require.Nil(t, bucket.Upload(ctx, hour, bytes.NewReader([]byte(`["goodbye"]`))))
+
+	resolved, err := snap.Resolve(ctx)
+	require.Nil(t, err)
+	require.Equal(t, hour, resolved.Name)
+
+	pinned, err := snap.Find(ctx, twoHours)
+	require.Nil(t, err)
+	require.Nil(t, snap.Pin(ctx, *pinned))
+
+	// The pin file should not be picked up as a snapshot
+	snaps, err := snap.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 2)
+	require.Equal(t, twoHours, snaps[0].Name)
+
+	resolved, err = snap.Resolve(ctx)
+	require.Nil(t, err)
+	require.Equal(t, twoHours, resolved.Name)
+
+	require.Nil(t, snap.Unpin(ctx))
+	resolved, err = snap.Resolve(ctx)
+	require.Nil(t, err)
+	require.Equal(t, hour, resolved.Name)
+}
+
+func TestItDoesNotPruneThePinnedSnapshot(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:       true,
+		Schedule:      "* * * *",
+		RetentionDays: 1,
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	twoDays := snap.name(time.Now().Add(-(time.Hour * 48)))
+	require.Nil(t, bucket.Upload(ctx, twoDays, bytes.NewReader([]byte(`["hello"]`))))
+	pinned, err := snap.Find(ctx, twoDays)
+	require.Nil(t, err)
+	require.Nil(t, snap.Pin(ctx, *pinned))
+
+	require.Nil(t, snap.prune(ctx))
+
+	snaps, err := snap.List(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 1)
+}
+
+func TestItIgnoresAPinOfADeletedSnapshot(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:       true,
+		Schedule:      "* * * *",
+		RetentionDays: 1,
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	hour := snap.name(time.Now().Add(-time.Hour))
+	require.Nil(t, bucket.Upload(ctx, hour, bytes.NewReader([]byte(`["hello"]`))))
+	require.Nil(t, snap.Pin(ctx, Snapshot{Name: snap.name(time.Now().Add(-time.Hour * 2))}))
+
+	resolved, err := snap.Resolve(ctx)
+	require.Nil(t, err)
+	require.Equal(t, hour, resolved.Name)
+
+	// Reading the pin leaves it alone, the dangling pin is removed by prune
+	pinned, err := snap.Pinned(ctx)
+	require.Nil(t, err)
+	require.Nil(t, pinned)
+	exists, err := bucket.Exists(ctx, snap.prefixed(pinName))
+	require.Nil(t, err)
+	require.True(t, exists)
+
+	require.Nil(t, snap.prune(ctx))
+	exists, err = bucket.Exists(ctx, snap.prefixed(pinName))
+	require.Nil(t, err)
+	require.False(t, exists)
+}
+
+func TestItImportsSnapshots(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:  true,
+		Schedule: "* * * *",
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	imported, err := snap.Import(ctx, []string{"hello", "goodbye"})
+	require.Nil(t, err)
+
+	found, err := snap.Find(ctx, imported.Name)
+	require.Nil(t, err)
+	state, err := snap.Open(ctx, *found)
+	require.Nil(t, err)
+	require.Equal(t, []string{"hello", "goodbye"}, state)
+}
@@ -81,3 +81,166 @@ func TestItPrunesSnapshotsWithNamePrefix(t *testing.T) {
 	require.NotNil(t, latest)
 	require.Equal(t, hour, latest.Name)
 }
+
+func TestItKeepsTheLatestSnapshotWithNoRetentionDays(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:       true,
+		Schedule:      "* * * *",
+		RetentionDays: 0,
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	twoHours := snap.name(time.Now().Add(-(time.Hour * 2)))
+	now := snap.name(time.Now())
+	require.Nil(t, bucket.Upload(ctx, twoHours, bytes.NewReader([]byte("hello"))))
+	require.Nil(t, bucket.Upload(ctx, now, bytes.NewReader([]byte("goodbye"))))
+
+	require.Nil(t, snap.prune(ctx))
+
+	snaps, err := snap.collect(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 1)
+	require.Equal(t, now, snaps[0].Name)
+}
+
+func TestItDoesNotPruneSnapshotsInDryRun(t *testing.T) {
+	bucket, err := filesystem.NewBucket(t.TempDir())
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	snap := New(config.Snapshot{
+		Enabled:       true,
+		Schedule:      "* * * *",
+		RetentionDays: 1,
+		Retention: config.Retention{
+			DryRun: true,
+		},
+	}, queue.New(), bucket, prometheus.NewRegistry())
+
+	twoDays := snap.name(time.Now().Add(-(time.Hour * 48)))
+	hour := snap.name(time.Now().Add(-time.Hour))
+	require.Nil(t, bucket.Upload(ctx, twoDays, bytes.NewReader([]byte("hello"))))
+	require.Nil(t, bucket.Upload(ctx, hour, bytes.NewReader([]byte("goodbye"))))
+
+	require.Nil(t, snap.prune(ctx))
+
+	snaps, err := snap.collect(ctx)
+	require.Nil(t, err)
+	require.Len(t, snaps, 2)
+}
+
+func TestItRetainsTieredSnapshots(t *testing.T) {
+	// A monday, so the weekly periods line up with the days
+	now := time.Date(2024, 11, 18, 12, 30, 0, 0, time.UTC)
+
+	// A snapshot every hour for the last 3 weeks
+	snapshots := []Snapshot{}
+	for i := range 24 * 21 {
+		at := now.Add(-(time.Hour * time.Duration(i)))
+		snapshots = append(snapshots, Snapshot{
+			Time: at,
+			Name: at.Format(time.RFC3339),
+		})
+	}
+
+	type testCase struct {
+		name      string
+		retention config.Retention
+		days      uint
+		expected  []time.Time
+	}
+
+	tcs := []testCase{
+		{
+			name:      "keeps the latest snapshot when nothing else is configured",
+			retention: config.Retention{},
+			expected:  []time.Time{now},
+		},
+		{
+			name:      "keeps the latest k snapshots",
+			retention: config.Retention{KeepLatest: 3},
+			expected:  []time.Time{now, now.Add(-time.Hour), now.Add(-time.Hour * 2)},
+		},
+		{
+			name:      "keeps hourly snapshots",
+			retention: config.Retention{Hourly: 2},
+			expected:  []time.Time{now, now.Add(-time.Hour)},
+		},
+		{
+			name:      "keeps daily snapshots",
+			retention: config.Retention{Daily: 3},
+			expected: []time.Time{
+				now,
+				time.Date(2024, 11, 17, 23, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 16, 23, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:      "keeps weekly snapshots",
+			retention: config.Retention{Weekly: 3},
+			expected: []time.Time{
+				now,
+				time.Date(2024, 11, 17, 23, 30, 0, 0, time.UTC),
+				time.Date(2024, 11, 10, 23, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:      "combines the tiers",
+			retention: config.Retention{KeepLatest: 2, Hourly: 3, Daily: 2},
+			expected: []time.Time{
+				now,
+				now.Add(-time.Hour),
+				now.Add(-time.Hour * 2),
+				time.Date(2024, 11, 17, 23, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:      "keeps snapshots inside the retention days",
+			retention: config.Retention{Weekly: 1},
+			days:      1,
+			expected: func() []time.Time {
+				out := []time.Time{}
+				for i := range 25 {
+					out = append(out, now.Add(-(time.Hour * time.Duration(i))))
+				}
+				return out
+			}(),
+		},
+	}
+
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			kept, pruned := retain(config.Snapshot{
+				RetentionDays: c.days,
+				Retention:     c.retention,
+			}, snapshots, nil, now)
+
+			times := []time.Time{}
+			for _, sn := range kept {
+				times = append(times, sn.Time)
+			}
+			require.Equal(t, c.expected, times)
+			require.Len(t, pruned, len(snapshots)-len(kept))
+		})
+	}
+}
+
+func TestItKeepsTheSnapshotsAPinnedDeltaDependsOn(t *testing.T) {
+	now := time.Now()
+	full := Snapshot{Name: "full", Time: now.Add(-time.Hour * 6)}
+	first := Snapshot{Name: "first", Time: now.Add(-time.Hour * 5), Base: "full"}
+	pinned := Snapshot{Name: "pinned", Time: now.Add(-time.Hour * 4), Base: "full"}
+	later := Snapshot{Name: "later", Time: now.Add(-time.Hour * 3), Base: "full"}
+	latest := Snapshot{Name: "latest", Time: now.Add(-time.Hour)}
+
+	kept, pruned := retain(config.Snapshot{}, []Snapshot{full, first, pinned, later, latest}, &pinned, now)
+	require.Equal(t, []Snapshot{latest, pinned, first, full}, kept)
+	require.Equal(t, []Snapshot{later}, pruned)
+}
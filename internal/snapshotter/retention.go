@@ -0,0 +1,103 @@
+package snapshotter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/config"
+)
+
+type tier struct {
+	count  uint
+	period func(time.Time) string
+}
+
+// Splits the snapshots into the ones that should be kept and the ones that
+// should be pruned. A snapshot is kept when it is one of the latest snapshots,
+// the most recent snapshot in one of the hourly/daily/weekly periods, is
+// younger than the retention days, is pinned or a kept delta depends on it.
+func retain(conf config.Snapshot, snapshots []Snapshot, pinned *Snapshot, now time.Time) ([]Snapshot, []Snapshot) {
+	sorted := make([]Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Time.After(sorted[j].Time)
+	})
+
+	keep := map[string]struct{}{}
+
+	latest := max(conf.Retention.KeepLatest, 1)
+	for i := 0; i < len(sorted) && uint(i) < latest; i++ {
+		keep[sorted[i].Name] = struct{}{}
+	}
+
+	tiers := []tier{
+		{count: conf.Retention.Hourly, period: hourly},
+		{count: conf.Retention.Daily, period: daily},
+		{count: conf.Retention.Weekly, period: weekly},
+	}
+	for _, t := range tiers {
+		seen := map[string]struct{}{}
+		for _, sn := range sorted {
+			if uint(len(seen)) >= t.count {
+				break
+			}
+			period := t.period(sn.Time)
+			if _, ok := seen[period]; ok {
+				continue
+			}
+			seen[period] = struct{}{}
+			keep[sn.Name] = struct{}{}
+		}
+	}
+
+	if conf.RetentionDays > 0 {
+		oldest := now.Add(-(time.Duration(conf.RetentionDays) * (time.Hour * 24)))
+		for _, sn := range sorted {
+			if !sn.Time.Before(oldest) {
+				keep[sn.Name] = struct{}{}
+			}
+		}
+	}
+
+	if pinned != nil {
+		keep[pinned.Name] = struct{}{}
+	}
+
+	// Deltas can only be restored with their full snapshot and the deltas
+	// that came before them
+	for _, sn := range sorted {
+		if _, ok := keep[sn.Name]; !ok || !sn.IsDelta() {
+			continue
+		}
+		keep[sn.Base] = struct{}{}
+		for _, prev := range sorted {
+			if prev.Base == sn.Base && prev.Time.Before(sn.Time) {
+				keep[prev.Name] = struct{}{}
+			}
+		}
+	}
+
+	kept, pruned := []Snapshot{}, []Snapshot{}
+	for _, sn := range sorted {
+		if _, ok := keep[sn.Name]; ok {
+			kept = append(kept, sn)
+		} else {
+			pruned = append(pruned, sn)
+		}
+	}
+	return kept, pruned
+}
+
+func hourly(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15")
+}
+
+func daily(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+func weekly(t time.Time) string {
+	year, week := t.UTC().ISOWeek()
+	return fmt.Sprintf("%d-%d", year, week)
+}
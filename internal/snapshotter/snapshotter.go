@@ -4,20 +4,41 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
 	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/queue"
 	"github.com/orderly-queue/orderly/pkg/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/objstore"
 )
 
+var (
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrNotRestored      = errors.New("queue has not been restored from the latest snapshot")
+)
+
+const (
+	pinName   = "pinned"
+	leaseName = "lease"
+
+	fullSuffix  = ".state"
+	deltaSuffix = ".delta"
+
+	version = 2
+)
+
 type store interface {
-	Snapshot() []string
+	State() queue.State
+	Restore(queue.State)
 }
 
 type Snapshotter struct {
@@ -28,6 +49,20 @@ type Snapshotter struct {
 	age    *snapshotAge
 	size   *snapshotSize
 	latest prometheus.Gauge
+
+	lease     *Lease
+	leaseHeld prometheus.Gauge
+
+	// Set once the queue has been restored, a standby's queue is only
+	// restored when it takes over the lease
+	restored *atomic.Bool
+	// Called after a standby takes over the lease and restores the queue
+	promoted []func(context.Context)
+
+	mu    *sync.Mutex
+	chain *chain
+
+	log *oplog
 }
 
 func New(conf config.Snapshot, queue store, bucket objstore.Bucket, reg prometheus.Registerer) *Snapshotter {
@@ -37,22 +72,52 @@ func New(conf config.Snapshot, queue store, bucket objstore.Bucket, reg promethe
 		Name: "orderly_latest_snapshot_ages_seconds",
 		Help: "The number of seconds since the last snapshot",
 	})
+	leaseHeld := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "orderly_snapshot_lease_held",
+		Help: "Whether this instance holds the snapshot lease",
+	})
 	reg.MustRegister(age)
 	reg.MustRegister(size)
 	reg.MustRegister(latest)
-	return &Snapshotter{
-		conf:   conf,
-		bucket: bucket,
-		queue:  queue,
-		age:    age,
-		size:   size,
-		latest: latest,
+	dropped := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orderly_snapshot_log_segments_dropped_total",
+		Help: "The number of log segments dropped as too many failed to ship",
+	})
+	reg.MustRegister(leaseHeld)
+	reg.MustRegister(dropped)
+	s := &Snapshotter{
+		conf:      conf,
+		bucket:    bucket,
+		queue:     queue,
+		age:       age,
+		size:      size,
+		latest:    latest,
+		leaseHeld: leaseHeld,
+		restored:  &atomic.Bool{},
+		mu:        &sync.Mutex{},
+		log:       newOplog(conf.Log.MaxSealed, dropped),
 	}
+	if conf.Lease.Enabled {
+		s.lease = NewLease(bucket, s.prefixed(leaseName), conf.Lease.TTL)
+	}
+	return s
 }
 
 func (s *Snapshotter) Work(ctx context.Context) error {
 	logger := logger.Logger(ctx)
-	logger.Infow("starting snapshotter", "schedule", s.conf.Schedule, "retention_days", s.conf.RetentionDays)
+	logger.Infow(
+		"starting snapshotter",
+		"schedule", s.conf.Schedule,
+		"retention_days", s.conf.RetentionDays,
+		"keep_latest", s.conf.Retention.KeepLatest,
+		"hourly", s.conf.Retention.Hourly,
+		"daily", s.conf.Retention.Daily,
+		"weekly", s.conf.Retention.Weekly,
+		"dry_run", s.conf.Retention.DryRun,
+		"lease", s.conf.Lease.Enabled,
+		"deltas", s.conf.Deltas.Enabled,
+		"log", s.conf.Log.Enabled,
+	)
 
 	sched, err := gocron.NewScheduler()
 	if err != nil {
@@ -66,6 +131,24 @@ func (s *Snapshotter) Work(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if s.conf.Log.Enabled {
+		_, err = sched.NewJob(
+			gocron.DurationJob(s.conf.Log.SegmentDuration),
+			gocron.NewTask(s.Ship, ctx),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if s.lease != nil {
+		_, err = sched.NewJob(
+			gocron.DurationJob(s.conf.Lease.TTL/3),
+			gocron.NewTask(s.renew, ctx),
+		)
+		if err != nil {
+			return err
+		}
+	}
 	_, err = sched.NewJob(
 		gocron.CronJob("* * * * *", false),
 		gocron.NewTask(s.report, ctx),
@@ -90,25 +173,232 @@ func (s *Snapshotter) Work(ctx context.Context) error {
 	return nil
 }
 
+// Tries to acquire the snapshot lease when it is enabled. When another
+// instance holds the lease, ErrLeaseHeld is returned unless the instance is
+// configured as a standby.
+func (s *Snapshotter) Acquire(ctx context.Context) error {
+	if s.lease == nil {
+		return nil
+	}
+	logger := logger.Logger(ctx)
+	err := s.lease.Acquire(ctx)
+	s.recordLease()
+	if err != nil {
+		if errors.Is(err, ErrLeaseHeld) && s.conf.Lease.Standby {
+			logger.Infow("snapshot lease is held by another instance, starting as standby", "error", err)
+			return nil
+		}
+		return err
+	}
+	logger.Infow("acquired snapshot lease", "holder", s.lease.Holder(), "token", s.lease.Token())
+	return nil
+}
+
+// Releases the snapshot lease so a standby can take over
+func (s *Snapshotter) Release(ctx context.Context) error {
+	if s.lease == nil || !s.lease.Held() {
+		return nil
+	}
+	defer s.recordLease()
+	return s.lease.Release(ctx)
+}
+
+// Whether this instance should restore and take snapshots, always true when
+// the lease is disabled
+func (s *Snapshotter) Leader() bool {
+	return s.lease == nil || s.lease.Held()
+}
+
+func (s *Snapshotter) renew(ctx context.Context) error {
+	logger := logger.Logger(ctx)
+	held := s.lease.Held()
+	err := s.lease.Acquire(ctx)
+	s.recordLease()
+	if err != nil {
+		if held {
+			logger.Errorw("lost snapshot lease", "error", err)
+		}
+		if errors.Is(err, ErrLeaseHeld) {
+			// Another instance took over, its snapshots are restored if the
+			// lease is taken back
+			s.restored.Store(false)
+			return nil
+		}
+		return err
+	}
+	if !held {
+		logger.Infow("acquired snapshot lease", "holder", s.lease.Holder(), "token", s.lease.Token())
+	}
+	if !s.restored.Load() {
+		return s.promote(ctx)
+	}
+	return nil
+}
+
+// Restores the queue after taking over the lease, so the standby's own state
+// is never snapshotted over the leader's. A failed restore is retried on the
+// next renewal.
+func (s *Snapshotter) promote(ctx context.Context) error {
+	if err := s.Restore(ctx); err != nil {
+		logger.Logger(ctx).Errorw("failed to restore snapshot after taking over the lease", "error", err)
+		return err
+	}
+	for _, fn := range s.promoted {
+		fn(ctx)
+	}
+	return nil
+}
+
+// Registers a func called after a standby takes over the lease and restores
+// the queue, it must be called before Work
+func (s *Snapshotter) OnPromote(fn func(context.Context)) {
+	s.promoted = append(s.promoted, fn)
+}
+
+// Restores the pinned or latest snapshot into the queue and unpins it, a
+// pinned snapshot is only restored once
+func (s *Snapshotter) Restore(ctx context.Context) error {
+	snapshot, err := s.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		state, err := s.OpenState(ctx, *snapshot)
+		if err != nil {
+			return err
+		}
+		s.queue.Restore(state)
+	}
+	s.Restored(snapshot)
+	if err := s.Unpin(ctx); err != nil {
+		return err
+	}
+	s.restored.Store(true)
+	return nil
+}
+
+// Whether the queue can be written to and snapshotted. It is false on a
+// standby until it takes over the lease and restores the queue, as anything
+// written before then would be lost to the restore.
+func (s *Snapshotter) Writable() bool {
+	return !s.conf.Enabled || s.lease == nil || s.restored.Load()
+}
+
+func (s *Snapshotter) recordLease() {
+	if s.Leader() {
+		s.leaseHeld.Set(1)
+	} else {
+		s.leaseHeld.Set(0)
+	}
+}
+
 func (s *Snapshotter) Snapshot(ctx context.Context) error {
 	logger := logger.Logger(ctx)
+	if s.lease != nil {
+		if err := s.lease.Verify(ctx); err != nil {
+			logger.Debugw("skipping snapshot as the lease is not held", "error", err)
+			return err
+		}
+	}
+	if !s.Writable() {
+		logger.Warnw("skipping snapshot as the queue has not been restored")
+		return ErrNotRestored
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.queue.State()
+	now := time.Now()
+
+	if s.conf.Deltas.Enabled && s.chain != nil && s.chain.deltas < s.conf.Deltas.FullEvery {
+		logger.Infow("taking delta snapshot of queue", "base", s.chain.base.Name)
+		if _, err := s.uploadDelta(ctx, s.chain.diff(state), now); err != nil {
+			return err
+		}
+		s.chain.deltas++
+		s.chain.advance(state)
+		return nil
+	}
+
 	logger.Infow("snapshotting queue")
-	data := s.queue.Snapshot()
-	name := s.name(time.Now())
+	snapshot, err := s.upload(ctx, state, now)
+	if err != nil {
+		return err
+	}
+	s.chain = newChain(*snapshot, state)
+	return nil
+}
+
+// Uploads the data as a new snapshot, used to import snapshots that were
+// exported or generated elsewhere
+func (s *Snapshotter) Import(ctx context.Context, data []string) (*Snapshot, error) {
+	return s.upload(ctx, stateOf(data), time.Now())
+}
+
+// Uploads the state as a new snapshot, used to import a state rebuilt from
+// the log
+func (s *Snapshotter) ImportState(ctx context.Context, state queue.State) (*Snapshot, error) {
+	return s.upload(ctx, state, time.Now())
+}
+
+type fullState struct {
+	Version int `json:"version"`
+	queue.State
+}
+
+func (s *Snapshotter) upload(ctx context.Context, state queue.State, t time.Time) (*Snapshot, error) {
+	name := s.name(t)
+	size, err := s.write(ctx, name, fullState{Version: version, State: state})
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Time: t,
+		Name: name,
+		Size: size,
+	}, nil
+}
+
+func (s *Snapshotter) uploadDelta(ctx context.Context, d delta, t time.Time) (*Snapshot, error) {
+	name := s.deltaName(t, s.chain.base.Time)
+	size, err := s.write(ctx, name, d)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Time: t,
+		Name: name,
+		Size: size,
+		Base: d.Base,
+	}, nil
+}
+
+func (s *Snapshotter) write(ctx context.Context, name string, data any) (int64, error) {
+	logger := logger.Logger(ctx)
 	by, err := json.Marshal(data)
 	if err != nil {
 		logger.Errorw("failed to marshall snapshot", "error", err)
-		return err
+		return 0, err
 	}
 	if err := s.bucket.Upload(ctx, name, bytes.NewReader(by)); err != nil {
 		logger.Errorw("failed to upload snapshot", "error", err)
-		return err
+		return 0, err
 	}
-	return nil
+	return int64(len(by)), nil
 }
 
 func (s *Snapshotter) name(t time.Time) string {
-	name := fmt.Sprintf("%s.state", t.Format(time.RFC3339))
+	return s.prefixed(fmt.Sprintf("%s%s", t.Format(time.RFC3339), fullSuffix))
+}
+
+// Deltas are named with their own time and the time of the full snapshot they
+// are based on
+func (s *Snapshotter) deltaName(t time.Time, base time.Time) string {
+	return s.prefixed(fmt.Sprintf("%s.%s%s", t.Format(time.RFC3339), base.Format(time.RFC3339), deltaSuffix))
+}
+
+func (s *Snapshotter) prefixed(name string) string {
 	if s.conf.NamePrefix != "" {
 		name = fmt.Sprintf("%s/%s", s.conf.NamePrefix, name)
 	}
@@ -117,6 +407,10 @@ func (s *Snapshotter) name(t time.Time) string {
 
 func (s *Snapshotter) prune(ctx context.Context) error {
 	logger := logger.Logger(ctx)
+	if !s.Leader() {
+		logger.Debug("skipping pruning as the lease is not held")
+		return nil
+	}
 	logger.Debug("pruning snapshots")
 
 	snapshots, err := s.collect(ctx)
@@ -125,22 +419,48 @@ func (s *Snapshotter) prune(ctx context.Context) error {
 		return err
 	}
 
-	oldest := time.Now().Add(-(time.Duration(s.conf.RetentionDays) * (time.Hour * 24)))
+	pin, pinned, err := s.pinned(ctx)
+	if err != nil {
+		logger.Errorw("failed to get pinned snapshot", "error", err)
+		return err
+	}
+	if pin != "" && pinned == nil && !s.conf.Retention.DryRun {
+		logger.Warnw("pinned snapshot no longer exists, unpinning", "snapshot", pin)
+		if err := s.Unpin(ctx); err != nil {
+			logger.Errorw("failed to unpin snapshot", "snapshot", pin, "error", err)
+			return err
+		}
+	}
+
+	kept, expired := retain(s.conf, snapshots, pinned, time.Now())
 	deleted := 0
-	for _, sn := range snapshots {
-		if sn.Time.Before(oldest) {
-			if err := s.bucket.Delete(ctx, sn.Name); err != nil {
-				logger.Errorw("failed to delete snapshot", "snapshot", sn.Name, "error", err)
-				continue
-			}
-			deleted++
+	for _, sn := range expired {
+		if s.conf.Retention.DryRun {
+			logger.Infow("would prune snapshot", "snapshot", sn.Name, "dry_run", true)
+			continue
+		}
+		if err := s.bucket.Delete(ctx, sn.Name); err != nil {
+			logger.Errorw("failed to delete snapshot", "snapshot", sn.Name, "error", err)
+			continue
 		}
+		deleted++
 	}
 
 	if deleted > 0 {
 		logger.Infow("pruned snapshots", "count", deleted)
 	}
 
+	if s.conf.Log.Enabled && len(kept) > 0 {
+		oldest := kept[len(kept)-1].Time
+		if pinned != nil && pinned.Time.Before(oldest) {
+			oldest = pinned.Time
+		}
+		if err := s.pruneSegments(ctx, oldest); err != nil {
+			logger.Errorw("failed to prune log segments", "error", err)
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -196,29 +516,207 @@ func (s *Snapshotter) Latest(ctx context.Context, snapshots ...Snapshot) (*Snaps
 	return &l, nil
 }
 
+// Returns the items in the snapshot
 func (s *Snapshotter) Open(ctx context.Context, snapshot Snapshot) ([]string, error) {
+	state, err := s.OpenState(ctx, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(state.Messages))
+	for _, msg := range state.Messages {
+		out = append(out, msg.Body)
+	}
+	return out, nil
+}
+
+// Returns the state of the queue at the time of the snapshot, delta snapshots
+// are applied on top of the full snapshot they are based on
+func (s *Snapshotter) OpenState(ctx context.Context, snapshot Snapshot) (queue.State, error) {
 	logger := logger.Logger(ctx)
 	logger.Infow("opening snapshot", "name", snapshot.Name)
 
-	raw, err := s.bucket.Get(ctx, snapshot.Name)
+	if !snapshot.IsDelta() {
+		return s.readFull(ctx, snapshot.Name)
+	}
+
+	state, err := s.readFull(ctx, snapshot.Base)
 	if err != nil {
-		return nil, err
+		return queue.State{}, err
 	}
-	by, err := io.ReadAll(raw)
+	deltas, err := s.deltas(ctx, snapshot)
+	if err != nil {
+		return queue.State{}, err
+	}
+	for _, sn := range deltas {
+		d := delta{}
+		if err := s.read(ctx, sn.Name, &d); err != nil {
+			return queue.State{}, err
+		}
+		state = d.apply(state)
+	}
+	return state, nil
+}
+
+// Returns the deltas in the chain up to and including the snapshot
+func (s *Snapshotter) deltas(ctx context.Context, snapshot Snapshot) ([]Snapshot, error) {
+	snapshots, err := s.List(ctx)
 	if err != nil {
 		return nil, err
 	}
-	out := []string{}
+	out := []Snapshot{}
+	for _, sn := range snapshots {
+		if sn.Base == snapshot.Base && !sn.Time.After(snapshot.Time) {
+			out = append(out, sn)
+		}
+	}
+	return out, nil
+}
+
+func (s *Snapshotter) readFull(ctx context.Context, name string) (queue.State, error) {
+	by, err := s.get(ctx, name)
+	if err != nil {
+		return queue.State{}, err
+	}
+	// Snapshots used to be a plain list of items
+	if trimmed := bytes.TrimSpace(by); len(trimmed) > 0 && trimmed[0] == '[' {
+		items := []string{}
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return queue.State{}, err
+		}
+		return stateOf(items), nil
+	}
+	out := fullState{}
 	if err := json.Unmarshal(by, &out); err != nil {
+		return queue.State{}, err
+	}
+	return out.State, nil
+}
+
+func (s *Snapshotter) read(ctx context.Context, name string, out any) error {
+	by, err := s.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(by, out)
+}
+
+func (s *Snapshotter) get(ctx context.Context, name string) ([]byte, error) {
+	raw, err := s.bucket.Get(ctx, name)
+	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	defer raw.Close()
+	return io.ReadAll(raw)
+}
+
+func stateOf(items []string) queue.State {
+	state := queue.State{
+		Messages: make([]queue.Message, 0, len(items)),
+	}
+	for _, item := range items {
+		if item == "" {
+			continue
+		}
+		state.Messages = append(state.Messages, queue.Message{Seq: state.Seq, Body: item})
+		state.Seq++
+	}
+	return state
+}
+
+// Returns all the snapshots in the bucket, ordered from oldest to newest
+func (s *Snapshotter) List(ctx context.Context) ([]Snapshot, error) {
+	snapshots, err := s.collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Finds a snapshot by name, the name can be given with or without the
+// configured name prefix
+func (s *Snapshotter) Find(ctx context.Context, name string) (*Snapshot, error) {
+	snapshots, err := s.collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sn := range snapshots {
+		if sn.Name == name || sn.Name == s.prefixed(name) {
+			return &sn, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+}
+
+// Pins the snapshot so it is restored on the next start instead of the latest
+func (s *Snapshotter) Pin(ctx context.Context, snapshot Snapshot) error {
+	return s.bucket.Upload(ctx, s.prefixed(pinName), strings.NewReader(snapshot.Name))
+}
+
+// Returns the currently pinned snapshot, or nil when nothing is pinned. A pin
+// of a snapshot that has since been deleted is treated as unpinned, it is
+// removed by the next prune.
+func (s *Snapshotter) Pinned(ctx context.Context) (*Snapshot, error) {
+	_, snapshot, err := s.pinned(ctx)
+	return snapshot, err
+}
+
+// Returns the name in the pin and the snapshot it names, the snapshot is nil
+// when it no longer exists and the name is empty when nothing is pinned
+func (s *Snapshotter) pinned(ctx context.Context) (string, *Snapshot, error) {
+	raw, err := s.bucket.Get(ctx, s.prefixed(pinName))
+	if err != nil {
+		if s.bucket.IsObjNotFoundErr(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+	defer raw.Close()
+	by, err := io.ReadAll(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	snapshot, err := s.Find(ctx, string(by))
+	if errors.Is(err, ErrSnapshotNotFound) {
+		return string(by), nil, nil
+	}
+	return string(by), snapshot, err
+}
+
+func (s *Snapshotter) Unpin(ctx context.Context) error {
+	if err := s.bucket.Delete(ctx, s.prefixed(pinName)); err != nil && !s.bucket.IsObjNotFoundErr(err) {
+		return err
+	}
+	return nil
+}
+
+// Returns the snapshot that should be restored on start, the pinned snapshot
+// takes precedence over the latest one
+func (s *Snapshotter) Resolve(ctx context.Context) (*Snapshot, error) {
+	pinned, err := s.Pinned(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pinned != nil {
+		return pinned, nil
+	}
+	return s.Latest(ctx)
 }
 
 type Snapshot struct {
 	Time time.Time
 	Name string
 	Size int64
+
+	// The name of the full snapshot a delta snapshot is based on, empty for
+	// full snapshots
+	Base string
+}
+
+func (s Snapshot) IsDelta() bool {
+	return s.Base != ""
 }
 
 func (s Snapshot) Age() time.Duration {
@@ -235,6 +733,9 @@ func (s *Snapshotter) collect(ctx context.Context) ([]Snapshot, error) {
 	}
 
 	if err := s.bucket.Iter(ctx, prefix, func(name string) error {
+		if !strings.HasSuffix(name, fullSuffix) && !strings.HasSuffix(name, deltaSuffix) {
+			return nil
+		}
 		info, err := s.bucket.Attributes(ctx, name)
 		if err != nil {
 			logger.Errorw("failed to stat snapshot", "name", name, "error", err)
@@ -245,11 +746,17 @@ func (s *Snapshotter) collect(ctx context.Context) ([]Snapshot, error) {
 			logger.Errorw("failed to parse snapshot name", "name", name, "error", err)
 			return nil
 		}
+		base, err := s.parseBase(name)
+		if err != nil {
+			logger.Errorw("failed to parse snapshot name", "name", name, "error", err)
+			return nil
+		}
 
 		out = append(out, Snapshot{
 			Time: t,
 			Name: name,
 			Size: info.Size,
+			Base: base,
 		})
 		return nil
 	}); err != nil {
@@ -260,10 +767,36 @@ func (s *Snapshotter) collect(ctx context.Context) ([]Snapshot, error) {
 }
 
 func (s *Snapshotter) parseTime(name string) (time.Time, error) {
-	name = strings.ReplaceAll(name, ".state", "")
-	if s.conf.NamePrefix != "" {
-		name = strings.TrimPrefix(name, fmt.Sprintf("%s/", s.conf.NamePrefix))
+	name = s.unprefixed(name)
+	if strings.HasSuffix(name, deltaSuffix) {
+		name, _, _ = strings.Cut(strings.TrimSuffix(name, deltaSuffix), ".")
 	}
+	name = strings.TrimSuffix(name, fullSuffix)
 
 	return time.Parse(time.RFC3339, name)
 }
+
+// Returns the name of the full snapshot the delta is based on, or an empty
+// string for full snapshots
+func (s *Snapshotter) parseBase(name string) (string, error) {
+	name = s.unprefixed(name)
+	if !strings.HasSuffix(name, deltaSuffix) {
+		return "", nil
+	}
+	_, base, ok := strings.Cut(strings.TrimSuffix(name, deltaSuffix), ".")
+	if !ok {
+		return "", fmt.Errorf("delta snapshot %s has no base", name)
+	}
+	t, err := time.Parse(time.RFC3339, base)
+	if err != nil {
+		return "", err
+	}
+	return s.name(t), nil
+}
+
+func (s *Snapshotter) unprefixed(name string) string {
+	if s.conf.NamePrefix != "" {
+		name = strings.TrimPrefix(name, fmt.Sprintf("%s/", s.conf.NamePrefix))
+	}
+	return name
+}
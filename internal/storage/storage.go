@@ -22,6 +22,9 @@ func New(conf config.Storage) (objstore.Bucket, error) {
 		return newS3(conf)
 	case "filesystem":
 		return newFilesystem(conf)
+	case "memory":
+		// Everything stored is lost when the process exits
+		return objstore.NewInMemBucket(), nil
 	default:
 		return nil, ErrUnsupportedStorageType
 	}
@@ -13,9 +13,8 @@ import (
 	"github.com/grafana/pyroscope-go"
 	"github.com/orderly-queue/orderly/cmd/root"
 	"github.com/orderly-queue/orderly/cmd/secrets"
-	"github.com/orderly-queue/orderly/internal/app"
-	"github.com/orderly-queue/orderly/internal/http"
 	"github.com/orderly-queue/orderly/internal/logger"
+	"github.com/orderly-queue/orderly/internal/server"
 	"github.com/orderly-queue/orderly/internal/tracing"
 	"github.com/orderly-queue/orderly/pkg/config"
 )
@@ -72,14 +71,12 @@ func main() {
 		defer setupPyroscope(conf)()
 	}
 
-	app, err := app.New(ctx, conf)
+	srv, err := server.New(ctx, conf, server.WithVersion(version))
 	if err != nil {
 		die(err)
 	}
-	app.Version = version
-	app.Http = http.New(app)
 
-	root := root.New(app)
+	root := root.New(srv)
 	root.SetContext(ctx)
 
 	if err := root.Execute(); err != nil {
@@ -2,7 +2,9 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/grafana/pyroscope-go"
 	"go.uber.org/zap"
@@ -118,15 +120,169 @@ type Storage struct {
 	Config  map[string]any `yaml:"config"`
 }
 
+type Retention struct {
+	// The number of most recent snapshots that are always kept, regardless of
+	// the other retention rules. At least one snapshot is always kept.
+	KeepLatest uint `yaml:"keep_latest"`
+
+	// The number of hourly, daily and weekly snapshots to keep, the most recent
+	// snapshot in each period is kept
+	Hourly uint `yaml:"hourly"`
+	Daily  uint `yaml:"daily"`
+	Weekly uint `yaml:"weekly"`
+
+	// Log the snapshots that would be pruned without deleting them
+	DryRun bool `yaml:"dry_run"`
+}
+
+type Lease struct {
+	Enabled bool `yaml:"enabled"`
+
+	// How long the lease is valid for before another instance can take it over
+	TTL time.Duration `yaml:"ttl"`
+
+	// Allow the instance to start without the lease, it will not restore or
+	// take snapshots until it acquires the lease
+	Standby bool `yaml:"standby"`
+}
+
+type Deltas struct {
+	// Upload the changes since the previous snapshot instead of the whole queue
+	Enabled bool `yaml:"enabled"`
+
+	// The number of delta snapshots taken between each full snapshot
+	FullEvery uint `yaml:"full_every"`
+}
+
+type Log struct {
+	// Ship a log of every operation on the queue to storage so it can be
+	// restored to any point in time
+	Enabled bool `yaml:"enabled"`
+
+	// How often the current log segment is sealed and shipped
+	SegmentDuration time.Duration `yaml:"segment_duration"`
+
+	// The max number of operations in a segment before it is sealed
+	SegmentSize uint `yaml:"segment_size"`
+
+	// The max number of sealed segments held in memory whilst they fail to
+	// ship, the oldest are dropped past it
+	MaxSealed uint `yaml:"max_sealed"`
+}
+
 type Snapshot struct {
-	Enabled       bool   `yaml:"enabled"`
-	Schedule      string `yaml:"schedule"`
-	RetentionDays uint   `yaml:"retention_days"`
-	NamePrefix    string `yaml:"name_prefix"`
+	Enabled       bool      `yaml:"enabled"`
+	Schedule      string    `yaml:"schedule"`
+	RetentionDays uint      `yaml:"retention_days"`
+	Retention     Retention `yaml:"retention"`
+	NamePrefix    string    `yaml:"name_prefix"`
+	Lease         Lease     `yaml:"lease"`
+	Deltas        Deltas    `yaml:"deltas"`
+	Log           Log       `yaml:"log"`
+}
+
+type Spill struct {
+	// The max number of bytes of messages each queue keeps in memory before
+	// spilling to disk, 0 keeps everything in memory
+	MemoryBudget int64 `yaml:"memory_budget"`
+
+	// The directory spilled segments are written to
+	Dir string `yaml:"dir"`
+}
+
+type Limits struct {
+	// The max number of messages in the queue, 0 is unlimited
+	MaxLength uint `yaml:"max_length"`
+
+	// The max number of bytes of messages in the queue, 0 is unlimited
+	MaxBytes int64 `yaml:"max_bytes"`
+
+	// What happens to a push when the queue is full, one of reject,
+	// drop_oldest or block
+	Overflow string `yaml:"overflow"`
+
+	// The longest a producer is blocked for when the overflow is block, 0
+	// waits until the producer's own timeout
+	BlockTimeout time.Duration `yaml:"block_timeout"`
+}
+
+type Expiry struct {
+	// How long messages pushed without a ttl live for, 0 never expires them
+	TTL time.Duration `yaml:"ttl"`
+
+	// The queue expired messages are moved to, empty discards them
+	DeadLetter string `yaml:"dead_letter"`
+}
+
+type Dedup struct {
+	// How long the dedup keys of pushed messages are remembered for, pushes
+	// with a key seen in the window are acknowledged without being enqueued
+	Window time.Duration `yaml:"window"`
+
+	// The max number of keys remembered per queue, the oldest are forgotten
+	// first
+	MaxKeys uint `yaml:"max_keys"`
+}
+
+type Routing struct {
+	// The queue published messages that match no subscription or binding are
+	// sent to, empty discards them
+	Alternate string `yaml:"alternate"`
+}
+
+type Jobs struct {
+	// How long the status and result of finished jobs are kept for
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Pushes a message to a queue on a cron expression
+type Schedule struct {
+	Name string `yaml:"name"`
+	// A standard five field cron expression
+	Cron string `yaml:"cron"`
+	// The queue the message is pushed to, empty for the default queue
+	Queue string `yaml:"queue"`
+	// A text/template rendered with the schedule's name and the time of the
+	// run as .Name and .Time
+	Body string `yaml:"body"`
+	// What to do about runs missed while the server was down, either skip or
+	// catch_up
+	Missed string `yaml:"missed"`
+}
+
+// Overrides for a named queue, zero values use the settings of the default
+// queue
+type NamedQueue struct {
+	Expiry Expiry `yaml:"expiry"`
+	Limits Limits `yaml:"limits"`
+	Dedup  Dedup  `yaml:"dedup"`
 }
 
 type Queue struct {
 	Snapshot Snapshot `yaml:"snapshot"`
+	Spill    Spill    `yaml:"spill"`
+	Limits   Limits   `yaml:"limits"`
+	Expiry   Expiry   `yaml:"expiry"`
+	Dedup    Dedup    `yaml:"dedup"`
+	Routing  Routing  `yaml:"routing"`
+	Jobs     Jobs     `yaml:"jobs"`
+
+	Schedules []Schedule `yaml:"schedules"`
+
+	// How often expired messages are removed from the middle of the queues,
+	// they are always skipped when they reach the front. Messages that
+	// weren't acked in time are delivered again on the same interval.
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+
+	// How long a delivered message waits to be acked before it is delivered
+	// again, only applies to consumers that ack
+	AckTimeout time.Duration `yaml:"ack_timeout"`
+
+	// The max number of queues clients can create by naming them, the
+	// configured queues don't count towards it
+	MaxQueues uint `yaml:"max_queues"`
+
+	Queues map[string]NamedQueue `yaml:"queues"`
 }
 
 type Config struct {
@@ -186,9 +342,52 @@ func (c *Config) Validate() error {
 	if c.Queue.Snapshot.Enabled && !c.Storage.Enabled {
 		return errors.New("storage must be configure when snapshots are enabled")
 	}
+	if c.Queue.Snapshot.Log.Enabled && !c.Queue.Snapshot.Enabled {
+		return errors.New("snapshots must be enabled when the log is enabled")
+	}
+	if err := validateOverflow(c.Queue.Limits.Overflow); err != nil {
+		return err
+	}
+	if c.Queue.Expiry.DeadLetter == "default" {
+		return errors.New("the default queue cannot be its own dead letter queue")
+	}
+	names := map[string]bool{}
+	for _, s := range c.Queue.Schedules {
+		if s.Name == "" || s.Cron == "" {
+			return errors.New("schedules must have a name and a cron expression")
+		}
+		if names[s.Name] {
+			return fmt.Errorf("schedule %s is defined more than once", s.Name)
+		}
+		names[s.Name] = true
+		switch s.Missed {
+		case "", "skip", "catch_up":
+		default:
+			return fmt.Errorf("schedule %s: missed must be one of skip or catch_up", s.Name)
+		}
+	}
+	for name, named := range c.Queue.Queues {
+		if named.Limits.Overflow != "" {
+			if err := validateOverflow(named.Limits.Overflow); err != nil {
+				return fmt.Errorf("queue %s: %w", name, err)
+			}
+		}
+		if named.Expiry.DeadLetter == name {
+			return fmt.Errorf("queue %s cannot be its own dead letter queue", name)
+		}
+	}
 	return nil
 }
 
+func validateOverflow(overflow string) error {
+	switch overflow {
+	case "reject", "drop_oldest", "block":
+		return nil
+	default:
+		return errors.New("queue overflow must be one of reject, drop_oldest or block")
+	}
+}
+
 func (c *Config) SetDefaults() {
 	if c.Environment == "" {
 		c.Environment = "dev"
@@ -211,4 +410,43 @@ func (c *Config) SetDefaults() {
 	if c.Queue.Snapshot.Schedule == "" {
 		c.Queue.Snapshot.Schedule = "0 * * * *"
 	}
+	if c.Queue.Snapshot.Retention.KeepLatest == 0 {
+		c.Queue.Snapshot.Retention.KeepLatest = 1
+	}
+	if c.Queue.Snapshot.Deltas.FullEvery == 0 {
+		c.Queue.Snapshot.Deltas.FullEvery = 24
+	}
+	if c.Queue.Snapshot.Log.SegmentDuration == 0 {
+		c.Queue.Snapshot.Log.SegmentDuration = time.Minute
+	}
+	if c.Queue.Snapshot.Log.SegmentSize == 0 {
+		c.Queue.Snapshot.Log.SegmentSize = 10000
+	}
+	if c.Queue.Snapshot.Log.MaxSealed == 0 {
+		c.Queue.Snapshot.Log.MaxSealed = 100
+	}
+	if c.Queue.Snapshot.Lease.TTL == 0 {
+		c.Queue.Snapshot.Lease.TTL = time.Second * 30
+	}
+	if c.Queue.Limits.Overflow == "" {
+		c.Queue.Limits.Overflow = "reject"
+	}
+	if c.Queue.Dedup.Window == 0 {
+		c.Queue.Dedup.Window = time.Minute * 5
+	}
+	if c.Queue.Dedup.MaxKeys == 0 {
+		c.Queue.Dedup.MaxKeys = 100000
+	}
+	if c.Queue.AckTimeout == 0 {
+		c.Queue.AckTimeout = time.Second * 30
+	}
+	if c.Queue.Jobs.TTL == 0 {
+		c.Queue.Jobs.TTL = time.Hour * 24
+	}
+	if c.Queue.SweepInterval == 0 {
+		c.Queue.SweepInterval = time.Second * 10
+	}
+	if c.Queue.MaxQueues == 0 {
+		c.Queue.MaxQueues = 1000
+	}
 }
@@ -0,0 +1,237 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+var (
+	ErrProducerClosed = errors.New("producer is closed")
+)
+
+// Pushes the messages in a single round trip, returning the error for each
+// message which is nil when it was pushed. Every message gets the same options,
+// so a dedup key is rejected.
+func (c *Client) PushBatch(ctx context.Context, items []string, opts ...Option) ([]error, error) {
+	by, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToPush, err)
+	}
+	cmd, err := command.Build(command.Batch, string(by))
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.push(ctx, nil, apply(cmd, opts))
+	if err != nil {
+		return nil, err
+	}
+	results := []string{}
+	if err := json.Unmarshal([]byte(out.Message), &results); err != nil || len(results) != len(items) {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToPush, response.ErrInvalidFormat)
+	}
+	errs := make([]error, len(results))
+	for i, result := range results {
+		if result != "" {
+			errs[i] = fmt.Errorf("%w: %w", ErrFailedToPush, response.ParseError(result))
+		}
+	}
+	return errs, nil
+}
+
+type BatchConfig struct {
+	// A batch is flushed when it holds this many messages, defaults to 100
+	MaxCount int
+	// A batch is flushed when its messages hold this many bytes, defaults to
+	// 64KiB
+	MaxBytes int
+	// How long a batch waits for more messages after its first before it is
+	// flushed, defaults to 5ms
+	Linger time.Duration
+	// The number of messages waiting to be batched before pushes block,
+	// defaults to 10000
+	BufferSize int
+
+	// The options every message is pushed with, such as the queue
+	Options []Option
+}
+
+func (b BatchConfig) withDefaults() BatchConfig {
+	if b.MaxCount <= 0 {
+		b.MaxCount = 100
+	}
+	if b.MaxBytes <= 0 {
+		b.MaxBytes = 64 * 1024
+	}
+	if b.Linger <= 0 {
+		b.Linger = time.Millisecond * 5
+	}
+	if b.BufferSize <= 0 {
+		b.BufferSize = 10000
+	}
+	return b
+}
+
+// The result of a message pushed by a batch producer
+type Future struct {
+	done chan struct{}
+	err  error
+}
+
+// Closed once the message's batch has been pushed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Returns the error pushing the message, only valid once it is done
+func (f *Future) Err() error {
+	return f.err
+}
+
+// Waits for the message's batch to be pushed, returning the error pushing
+// the message
+func (f *Future) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-f.done:
+		return f.err
+	}
+}
+
+func (f *Future) resolve(err error) {
+	f.err = err
+	close(f.done)
+}
+
+type batched struct {
+	body   string
+	future *Future
+}
+
+// Pushes messages asynchronously in batches, flushing a batch when it is full
+// or has waited for the linger
+type BatchProducer struct {
+	conf BatchConfig
+	push func(context.Context, []string) ([]error, error)
+	// How long a batch waits to be pushed
+	timeout time.Duration
+
+	mu     *sync.RWMutex
+	closed bool
+	in     chan batched
+	done   chan struct{}
+}
+
+func NewBatchProducer(client *Client, conf BatchConfig) *BatchProducer {
+	conf = conf.withDefaults()
+	b := &BatchProducer{
+		conf: conf,
+		push: func(ctx context.Context, items []string) ([]error, error) {
+			return client.PushBatch(ctx, items, conf.Options...)
+		},
+		timeout: client.writeTimeout,
+		mu:      &sync.RWMutex{},
+		in:      make(chan batched, conf.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Adds the message to the next batch, blocking while the buffer is full
+func (b *BatchProducer) Push(ctx context.Context, data string) (*Future, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return nil, ErrProducerClosed
+	}
+	f := &Future{done: make(chan struct{})}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case b.in <- batched{body: data, future: f}:
+		return f, nil
+	}
+}
+
+// Stops accepting messages and flushes the ones that are buffered, waiting
+// until they have been pushed or the context is done
+func (b *BatchProducer) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.in)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.done:
+		return nil
+	}
+}
+
+func (b *BatchProducer) run() {
+	defer close(b.done)
+
+	batch := []batched{}
+	size := 0
+	linger := time.NewTimer(b.conf.Linger)
+	linger.Stop()
+
+	flush := func() {
+		linger.Stop()
+		if len(batch) == 0 {
+			return
+		}
+		b.flush(batch)
+		batch = []batched{}
+		size = 0
+	}
+
+	for {
+		select {
+		case msg, ok := <-b.in:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				linger.Reset(b.conf.Linger)
+			}
+			batch = append(batch, msg)
+			size += len(msg.body)
+			if len(batch) >= b.conf.MaxCount || size >= b.conf.MaxBytes {
+				flush()
+			}
+		case <-linger.C:
+			flush()
+		}
+	}
+}
+
+func (b *BatchProducer) flush(batch []batched) {
+	items := make([]string, 0, len(batch))
+	for _, msg := range batch {
+		items = append(items, msg.body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	errs, err := b.push(ctx, items)
+	for i, msg := range batch {
+		if err != nil {
+			msg.future.resolve(err)
+			continue
+		}
+		msg.future.resolve(errs[i])
+	}
+}
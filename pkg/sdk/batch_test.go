@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBatchProducer(conf BatchConfig) (*BatchProducer, func() [][]string) {
+	mu := &sync.Mutex{}
+	batches := [][]string{}
+	b := NewBatchProducer(&Client{writeTimeout: time.Second}, conf)
+	b.push = func(ctx context.Context, items []string) ([]error, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, items)
+		errs := make([]error, len(items))
+		for i, item := range items {
+			if item == "bad" {
+				errs[i] = errors.New("rejected")
+			}
+		}
+		return errs, nil
+	}
+	return b, func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func TestItFlushesFullBatches(t *testing.T) {
+	ctx := context.Background()
+	b, batches := testBatchProducer(BatchConfig{MaxCount: 2, Linger: time.Hour})
+
+	futures := []*Future{}
+	for _, item := range []string{"apple", "bad", "pear"} {
+		f, err := b.Push(ctx, item)
+		require.Nil(t, err)
+		futures = append(futures, f)
+	}
+	require.Nil(t, futures[0].Wait(ctx))
+	require.EqualError(t, futures[1].Wait(ctx), "rejected")
+	require.Equal(t, [][]string{{"apple", "bad"}}, batches())
+
+	// The rest are flushed on close
+	require.Nil(t, b.Close(ctx))
+	require.Nil(t, futures[2].Wait(ctx))
+	require.Equal(t, [][]string{{"apple", "bad"}, {"pear"}}, batches())
+
+	_, err := b.Push(ctx, "late")
+	require.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func TestItFlushesAfterTheLinger(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	b, batches := testBatchProducer(BatchConfig{MaxBytes: 10, Linger: time.Millisecond * 10})
+	defer b.Close(ctx)
+
+	f, err := b.Push(ctx, "apple")
+	require.Nil(t, err)
+	require.Nil(t, f.Wait(ctx))
+	require.Equal(t, [][]string{{"apple"}}, batches())
+
+	// Batches are flushed once they hold enough bytes
+	for i := range 3 {
+		f, err = b.Push(ctx, fmt.Sprintf("pear%d", i))
+		require.Nil(t, err)
+	}
+	require.Nil(t, f.Wait(ctx))
+	require.Equal(t, []string{"pear0", "pear1"}, batches()[1])
+}
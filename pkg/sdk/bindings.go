@@ -0,0 +1,94 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// How a binding matches published messages
+type Match string
+
+var (
+	// The routing key equals the binding's key
+	MatchExact Match = "exact"
+	// The routing key matches the binding's pattern of dot separated words,
+	// where * matches exactly one word and # matches zero or more
+	MatchWildcard Match = "wildcard"
+	// The routing key starts with the binding's key
+	MatchPrefix Match = "prefix"
+	// Every one of the binding's headers is set to the same value on the
+	// message
+	MatchHeaders Match = "headers"
+)
+
+// Routes published messages that match it to the queues
+type Binding struct {
+	Name    string            `json:"name"`
+	Match   Match             `json:"match"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Queues  []string          `json:"queues"`
+}
+
+// Adds the binding, replacing any binding with the same name
+func (c *Client) Bind(ctx context.Context, b Binding) error {
+	cmd, err := command.Build(command.Bind, b.Name)
+	if err != nil {
+		return err
+	}
+	cmd = cmd.With("match", string(b.Match)).With("queues", strings.Join(b.Queues, ","))
+	if b.Key != "" {
+		cmd = cmd.With("key", b.Key)
+	}
+	for k, v := range b.Headers {
+		cmd = cmd.With(headerPrefix+k, v)
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToBind, err)
+	}
+	return nil
+}
+
+func (c *Client) Unbind(ctx context.Context, name string) error {
+	cmd, err := command.Build(command.Unbind, name)
+	if err != nil {
+		return err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToBind, err)
+	}
+	return nil
+}
+
+// Returns the bindings sorted by name
+func (c *Client) Bindings(ctx context.Context) ([]Binding, error) {
+	cmd, err := command.Build(command.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToBind, err)
+	}
+	bindings := []Binding{}
+	if err := json.Unmarshal([]byte(out.Message), &bindings); err != nil {
+		return nil, fmt.Errorf("%w: %w", response.ErrInvalidFormat, err)
+	}
+	return bindings, nil
+}
@@ -1,19 +1,19 @@
 package sdk
 
 import (
+	"cmp"
 	"context"
-	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strconv"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
 	"github.com/orderly-queue/orderly/pkg/sdk/response"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -22,26 +22,86 @@ type MetricsConfig struct {
 	RequestSecondHistogram *prometheus.HistogramVec
 	RequestErrorCounter    *prometheus.CounterVec
 	TransimitErrorCounter  prometheus.Counter
+	// Counts the times the client reconnected after the connection dropped
+	ReconnectCounter prometheus.Counter
+	// Set to 1 while the client is connected and 0 otherwise
+	ConnectedGauge prometheus.Gauge
+	// The duration of the handlers run by workers, labelled by their result
+	// of success, error or panic
+	HandlerSecondHistogram *prometheus.HistogramVec
+	// The number of handlers running
+	HandlerInFlightGauge prometheus.Gauge
 }
 
 type ClientConfig struct {
 	Endpoint string
 
+	// Several servers to connect to, used instead of the endpoint when set
+	Endpoints []string
+	// How commands are spread over the endpoints, defaults to failover
+	Strategy Strategy
+
 	// The duration to wait whilst attempting to send a message
 	SendTimeout time.Duration
 
+	// The duration to wait for the reply to a request when the context has
+	// no deadline
+	RequestTimeout time.Duration
+
+	Reconnect ReconnectConfig
+
+	// Wrap every command that gets a single response, the first is the
+	// outermost. The tracing and metrics interceptors are added before them
+	// when they are configured.
+	Interceptors []UnaryInterceptor
+	// Wrap every consumer, the first is the outermost. The tracing interceptor
+	// is added before them when tracing is enabled.
+	StreamInterceptors []StreamInterceptor
+
+	// Called whenever the state of the connection changes
+	OnStateChange func(State)
+
 	Metrics MetricsConfig
+
+	// Traces commands and propagates the trace from producers to consumers
+	Tracing TracingConfig
 }
 
 func (c ClientConfig) validate() error {
-	if c.Endpoint == "" {
+	if c.Endpoint == "" && len(c.Endpoints) == 0 {
 		return fmt.Errorf("%w: endpoint cannot be empty", ErrInvalidConfig)
 	}
+	switch c.Strategy {
+	case "", StrategyFailover, StrategyRoundRobin, StrategyLeastOutstanding:
+	default:
+		return fmt.Errorf("%w: unknown strategy %s", ErrInvalidConfig, c.Strategy)
+	}
 	return nil
 }
 
 func (c ClientConfig) URL() (*url.URL, error) {
-	url, err := url.Parse(c.Endpoint)
+	return toURL(c.Endpoint)
+}
+
+// Returns the websocket urls of the endpoints
+func (c ClientConfig) URLs() ([]*url.URL, error) {
+	endpoints := c.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{c.Endpoint}
+	}
+	out := make([]*url.URL, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		url, err := toURL(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, url)
+	}
+	return out, nil
+}
+
+func toURL(endpoint string) (*url.URL, error) {
+	url, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -55,22 +115,53 @@ func (c ClientConfig) URL() (*url.URL, error) {
 }
 
 type Client struct {
-	listenMutex *sync.RWMutex
-	pipes       map[uuid.UUID]chan response.Response
-	tx          *sync.Mutex
-	rx          chan string
-
-	isClosed bool
-
+	pending *pending
+
+	links    []*link
+	strategy Strategy
+	next     *atomic.Uint64
+
+	healthMutex *sync.Mutex
+	health      map[string]*health
+
+	// The commands of the active consumers and the links they were sent on.
+	// They are sent again when their link reconnects and the responses to the
+	// resent commands are dropped.
+	consumerMutex *sync.Mutex
+	consumers     map[uuid.UUID]consumer
+	resubscribing map[uuid.UUID]struct{}
+
+	reconnect     ReconnectConfig
+	stateMutex    *sync.Mutex
+	state         State
+	onStateChange func(State)
+
+	// Replies to requests are consumed from the session's temporary queue and
+	// routed by their correlation id
+	replyMutex *sync.Mutex
+	replyQueue string
+	replyLink  *link
+	replies    map[string]chan Message
+	// Stops consuming from the reply queue when the session it belongs to ends
+	replyCancel context.CancelFunc
+	// The consume command of the reply queue, which isn't resent when the
+	// link reconnects as the queue went with the session
+	replyConsumer uuid.UUID
+
+	ctx       context.Context
 	cancel    context.CancelFunc
 	closed    chan struct{}
 	closeOnce *sync.Once
 
 	metrics MetricsConfig
 
-	conn *websocket.Conn
+	interceptors       []UnaryInterceptor
+	streamInterceptors []StreamInterceptor
+	// Records the delivery of a popped message, nil when tracing is disabled
+	receive receiver
 
-	writeTimeout time.Duration
+	writeTimeout   time.Duration
+	requestTimeout time.Duration
 }
 
 func NewClient(ctx context.Context, config ClientConfig) (*Client, error) {
@@ -80,49 +171,104 @@ func NewClient(ctx context.Context, config ClientConfig) (*Client, error) {
 	if config.SendTimeout == 0 {
 		config.SendTimeout = time.Second * 3
 	}
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = time.Second * 30
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 
 	c := &Client{
-		listenMutex: &sync.RWMutex{},
-		pipes:       make(map[uuid.UUID]chan response.Response),
-		tx:          &sync.Mutex{},
-		rx:          make(chan string, 100),
-		closed:      make(chan struct{}, 1),
-		closeOnce:   &sync.Once{},
-		cancel:      cancel,
-
-		metrics:      config.Metrics,
-		writeTimeout: config.SendTimeout,
+		pending:       newPending(),
+		strategy:      cmp.Or(config.Strategy, StrategyFailover),
+		next:          &atomic.Uint64{},
+		healthMutex:   &sync.Mutex{},
+		health:        make(map[string]*health),
+		consumerMutex: &sync.Mutex{},
+		consumers:     make(map[uuid.UUID]consumer),
+		resubscribing: make(map[uuid.UUID]struct{}),
+		closed:        make(chan struct{}, 1),
+		closeOnce:     &sync.Once{},
+		replyMutex:    &sync.Mutex{},
+		replies:       make(map[string]chan Message),
+		ctx:           ctx,
+		cancel:        cancel,
+
+		reconnect:     config.Reconnect.withDefaults(),
+		stateMutex:    &sync.Mutex{},
+		onStateChange: config.OnStateChange,
+
+		metrics:            config.Metrics,
+		interceptors:       config.Interceptors,
+		streamInterceptors: config.StreamInterceptors,
+		writeTimeout:       config.SendTimeout,
+		requestTimeout:     config.RequestTimeout,
 	}
 	c.initMetrics()
-
-	// Validate the websocket url
-	url, err := config.URL()
-	if err != nil {
-		return nil, err
+	if config.Metrics.RequestSecondHistogram != nil || config.Metrics.RequestErrorCounter != nil {
+		c.interceptors = append([]UnaryInterceptor{MetricsInterceptor(config.Metrics)}, c.interceptors...)
+	}
+	if config.Tracing.Enabled {
+		c.interceptors = append([]UnaryInterceptor{TracingInterceptor(config.Tracing)}, c.interceptors...)
+		c.streamInterceptors = append([]StreamInterceptor{TracingStreamInterceptor(config.Tracing)}, c.streamInterceptors...)
+		c.receive = newReceiver(config.Tracing)
 	}
 
-	ws, _, err := websocket.DefaultDialer.DialContext(ctx, url.String(), make(http.Header))
+	// Validate the websocket urls
+	urls, err := config.URLs()
 	if err != nil {
 		return nil, err
 	}
-	ws.SetCloseHandler(func(code int, text string) error {
-		return c.Close()
-	})
-	c.conn = ws
+	endpoints := make([]string, 0, len(urls))
+	for _, url := range urls {
+		endpoints = append(endpoints, url.String())
+		c.health[url.String()] = &health{}
+	}
+	if c.strategy == StrategyFailover {
+		c.links = []*link{newLink(endpoints)}
+	} else {
+		for _, endpoint := range endpoints {
+			c.links = append(c.links, newLink([]string{endpoint}))
+		}
+	}
 
-	go c.loop(ctx)
-	go c.read(ctx)
+	var dialErr error
+	for _, l := range c.links {
+		if err := c.connect(ctx, l); err != nil {
+			dialErr = err
+		}
+	}
+	connected := false
+	for _, l := range c.links {
+		if l.State() == StateConnected {
+			connected = true
+		}
+	}
+	if !connected {
+		cancel()
+		return nil, dialErr
+	}
+	c.setState(StateConnected)
+
+	for _, l := range c.links {
+		go c.write(ctx, l)
+		if l.State() != StateConnected {
+			if c.reconnect.Enabled {
+				go c.redial(ctx, l)
+			} else {
+				l.setState(StateClosed)
+			}
+		}
+	}
 
 	return c, nil
 }
 
-func (c *Client) Len(ctx context.Context) (uint, error) {
+func (c *Client) Len(ctx context.Context, opts ...Option) (uint, error) {
 	cmd, err := command.Build(command.Len)
 	if err != nil {
 		return 0, err
 	}
+	cmd = apply(cmd, opts)
 
 	out, err := c.send(ctx, cmd)
 	if err != nil {
@@ -141,76 +287,86 @@ func (c *Client) Len(ctx context.Context) (uint, error) {
 	return uint(len), nil
 }
 
-func (c *Client) Push(ctx context.Context, data string) error {
+func (c *Client) Push(ctx context.Context, data string, opts ...Option) error {
 	cmd, err := command.Build(command.Push, data)
 	if err != nil {
 		return err
 	}
-	out, err := c.send(ctx, cmd)
+	_, err = c.push(ctx, nil, apply(cmd, opts))
+	return err
+}
+
+func (c *Client) push(ctx context.Context, l *link, cmd command.Command) (*response.Response, error) {
+	// Tell the server how long we'll wait so a full queue doesn't block us
+	// for longer than that
+	timeout := c.writeTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	cmd = cmd.With("timeout", timeout.String())
+
+	out, err := c.sendOn(ctx, l, cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := out.Err(); err != nil {
-		return fmt.Errorf("%w: %s", ErrFailedToPush, err)
+		return nil, fmt.Errorf("%w: %w", ErrFailedToPush, err)
 	}
-	return nil
+	return out, nil
 }
 
-func (c *Client) Pop(ctx context.Context) (string, error) {
+func (c *Client) Pop(ctx context.Context, opts ...Option) (string, error) {
 	cmd, err := command.Build(command.Pop)
 	if err != nil {
 		return "", err
 	}
-
-	out, err := c.send(ctx, cmd)
+	out, err := c.pop(ctx, nil, apply(cmd, opts))
 	if err != nil {
 		return "", err
 	}
+	return out.Message, nil
+}
+
+func (c *Client) pop(ctx context.Context, l *link, cmd command.Command) (*response.Response, error) {
+	out, err := c.sendOn(ctx, l, cmd)
+	if err != nil {
+		return nil, err
+	}
 	if err := out.Err(); err != nil {
-		return "", fmt.Errorf("%w: %w", ErrFailedToPop, err)
+		return nil, fmt.Errorf("%w: %w", ErrFailedToPop, err)
 	}
 
 	if out.Message == "nil" {
-		return "", ErrQueueEmpty
+		return nil, ErrQueueEmpty
 	}
 
-	return out.Message, nil
+	return out, nil
 }
 
-func (c *Client) Consume(ctx context.Context) (<-chan string, error) {
+func (c *Client) Consume(ctx context.Context, opts ...Option) (<-chan string, error) {
 	cmd, err := command.Build(command.Consume)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrFailedToConsume, err)
 	}
-
-	c.listenMutex.Lock()
-	resp := make(chan response.Response, 100)
-	c.pipes[cmd.ID] = resp
-	c.listenMutex.Unlock()
-
-	if err := c.transmit(cmd.String()); err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrFailedToSend, err)
-	}
-
-	select {
-	case <-ctx.Done():
-		stop := command.Command{ID: cmd.ID, Keyword: command.Stop}
-		c.transmit(stop.String())
-		return nil, ctx.Err()
-	case ok := <-resp:
-		if err := ok.Err(); err != nil {
-			return nil, fmt.Errorf("%w: %s", ErrFailedToConsume, err)
-		}
+	resps, err := c.consume(ctx, apply(cmd, opts))
+	if err != nil {
+		return nil, err
 	}
 
 	out := make(chan string, 100)
 	go func() {
-		defer c.ignore(cmd.ID)
+		defer close(out)
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case msg := <-resp:
+			case msg, ok := <-resps:
+				if !ok {
+					return
+				}
+				if msg.Err() != nil {
+					continue
+				}
 				out <- msg.Message
 			}
 		}
@@ -219,82 +375,210 @@ func (c *Client) Consume(ctx context.Context) (<-chan string, error) {
 	return out, nil
 }
 
-func (c *Client) send(ctx context.Context, cmd command.Command) (*response.Response, error) {
-	defer c.ignore(cmd.ID)
-	resp := c.listen(cmd.ID)
+// A consumer's command and the link it was sent on
+type consumer struct {
+	cmd  command.Command
+	link *link
+}
 
-	start := time.Now()
+// Consumes on every link, so messages are received from each server the
+// client is connected to
+func (c *Client) consume(ctx context.Context, cmd command.Command) (<-chan Received, error) {
+	links := c.links
+	if c.strategy == StrategyFailover {
+		links = c.links[:1]
+	}
+	return c.consumeOn(ctx, links, cmd)
+}
 
-	if err := c.transmit(cmd.String()); err != nil {
-		return nil, err
+func (c *Client) consumeOn(ctx context.Context, links []*link, cmd command.Command) (<-chan Received, error) {
+	if len(c.streamInterceptors) == 0 {
+		return c.fanout(ctx, links, cmd)
 	}
+	return chainStream(c.streamInterceptors, func(ctx context.Context, cmd command.Command) (<-chan Received, error) {
+		return c.fanout(ctx, links, cmd)
+	})(ctx, cmd)
+}
 
-	timeout, cancel := context.WithTimeout(ctx, c.writeTimeout)
-	defer cancel()
+// Subscribes on each of the links and merges their responses. The channel is
+// closed once every subscription has stopped, when the context is done or the
+// server refuses a subscription that was resent after a reconnect.
+func (c *Client) fanout(ctx context.Context, links []*link, cmd command.Command) (<-chan Received, error) {
+	out := make(chan Received, 100)
+	subs := []consumer{}
+	wg := &sync.WaitGroup{}
+	var lastErr error
+	for i, l := range links {
+		sub := cmd
+		if i > 0 {
+			sub.ID = uuid.New()
+		}
+		resps, err := c.subscribe(ctx, l, sub)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		subs = append(subs, consumer{cmd: sub, link: l})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case resp := <-resps:
+					// The consume was acknowledged when it was sent, so an
+					// error is the server refusing it when it was resent
+					// after a reconnect
+					if resp.Err() != nil {
+						c.forget(sub.ID)
+					}
+					select {
+					case out <- Received{Response: resp, link: l}:
+					case <-ctx.Done():
+						return
+					}
+					if resp.Err() != nil {
+						return
+					}
+				}
+			}
+		}()
+	}
+	if len(subs) == 0 {
+		return nil, lastErr
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
 
-	var out response.Response
-	select {
-	case <-timeout.Done():
-		return nil, fmt.Errorf("%w: %w", ErrFailedToSend, ctx.Err())
-	case out = <-resp:
-		// We don't to do anything here
+	go func() {
+		<-ctx.Done()
+		for _, sub := range subs {
+			c.consumerMutex.Lock()
+			delete(c.consumers, sub.cmd.ID)
+			c.consumerMutex.Unlock()
+			c.pending.cancel(sub.cmd.ID)
+			stop := command.Command{ID: sub.cmd.ID, Keyword: command.Stop}
+			c.transmit(sub.link, stop)
+		}
+	}()
+
+	return out, nil
+}
+
+// Sends the consume command on the link. A link that isn't connected is
+// subscribed when it reconnects, unless no link is connected.
+func (c *Client) subscribe(ctx context.Context, l *link, cmd command.Command) (<-chan response.Response, error) {
+	resp := c.pending.stream(cmd.ID, 100, l)
+
+	if l.State() == StateReconnecting && c.State() == StateConnected {
+		c.consumerMutex.Lock()
+		c.consumers[cmd.ID] = consumer{cmd: cmd, link: l}
+		c.consumerMutex.Unlock()
+		return resp, nil
 	}
-	dur := time.Since(start)
 
-	if c.metrics.RequestSecondHistogram != nil {
-		c.metrics.RequestSecondHistogram.With(prometheus.Labels{"method": string(cmd.Keyword)}).Observe(dur.Seconds())
+	if err := c.transmit(l, cmd); err != nil {
+		c.pending.cancel(cmd.ID)
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSend, err)
 	}
 
-	if out.Err() != nil {
-		if c.metrics.RequestErrorCounter != nil {
-			c.metrics.RequestErrorCounter.With(prometheus.Labels{"method": string(cmd.Keyword)}).Inc()
+	select {
+	case <-ctx.Done():
+		c.pending.cancel(cmd.ID)
+		stop := command.Command{ID: cmd.ID, Keyword: command.Stop}
+		c.transmit(l, stop)
+		return nil, ctx.Err()
+	case ok := <-resp:
+		if err := ok.Err(); err != nil {
+			c.pending.cancel(cmd.ID)
+			return nil, fmt.Errorf("%w: %s", ErrFailedToConsume, err)
 		}
 	}
 
-	return &out, nil
+	c.consumerMutex.Lock()
+	c.consumers[cmd.ID] = consumer{cmd: cmd, link: l}
+	c.consumerMutex.Unlock()
+
+	return resp, nil
 }
 
-func (c *Client) transmit(msg string) error {
-	c.tx.Lock()
-	defer c.tx.Unlock()
-	if err := c.conn.WriteMessage(
-		websocket.TextMessage,
-		[]byte(msg),
-	); err != nil {
-		if c.metrics.TransimitErrorCounter != nil {
-			c.metrics.TransimitErrorCounter.Inc()
-		}
-		return fmt.Errorf("%w: %w", ErrFailedToSend, err)
+// Triggers an on-demand snapshot of the queue on the server
+func (c *Client) Snapshot(ctx context.Context) error {
+	cmd, err := command.Build(command.Snapshot)
+	if err != nil {
+		return err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedSnapshot, err)
 	}
 	return nil
 }
 
-func (c *Client) loop(ctx context.Context) {
-	defer c.Close()
-	for {
-		select {
-		case <-c.closed:
-			return
-		case <-ctx.Done():
-			return
-		case msg := <-c.rx:
-			resp, err := response.Parse(msg)
-			if err != nil {
-				continue
-			}
+func (c *Client) send(ctx context.Context, cmd command.Command) (*response.Response, error) {
+	return c.sendOn(ctx, nil, cmd)
+}
 
-			c.listenMutex.RLock()
-			pipe, ok := c.pipes[resp.ID]
-			c.listenMutex.RUnlock()
-			if !ok {
-				continue
-			}
-			pipe <- resp
-		}
+// Sends the command on the link, or the one picked by the client's strategy
+// when it's nil
+func (c *Client) sendOn(ctx context.Context, l *link, cmd command.Command) (*response.Response, error) {
+	if l == nil {
+		l = c.pick()
+	}
+	if len(c.interceptors) == 0 {
+		return c.invoke(ctx, l, cmd)
 	}
+	return chainUnary(c.interceptors, func(ctx context.Context, cmd command.Command) (*response.Response, error) {
+		return c.invoke(ctx, l, cmd)
+	})(ctx, cmd)
 }
 
-func (c *Client) read(ctx context.Context) {
+// Transmits the command on the link and waits for its response
+func (c *Client) invoke(ctx context.Context, l *link, cmd command.Command) (*response.Response, error) {
+	l.outstanding.Add(1)
+	defer l.outstanding.Add(-1)
+
+	resp := c.pending.wait(cmd.ID, l)
+	defer c.pending.release(cmd.ID, resp)
+
+	if err := c.transmit(l, cmd); err != nil {
+		return nil, err
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, c.writeTimeout)
+	defer cancel()
+
+	select {
+	case <-timeout.Done():
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSend, timeout.Err())
+	case out := <-resp:
+		return &out, nil
+	}
+}
+
+// Queues the message for the link's writer, blocking whilst the queue is full
+func (c *Client) transmit(l *link, cmd command.Command) error {
+	if l.State() != StateConnected {
+		return fmt.Errorf("%w: %w", ErrFailedToSend, ErrDisconnected)
+	}
+	select {
+	case l.frames <- cmd:
+		return nil
+	case <-c.closed:
+		return fmt.Errorf("%w: %w", ErrFailedToSend, ErrClosed)
+	}
+}
+
+// Reads from the connection until it drops, then reconnects or closes the
+// client. Responses are handed straight to the commands waiting for them, so
+// a slow consumer stops the client reading rather than buffering.
+func (c *Client) read(ctx context.Context, l *link, conn *websocket.Conn, v protocol.Version) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -302,38 +586,36 @@ func (c *Client) read(ctx context.Context) {
 		case <-c.closed:
 			return
 		default:
-			_, msg, err := c.conn.ReadMessage()
+			_, msg, err := conn.ReadMessage()
 			if err != nil {
-				if websocket.IsCloseError(err, websocket.CloseAbnormalClosure, websocket.CloseGoingAway) || errors.Is(err, syscall.ECONNRESET) {
-					return
-				}
+				c.disconnected(ctx, l, err)
 				return
 			}
-			c.rx <- string(msg)
+			resp, err := response.ParseVersion(string(msg), v)
+			if err != nil {
+				continue
+			}
+			if c.resubscribed(resp) {
+				continue
+			}
+			c.pending.deliver(resp)
 		}
 	}
 }
 
-func (c *Client) listen(id uuid.UUID) <-chan response.Response {
-	c.listenMutex.Lock()
-	defer c.listenMutex.Unlock()
-	l := make(chan response.Response, 1)
-	c.pipes[id] = l
-	return l
-}
-
-func (c *Client) ignore(id uuid.UUID) {
-	c.listenMutex.Lock()
-	defer c.listenMutex.Unlock()
-	delete(c.pipes, id)
-}
-
 func (c *Client) Close() error {
 	c.closeOnce.Do(func() {
-		c.isClosed = true
 		close(c.closed)
 		c.cancel()
-		c.conn.Close()
+		for _, l := range c.links {
+			l.tx.Lock()
+			if l.conn != nil {
+				l.conn.Close()
+			}
+			l.tx.Unlock()
+			l.setState(StateClosed)
+		}
+		c.setState(StateClosed)
 	})
 	return nil
 }
@@ -342,6 +624,15 @@ func (c *Client) Done() <-chan struct{} {
 	return c.closed
 }
 
+func (c *Client) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *Client) initMetrics() {
 	if c.metrics.RequestErrorCounter != nil {
 		c.metrics.RequestErrorCounter.With(prometheus.Labels{"method": "len"}).Add(0)
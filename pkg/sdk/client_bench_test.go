@@ -0,0 +1,262 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"github.com/stretchr/testify/require"
+)
+
+// Responds ok to every command it's sent, writing the responses from a
+// separate goroutine like the server's sessions do
+func echoServer(b testing.TB) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		out := make(chan string, 1024)
+		defer close(out)
+		go func() {
+			for resp := range out {
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(resp)); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			id, _, _ := strings.Cut(string(msg), "::")
+			out <- id + "::ok"
+		}
+	}))
+}
+
+func benchClient(b *testing.B) (context.Context, *Client) {
+	srv := echoServer(b)
+	b.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Cleanup(cancel)
+
+	client, err := NewClient(ctx, ClientConfig{Endpoint: srv.URL})
+	require.Nil(b, err)
+	b.Cleanup(func() { client.Close() })
+	return ctx, client
+}
+
+// The send path the client used before it was pipelined. Every command
+// allocates a channel in a locked map and writes under a mutex, and responses
+// are read into a channel that a loop dispatches from.
+type legacyClient struct {
+	conn  *websocket.Conn
+	tx    *sync.Mutex
+	rx    chan string
+	pipes *lockedPending
+}
+
+func newLegacyClient(ctx context.Context, b *testing.B, endpoint string) *legacyClient {
+	url, err := toURL(endpoint)
+	require.Nil(b, err)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url.String(), nil)
+	require.Nil(b, err)
+	b.Cleanup(func() { conn.Close() })
+
+	c := &legacyClient{
+		conn: conn,
+		tx:   &sync.Mutex{},
+		rx:   make(chan string, 100),
+		pipes: &lockedPending{
+			mu:    &sync.RWMutex{},
+			pipes: make(map[uuid.UUID]chan response.Response),
+		},
+	}
+	go c.loop(ctx)
+	go c.read(ctx)
+	return c
+}
+
+func (c *legacyClient) send(ctx context.Context, cmd command.Command) (*response.Response, error) {
+	resp := c.pipes.wait(cmd.ID)
+	defer c.pipes.release(cmd.ID, resp)
+
+	c.tx.Lock()
+	err := c.conn.WriteMessage(websocket.TextMessage, []byte(cmd.String()))
+	c.tx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	select {
+	case <-timeout.Done():
+		return nil, timeout.Err()
+	case out := <-resp:
+		return &out, nil
+	}
+}
+
+func (c *legacyClient) loop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-c.rx:
+			resp, err := response.Parse(msg)
+			if err != nil {
+				continue
+			}
+			c.pipes.deliver(resp)
+		}
+	}
+}
+
+func (c *legacyClient) read(ctx context.Context) {
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case c.rx <- string(msg):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type sender interface {
+	send(context.Context, command.Command) (*response.Response, error)
+}
+
+func benchSenders(b *testing.B, bench func(*testing.B, context.Context, sender)) {
+	b.Run("pipelined", func(b *testing.B) {
+		ctx, client := benchClient(b)
+		bench(b, ctx, client)
+	})
+	b.Run("legacy", func(b *testing.B) {
+		srv := echoServer(b)
+		b.Cleanup(srv.Close)
+		ctx, cancel := context.WithCancel(context.Background())
+		b.Cleanup(cancel)
+		bench(b, ctx, newLegacyClient(ctx, b, srv.URL))
+	})
+}
+
+func BenchmarkClientSend(b *testing.B) {
+	benchSenders(b, func(b *testing.B, ctx context.Context, client sender) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			cmd, _ := command.Build(command.Len)
+			if _, err := client.send(ctx, cmd); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkClientSendParallel(b *testing.B) {
+	benchSenders(b, func(b *testing.B, ctx context.Context, client sender) {
+		b.ReportAllocs()
+		b.SetParallelism(64)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				cmd, _ := command.Build(command.Len)
+				if _, err := client.send(ctx, cmd); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+// The table the client used before it was sharded, a single map behind one
+// lock with a channel allocated per command
+type lockedPending struct {
+	mu    *sync.RWMutex
+	pipes map[uuid.UUID]chan response.Response
+}
+
+func (p *lockedPending) wait(id uuid.UUID) chan response.Response {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch := make(chan response.Response, 1)
+	p.pipes[id] = ch
+	return ch
+}
+
+func (p *lockedPending) release(id uuid.UUID, _ chan response.Response) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.pipes, id)
+}
+
+func (p *lockedPending) deliver(resp response.Response) bool {
+	p.mu.Lock()
+	pipe, ok := p.pipes[resp.ID]
+	p.mu.Unlock()
+	if ok {
+		pipe <- resp
+	}
+	return ok
+}
+
+type shardedPending struct {
+	*pending
+}
+
+func (p shardedPending) wait(id uuid.UUID) chan response.Response {
+	return p.pending.wait(id, nil)
+}
+
+type pendingTable interface {
+	wait(uuid.UUID) chan response.Response
+	release(uuid.UUID, chan response.Response)
+	deliver(response.Response) bool
+}
+
+func benchPending(b *testing.B, table pendingTable) {
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := uuid.New()
+			ch := table.wait(id)
+			table.deliver(response.Build(id, "ok"))
+			<-ch
+			table.release(id, ch)
+		}
+	})
+}
+
+func BenchmarkPending(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		benchPending(b, shardedPending{newPending()})
+	})
+	b.Run("locked", func(b *testing.B) {
+		benchPending(b, &lockedPending{
+			mu:    &sync.RWMutex{},
+			pipes: make(map[uuid.UUID]chan response.Response),
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const (
+	// The header that holds the name of the codec a message was encoded with
+	HeaderCodec = "codec"
+)
+
+var (
+	ErrCodecMismatch = errors.New("message was encoded with a different codec")
+	ErrNotProto      = errors.New("value does not implement ProtoMessage")
+)
+
+// Encodes values into message bodies and decodes them back. Bodies are sent
+// as text, so binary codecs base64 encode them.
+type Codec interface {
+	// The name stamped on messages in the codec header
+	Name() string
+	Encode(v any) (string, error)
+	// Decodes the body into v, which is a pointer
+	Decode(body string, v any) error
+}
+
+var (
+	JSON  Codec = jsonCodec{}
+	Gob   Codec = gobCodec{}
+	Proto Codec = protoCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Encode(v any) (string, error) {
+	by, err := json.Marshal(v)
+	return string(by), err
+}
+
+func (jsonCodec) Decode(body string, v any) error {
+	return json.Unmarshal([]byte(body), v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Encode(v any) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(v); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (gobCodec) Decode(body string, v any) error {
+	by, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(by)).Decode(v)
+}
+
+// Implemented by generated protobuf messages that marshal themselves, such
+// as those generated by gogoproto or vtprotobuf. Keeps the SDK free of a
+// protobuf dependency.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+func (protoCodec) Encode(v any) (string, error) {
+	msg, ok := v.(ProtoMessage)
+	if !ok {
+		return "", fmt.Errorf("%w: %T", ErrNotProto, v)
+	}
+	by, err := msg.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(by), nil
+}
+
+func (protoCodec) Decode(body string, v any) error {
+	by, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return err
+	}
+	// Messages are pointers, so decoding into a *T where T is a pointer
+	// allocates the message first
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		if elem := rv.Elem(); elem.Kind() == reflect.Pointer && elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+			v = elem.Interface()
+		} else if elem.Kind() == reflect.Pointer {
+			v = elem.Interface()
+		}
+	}
+	msg, ok := v.(ProtoMessage)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotProto, v)
+	}
+	return msg.Unmarshal(by)
+}
@@ -0,0 +1,67 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type order struct {
+	ID    int
+	Items []string
+}
+
+// Stands in for a generated protobuf message
+type protoOrder struct {
+	ID string
+}
+
+func (o *protoOrder) Marshal() ([]byte, error) {
+	return []byte(o.ID), nil
+}
+
+func (o *protoOrder) Unmarshal(by []byte) error {
+	o.ID = string(by)
+	return nil
+}
+
+func TestItRoundTripsCodecs(t *testing.T) {
+	in := order{ID: 1, Items: []string{"apple", "pear"}}
+	for _, codec := range []Codec{JSON, Gob} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			body, err := codec.Encode(in)
+			require.Nil(t, err)
+			var out order
+			require.Nil(t, codec.Decode(body, &out))
+			require.Equal(t, in, out)
+		})
+	}
+
+	body, err := Proto.Encode(&protoOrder{ID: "apple"})
+	require.Nil(t, err)
+	var out *protoOrder
+	require.Nil(t, Proto.Decode(body, &out))
+	require.Equal(t, "apple", out.ID)
+
+	_, err = Proto.Encode(in)
+	require.ErrorIs(t, err, ErrNotProto)
+}
+
+func TestItRejectsMismatchedCodecs(t *testing.T) {
+	c := NewConsumer[order](nil, JSON)
+
+	body, err := Gob.Encode(order{ID: 2})
+	require.Nil(t, err)
+	msg := Message{Body: body, Headers: map[string]string{HeaderCodec: Gob.Name()}}
+	_, err = c.Decode(msg)
+	require.ErrorIs(t, err, ErrCodecMismatch)
+
+	out, err := c.Accept(Gob).Decode(msg)
+	require.Nil(t, err)
+	require.Equal(t, 2, out.ID)
+
+	// Messages without a codec use the consumer's
+	out, err = c.Decode(Message{Body: `{"ID":3}`})
+	require.Nil(t, err)
+	require.Equal(t, 3, out.ID)
+}
@@ -3,9 +3,12 @@ package command
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -23,12 +26,70 @@ var (
 	Drain   Keyword = "drain"
 	Consume Keyword = "consume"
 	Stop    Keyword = "stop"
+	Ack     Keyword = "ack"
+	Nack    Keyword = "nack"
+
+	// Pushes every message in a json array of strings
+	Batch Keyword = "batch"
+
+	// Returns the name of the session's temporary queue, creating it the
+	// first time
+	Temporary Keyword = "temporary"
+
+	Status Keyword = "status"
+	Result Keyword = "result"
+
+	Publish     Keyword = "publish"
+	Subscribe   Keyword = "subscribe"
+	Unsubscribe Keyword = "unsubscribe"
+
+	Bind     Keyword = "bind"
+	Unbind   Keyword = "unbind"
+	Bindings Keyword = "bindings"
+
+	Schedule   Keyword = "schedule"
+	Unschedule Keyword = "unschedule"
+	Schedules  Keyword = "schedules"
+
+	Snapshot Keyword = "snapshot"
 )
 
+// The number of positional args each keyword takes, any args after these are
+// options in the form key=value
+var positional = map[Keyword]int{
+	Len:      0,
+	Push:     1,
+	Batch:    1,
+	Pop:      0,
+	Drain:    0,
+	Consume:  0,
+	Stop:     0,
+	Ack:      1,
+	Nack:     1,
+	Snapshot: 0,
+
+	Temporary: 0,
+	Status:    1,
+	Result:    1,
+
+	Publish:     2,
+	Subscribe:   2,
+	Unsubscribe: 2,
+
+	Bind:     1,
+	Unbind:   1,
+	Bindings: 0,
+
+	Schedule:   1,
+	Unschedule: 1,
+	Schedules:  0,
+}
+
 type Command struct {
 	ID      uuid.UUID
 	Keyword Keyword
 	Args    []string
+	Options map[string]string
 }
 
 func Build(keyword Keyword, args ...string) (Command, error) {
@@ -44,7 +105,14 @@ func Build(keyword Keyword, args ...string) (Command, error) {
 	}, nil
 }
 
+// Parses a command in the first version of the protocol
 func Parse(input string) (Command, error) {
+	return ParseVersion(input, protocol.V1)
+}
+
+// Parses a command in the version of the protocol, decoding its args and
+// options
+func ParseVersion(input string, v protocol.Version) (Command, error) {
 	spl := strings.Split(input, "::")
 
 	if len(spl) < 2 {
@@ -66,6 +134,31 @@ func Parse(input string) (Command, error) {
 		cmd.Args = spl[2:]
 	}
 
+	if n, ok := positional[cmd.Keyword]; ok && len(cmd.Args) > n {
+		for _, opt := range cmd.Args[n:] {
+			key, value, ok := strings.Cut(opt, "=")
+			if !ok || key == "" {
+				return cmd, fmt.Errorf("%w: options must be in the form key=value", ErrInvalidSyntax)
+			}
+			if key, err = v.Unescape(key); err != nil {
+				return cmd, fmt.Errorf("%w: %w", ErrInvalidSyntax, err)
+			}
+			if value, err = v.Unescape(value); err != nil {
+				return cmd, fmt.Errorf("%w: %w", ErrInvalidSyntax, err)
+			}
+			if cmd.Options == nil {
+				cmd.Options = map[string]string{}
+			}
+			cmd.Options[key] = value
+		}
+		cmd.Args = cmd.Args[:n]
+	}
+	for i, arg := range cmd.Args {
+		if cmd.Args[i], err = v.Unescape(arg); err != nil {
+			return cmd, fmt.Errorf("%w: %w", ErrInvalidSyntax, err)
+		}
+	}
+
 	switch Keyword(spl[1]) {
 	case Len:
 		if len(cmd.Args) > 0 {
@@ -75,6 +168,10 @@ func Parse(input string) (Command, error) {
 		if len(cmd.Args) == 0 {
 			return cmd, fmt.Errorf("%w: push requires an arg", ErrInvalidSyntax)
 		}
+	case Batch:
+		if len(cmd.Args) == 0 {
+			return cmd, fmt.Errorf("%w: batch requires an arg", ErrInvalidSyntax)
+		}
 	case Pop:
 		if len(cmd.Args) > 0 {
 			return cmd, fmt.Errorf("%w: pop takes no args", ErrInvalidSyntax)
@@ -91,6 +188,66 @@ func Parse(input string) (Command, error) {
 		if len(cmd.Args) > 0 {
 			return cmd, fmt.Errorf("%w: stop takes no args", ErrInvalidSyntax)
 		}
+	case Ack:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: ack requires a sequence number", ErrInvalidSyntax)
+		}
+	case Nack:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: nack requires a sequence number", ErrInvalidSyntax)
+		}
+	case Temporary:
+		if len(cmd.Args) > 0 {
+			return cmd, fmt.Errorf("%w: temporary takes no args", ErrInvalidSyntax)
+		}
+	case Status:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: status requires a job id", ErrInvalidSyntax)
+		}
+	case Result:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: result requires a job id", ErrInvalidSyntax)
+		}
+	case Publish:
+		if len(cmd.Args) != 2 {
+			return cmd, fmt.Errorf("%w: publish requires a topic and a message", ErrInvalidSyntax)
+		}
+	case Subscribe:
+		if len(cmd.Args) != 2 {
+			return cmd, fmt.Errorf("%w: subscribe requires a topic and a subscription", ErrInvalidSyntax)
+		}
+	case Unsubscribe:
+		if len(cmd.Args) != 2 {
+			return cmd, fmt.Errorf("%w: unsubscribe requires a topic and a subscription", ErrInvalidSyntax)
+		}
+	case Bind:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: bind requires a name", ErrInvalidSyntax)
+		}
+	case Unbind:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: unbind requires a name", ErrInvalidSyntax)
+		}
+	case Bindings:
+		if len(cmd.Args) > 0 {
+			return cmd, fmt.Errorf("%w: bindings takes no args", ErrInvalidSyntax)
+		}
+	case Schedule:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: schedule requires a name", ErrInvalidSyntax)
+		}
+	case Unschedule:
+		if len(cmd.Args) != 1 {
+			return cmd, fmt.Errorf("%w: unschedule requires a name", ErrInvalidSyntax)
+		}
+	case Schedules:
+		if len(cmd.Args) > 0 {
+			return cmd, fmt.Errorf("%w: schedules takes no args", ErrInvalidSyntax)
+		}
+	case Snapshot:
+		if len(cmd.Args) > 0 {
+			return cmd, fmt.Errorf("%w: snapshot takes no args", ErrInvalidSyntax)
+		}
 	default:
 		return Command{ID: id}, fmt.Errorf("%w: unknown keyword", ErrInvalidSyntax)
 	}
@@ -98,10 +255,58 @@ func Parse(input string) (Command, error) {
 	return cmd, nil
 }
 
+// Returns a copy of the command with the option set
+func (c Command) With(key, value string) Command {
+	opts := make(map[string]string, len(c.Options)+1)
+	for k, v := range c.Options {
+		opts[k] = v
+	}
+	opts[key] = value
+	c.Options = opts
+	return c
+}
+
+// Returns the value of the option, or an empty string when it isn't set
+func (c Command) Option(key string) string {
+	return c.Options[key]
+}
+
+// Encodes the command in the first version of the protocol
 func (c Command) String() string {
+	return c.Encode(protocol.V1)
+}
+
+// Encodes the command in the version of the protocol
+func (c Command) Encode(v protocol.Version) string {
 	out := fmt.Sprintf("%s::%s", c.ID.String(), string(c.Keyword))
 	for _, a := range c.Args {
-		out = fmt.Sprintf("%s::%s", out, a)
+		out = fmt.Sprintf("%s::%s", out, v.Escape(a))
+	}
+	keys := make([]string, 0, len(c.Options))
+	for k := range c.Options {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		out = fmt.Sprintf("%s::%s=%s", out, v.Escape(k), v.Escape(c.Options[k]))
 	}
 	return out
 }
+
+// The attributes of the command's spans, the client and server both set them
+// so their spans can be queried the same way
+func (c Command) Attributes() []attribute.KeyValue {
+	size := 0
+	for _, arg := range c.Args {
+		size += len(arg)
+	}
+	queue := c.Option("queue")
+	if c.Keyword == Publish && len(c.Args) > 0 {
+		queue = c.Args[0]
+	}
+	return []attribute.KeyValue{
+		attribute.String("queue", queue),
+		attribute.String("op", string(c.Keyword)),
+		attribute.Int("size", size),
+	}
+}
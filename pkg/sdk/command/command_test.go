@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
 	"github.com/stretchr/testify/require"
 )
 
@@ -55,6 +56,114 @@ func TestItParsesCommand(t *testing.T) {
 				Args:    []string{},
 			},
 		},
+		{
+			name:  "parses snapshot command",
+			input: fmt.Sprintf("%s::snapshot", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Snapshot,
+				Args:    []string{},
+			},
+		},
+		{
+			name:   "errors when snapshot has args",
+			input:  fmt.Sprintf("%s::snapshot::bongo", id.String()),
+			errors: true,
+		},
+		{
+			name:  "parses push command with options",
+			input: fmt.Sprintf("%s::push::apple=pie::timeout=3s", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Push,
+				Args:    []string{"apple=pie"},
+				Options: map[string]string{"timeout": "3s"},
+			},
+		},
+		{
+			name:   "errors when an option has no value",
+			input:  fmt.Sprintf("%s::push::apple::timeout", id.String()),
+			errors: true,
+		},
+		{
+			name:  "parses ack command",
+			input: fmt.Sprintf("%s::ack::12::queue=orders", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Ack,
+				Args:    []string{"12"},
+				Options: map[string]string{"queue": "orders"},
+			},
+		},
+		{
+			name:   "errors when nack has no sequence number",
+			input:  fmt.Sprintf("%s::nack", id.String()),
+			errors: true,
+		},
+		{
+			name:  "parses publish command",
+			input: fmt.Sprintf("%s::publish::orders::apple::ttl=1m", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Publish,
+				Args:    []string{"orders", "apple"},
+				Options: map[string]string{"ttl": "1m"},
+			},
+		},
+		{
+			name:   "errors when subscribe has no subscription",
+			input:  fmt.Sprintf("%s::subscribe::orders", id.String()),
+			errors: true,
+		},
+		{
+			name:  "parses temporary command",
+			input: fmt.Sprintf("%s::temporary", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Temporary,
+				Args:    []string{},
+			},
+		},
+		{
+			name:   "errors when status has no job id",
+			input:  fmt.Sprintf("%s::status", id.String()),
+			errors: true,
+		},
+		{
+			name:  "parses schedule command",
+			input: fmt.Sprintf("%s::schedule::report::cron=0 * * * *::body=run {{.Time}}", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Schedule,
+				Args:    []string{"report"},
+				Options: map[string]string{"cron": "0 * * * *", "body": "run {{.Time}}"},
+			},
+		},
+		{
+			name:  "parses batch command",
+			input: fmt.Sprintf(`%s::batch::["apple","pear"]::queue=orders`, id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Batch,
+				Args:    []string{`["apple","pear"]`},
+				Options: map[string]string{"queue": "orders"},
+			},
+		},
+		{
+			name:  "parses bind command",
+			input: fmt.Sprintf("%s::bind::eu::match=headers::queues=a,b::header.region=eu", id.String()),
+			expected: Command{
+				ID:      id,
+				Keyword: Bind,
+				Args:    []string{"eu"},
+				Options: map[string]string{"match": "headers", "queues": "a,b", "header.region": "eu"},
+			},
+		},
+		{
+			name:   "errors when bindings has args",
+			input:  fmt.Sprintf("%s::bindings::eu", id.String()),
+			errors: true,
+		},
 		{
 			name:   "errors with too few parts",
 			input:  "bongo",
@@ -80,6 +189,41 @@ func TestItParsesCommand(t *testing.T) {
 			require.Equal(t, c.expected.ID, cmd.ID)
 			require.Equal(t, c.expected.Keyword, cmd.Keyword)
 			require.Equal(t, c.expected.Args, cmd.Args)
+			require.Equal(t, c.expected.Options, cmd.Options)
 		})
 	}
 }
+
+func TestItWritesOptions(t *testing.T) {
+	cmd, err := Build(Push, "apple")
+	require.Nil(t, err)
+	cmd = cmd.With("timeout", "3s")
+
+	parsed, err := Parse(cmd.String())
+	require.Nil(t, err)
+	require.Equal(t, []string{"apple"}, parsed.Args)
+	require.Equal(t, "3s", parsed.Option("timeout"))
+}
+
+func TestItEscapesArgsAndOptions(t *testing.T) {
+	for _, body := range []string{"hi::queue=other", "a::b", `{"a":"b::c"}`, "100%", "key=value"} {
+		cmd, err := Build(Push, body)
+		require.Nil(t, err)
+		cmd = cmd.With("result", "x::y=z").With("header.a::b", "c")
+
+		parsed, err := ParseVersion(cmd.Encode(protocol.V2), protocol.V2)
+		require.Nil(t, err)
+		require.Equal(t, []string{body}, parsed.Args)
+		require.Equal(t, map[string]string{"result": "x::y=z", "header.a::b": "c"}, parsed.Options)
+	}
+}
+
+func TestTheFirstVersionIsNotEscaped(t *testing.T) {
+	cmd, err := Build(Push, "100%3A")
+	require.Nil(t, err)
+	require.Equal(t, cmd.String(), cmd.Encode(protocol.V1))
+
+	parsed, err := Parse(cmd.String())
+	require.Nil(t, err)
+	require.Equal(t, []string{"100%3A"}, parsed.Args)
+}
@@ -0,0 +1,110 @@
+package sdk_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightSendsFailWithARetriableError(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Reconnect: sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+	})
+
+	srv.Inject(sdktest.Fault{Keyword: command.Push, Latency: time.Second})
+	failed := make(chan error, 1)
+	go func() {
+		failed <- client.Push(ctx, "hello")
+	}()
+	time.Sleep(time.Millisecond * 50)
+	srv.Disconnect()
+
+	err := <-failed
+	require.ErrorIs(t, err, sdk.ErrDisconnected)
+	require.True(t, sdk.IsRetriable(err))
+
+	srv.Reset()
+	require.Eventually(t, func() bool {
+		return client.Push(ctx, "hello") == nil
+	}, time.Second*3, time.Millisecond*10)
+}
+
+func TestItReportsChangesToTheConnectionState(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	states := make(chan sdk.State, 10)
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Reconnect:     sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+		OnStateChange: func(state sdk.State) { states <- state },
+	})
+	require.Equal(t, sdk.StateConnected, <-states)
+	// Wait for the server to see the connection
+	require.Nil(t, client.Push(ctx, "hello"))
+
+	srv.Disconnect()
+	require.Equal(t, sdk.StateReconnecting, <-states)
+	require.Equal(t, sdk.StateConnected, <-states)
+
+	require.Nil(t, client.Close())
+	require.Equal(t, sdk.StateClosed, <-states)
+}
+
+func TestAConsumerRefusedAfterAReconnectStops(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	refused := make(chan error, 1)
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Reconnect: sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+		StreamInterceptors: []sdk.StreamInterceptor{
+			func(ctx context.Context, cmd command.Command, next sdk.Streamer) (<-chan sdk.Received, error) {
+				in, err := next(ctx, cmd)
+				if err != nil {
+					return nil, err
+				}
+				out := make(chan sdk.Received, cap(in))
+				go func() {
+					defer close(out)
+					for resp := range in {
+						if err := resp.Err(); err != nil {
+							refused <- err
+						}
+						out <- resp
+					}
+				}()
+				return out, nil
+			},
+		},
+	})
+
+	msgs, err := client.ConsumeMessages(ctx)
+	require.Nil(t, err)
+
+	srv.Inject(sdktest.Fault{Keyword: command.Consume, Err: errors.New("bongo")})
+	srv.Disconnect()
+
+	select {
+	case err := <-refused:
+		require.ErrorContains(t, err, "bongo")
+	case <-ctx.Done():
+		t.Fatal("refusal was not delivered to the consumer")
+	}
+	select {
+	case _, ok := <-msgs:
+		require.False(t, ok)
+	case <-ctx.Done():
+		t.Fatal("consumer was not stopped")
+	}
+}
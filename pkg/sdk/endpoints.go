@@ -0,0 +1,174 @@
+package sdk
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
+)
+
+// How commands are spread over the client's endpoints
+type Strategy string
+
+var (
+	// Stays connected to one endpoint, moving to the next when the connection
+	// drops
+	StrategyFailover Strategy = "failover"
+	// Connects to every endpoint and sends each command to the next connected
+	// one in turn
+	StrategyRoundRobin Strategy = "round_robin"
+	// Connects to every endpoint and sends each command to the connected one
+	// with the fewest commands waiting for a response
+	StrategyLeastOutstanding Strategy = "least_outstanding"
+)
+
+// The health of an endpoint as seen by the client
+type EndpointStatus struct {
+	Endpoint string
+	// Whether the client is connected to the endpoint
+	Connected bool
+	// The commands sent to the endpoint waiting for a response
+	Outstanding int64
+	// The connection attempts and drops since the endpoint was last
+	// connected to
+	Failures    int
+	LastFailure time.Time
+	LastError   error
+}
+
+// A connection to the server. Failover links move between their endpoints when
+// the connection drops, other strategies have a link per endpoint.
+type link struct {
+	urls []string
+
+	// Commands waiting to be written by the link's writer, which holds tx
+	// whilst it encodes them in the connection's version and writes them
+	frames  chan command.Command
+	tx      *sync.Mutex
+	current int
+	conn    *websocket.Conn
+	cork    *corkedConn
+	version protocol.Version
+
+	stateMutex *sync.Mutex
+	state      State
+
+	outstanding *atomic.Int64
+}
+
+func newLink(urls []string) *link {
+	return &link{
+		urls:        urls,
+		frames:      make(chan command.Command, 1024),
+		tx:          &sync.Mutex{},
+		stateMutex:  &sync.Mutex{},
+		state:       StateReconnecting,
+		version:     protocol.V1,
+		outstanding: &atomic.Int64{},
+	}
+}
+
+// The endpoint the link is connected or connecting to
+func (l *link) url() string {
+	l.tx.Lock()
+	defer l.tx.Unlock()
+	return l.urls[l.current]
+}
+
+// Moves the link on to its next endpoint
+func (l *link) rotate() string {
+	l.tx.Lock()
+	defer l.tx.Unlock()
+	l.current = (l.current + 1) % len(l.urls)
+	return l.urls[l.current]
+}
+
+func (l *link) State() State {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	return l.state
+}
+
+func (l *link) setState(state State) {
+	l.stateMutex.Lock()
+	defer l.stateMutex.Unlock()
+	l.state = state
+}
+
+type health struct {
+	failures    int
+	lastFailure time.Time
+	lastError   error
+}
+
+func (c *Client) healthy(url string) {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	c.health[url].failures = 0
+}
+
+func (c *Client) unhealthy(url string, err error) {
+	c.healthMutex.Lock()
+	defer c.healthMutex.Unlock()
+	h := c.health[url]
+	h.failures++
+	h.lastFailure = time.Now()
+	h.lastError = err
+}
+
+// Returns the health of each of the client's endpoints
+func (c *Client) Endpoints() []EndpointStatus {
+	out := []EndpointStatus{}
+	for _, l := range c.links {
+		current := l.url()
+		for _, url := range l.urls {
+			status := EndpointStatus{Endpoint: url}
+			if url == current {
+				status.Connected = l.State() == StateConnected
+				status.Outstanding = l.outstanding.Load()
+			}
+			c.healthMutex.Lock()
+			h := c.health[url]
+			status.Failures, status.LastFailure, status.LastError = h.failures, h.lastFailure, h.lastError
+			c.healthMutex.Unlock()
+			out = append(out, status)
+		}
+	}
+	return out
+}
+
+// Picks the link to send a command on. When none are connected it returns one
+// anyway, sending on it fails with ErrDisconnected.
+func (c *Client) pick() *link {
+	if len(c.links) == 1 {
+		return c.links[0]
+	}
+
+	switch c.strategy {
+	case StrategyLeastOutstanding:
+		var best *link
+		for _, l := range c.links {
+			if l.State() != StateConnected {
+				continue
+			}
+			if best == nil || l.outstanding.Load() < best.outstanding.Load() {
+				best = l
+			}
+		}
+		if best != nil {
+			return best
+		}
+	default:
+		start := int(c.next.Add(1))
+		for i := range c.links {
+			l := c.links[(start+i)%len(c.links)]
+			if l.State() == StateConnected {
+				return l
+			}
+		}
+	}
+	return c.links[0]
+}
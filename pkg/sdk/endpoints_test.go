@@ -0,0 +1,105 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+func endpoints(t *testing.T, conf sdk.ClientConfig) (context.Context, *sdk.Client, *sdktest.Server, *sdktest.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	t.Cleanup(cancel)
+
+	first, second := sdktest.NewServer(t), sdktest.NewServer(t)
+	conf.Endpoints = []string{first.URL, second.URL}
+	client, err := sdk.NewClient(ctx, conf)
+	require.Nil(t, err)
+	t.Cleanup(func() { client.Close() })
+	return ctx, client, first, second
+}
+
+func TestItRoundRobinsOverEndpoints(t *testing.T) {
+	ctx, client, first, second := endpoints(t, sdk.ClientConfig{Strategy: sdk.StrategyRoundRobin})
+
+	for _, body := range []string{"a", "b", "c", "d"} {
+		require.Nil(t, client.Push(ctx, body))
+	}
+
+	require.Len(t, first.Pushed(""), 2)
+	require.Len(t, second.Pushed(""), 2)
+}
+
+func TestItSendsToTheLeastOutstandingEndpoint(t *testing.T) {
+	ctx, client, first, second := endpoints(t, sdk.ClientConfig{Strategy: sdk.StrategyLeastOutstanding})
+
+	first.Inject(sdktest.Fault{Keyword: command.Push, Latency: time.Millisecond * 500})
+	slow := make(chan error, 1)
+	go func() {
+		slow <- client.Push(ctx, "slow")
+	}()
+	require.Eventually(t, func() bool {
+		return client.Endpoints()[0].Outstanding == 1
+	}, time.Second, time.Millisecond)
+
+	for _, body := range []string{"a", "b", "c"} {
+		require.Nil(t, client.Push(ctx, body))
+	}
+	require.Nil(t, <-slow)
+
+	first.AssertPushed(t, "", "slow")
+	second.AssertPushed(t, "", "a", "b", "c")
+}
+
+func TestItFailsOverToTheNextEndpoint(t *testing.T) {
+	ctx, client, first, second := endpoints(t, sdk.ClientConfig{
+		Reconnect: sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+	})
+
+	require.Nil(t, client.Push(ctx, "before"))
+	first.Disconnect()
+
+	require.Eventually(t, func() bool {
+		return client.Push(ctx, "after") == nil
+	}, time.Second*3, time.Millisecond*10)
+
+	first.AssertPushed(t, "", "before")
+	second.AssertPushed(t, "", "after")
+
+	status := client.Endpoints()
+	require.Len(t, status, 2)
+	require.False(t, status[0].Connected)
+	require.NotZero(t, status[0].Failures)
+	require.True(t, status[1].Connected)
+}
+
+func TestItConsumesFromEveryEndpoint(t *testing.T) {
+	ctx, client, first, second := endpoints(t, sdk.ClientConfig{Strategy: sdk.StrategyRoundRobin})
+
+	first.Seed("", "first")
+	second.Seed("", "second")
+
+	msgs, err := client.ConsumeMessages(ctx)
+	require.Nil(t, err)
+
+	bodies := []string{}
+	for range 2 {
+		msg := <-msgs
+		bodies = append(bodies, msg.Body)
+		// Acks go to the server the message came from
+		require.Nil(t, client.Ack(ctx, msg))
+	}
+	require.ElementsMatch(t, []string{"first", "second"}, bodies)
+}
+
+func TestItRejectsUnknownStrategies(t *testing.T) {
+	_, err := sdk.NewClient(context.Background(), sdk.ClientConfig{
+		Endpoint: "http://127.0.0.1:1",
+		Strategy: "random",
+	})
+	require.ErrorIs(t, err, sdk.ErrInvalidConfig)
+}
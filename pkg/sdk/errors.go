@@ -1,13 +1,30 @@
 package sdk
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
 
 var (
-	ErrInvalidConfig   = errors.New("invalid config")
-	ErrFailedToSend    = errors.New("failed to send command")
-	ErrFailedToPush    = errors.New("failed to push")
-	ErrFailedToPop     = errors.New("failed to pop")
-	ErrQueueEmpty      = errors.New("could not pop from empty queue")
-	ErrFailedToConsume = errors.New("failed to consume")
-	ErrClosed          = errors.New("client is closed")
+	ErrInvalidConfig     = errors.New("invalid config")
+	ErrFailedToSend      = errors.New("failed to send command")
+	ErrFailedToPush      = errors.New("failed to push")
+	ErrQueueFull         = response.ErrQueueFull
+	ErrFailedToPop       = errors.New("failed to pop")
+	ErrQueueEmpty        = errors.New("could not pop from empty queue")
+	ErrFailedToConsume   = errors.New("failed to consume")
+	ErrFailedToAck       = errors.New("failed to ack")
+	ErrFailedToPublish   = errors.New("failed to publish")
+	ErrFailedToSubscribe = errors.New("failed to subscribe")
+	ErrFailedToBind      = errors.New("failed to bind")
+	ErrFailedToSchedule  = errors.New("failed to schedule")
+	ErrFailedToRequest   = errors.New("failed to request")
+	ErrNoReplyTo         = errors.New("message has no reply to address")
+	ErrJobMissing        = response.ErrJobMissing
+	ErrJobNotDone        = response.ErrJobNotDone
+	ErrJobFailed         = errors.New("job failed")
+	ErrClosed            = errors.New("client is closed")
+	ErrDisconnected      = errors.New("connection to the server dropped")
+	ErrFailedSnapshot    = errors.New("failed to snapshot")
 )
@@ -0,0 +1,77 @@
+package sdk
+
+import (
+	"context"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sends the command and waits for its response
+type Invoker func(ctx context.Context, cmd command.Command) (*response.Response, error)
+
+// Wraps every command that gets a single response, such as push, pop and len.
+// It can change the command before calling next, and the response or error
+// after.
+type UnaryInterceptor func(ctx context.Context, cmd command.Command, next Invoker) (*response.Response, error)
+
+// A response received by a consumer
+type Received struct {
+	response.Response
+
+	// The link it was received on, messages are settled on the same one
+	link *link
+	// The consumer span started for it when tracing is enabled
+	span trace.SpanContext
+}
+
+// Sends the command and returns the responses streamed back to it
+type Streamer func(ctx context.Context, cmd command.Command) (<-chan Received, error)
+
+// Wraps every consumer. It can change the command before calling next, and
+// the responses by reading them from the stream and sending them on one of its
+// own.
+type StreamInterceptor func(ctx context.Context, cmd command.Command, next Streamer) (<-chan Received, error)
+
+// Chains the interceptors around the invoker, the first is the outermost
+func chainUnary(interceptors []UnaryInterceptor, invoker Invoker) Invoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, cmd command.Command) (*response.Response, error) {
+			return interceptor(ctx, cmd, next)
+		}
+	}
+	return invoker
+}
+
+// Chains the interceptors around the streamer, the first is the outermost
+func chainStream(interceptors []StreamInterceptor, streamer Streamer) Streamer {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], streamer
+		streamer = func(ctx context.Context, cmd command.Command) (<-chan Received, error) {
+			return interceptor(ctx, cmd, next)
+		}
+	}
+	return streamer
+}
+
+// Records the duration of each command and counts the ones that fail,
+// labelled by the command's keyword. The client adds it when its metrics are
+// configured.
+func MetricsInterceptor(conf MetricsConfig) UnaryInterceptor {
+	return func(ctx context.Context, cmd command.Command, next Invoker) (*response.Response, error) {
+		start := time.Now()
+		out, err := next(ctx, cmd)
+		labels := prometheus.Labels{"method": string(cmd.Keyword)}
+		if err == nil && conf.RequestSecondHistogram != nil {
+			conf.RequestSecondHistogram.With(labels).Observe(time.Since(start).Seconds())
+		}
+		if (err != nil || out.Err() != nil) && conf.RequestErrorCounter != nil {
+			conf.RequestErrorCounter.With(labels).Inc()
+		}
+		return out, err
+	}
+}
@@ -0,0 +1,96 @@
+package sdk_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItChainsUnaryInterceptors(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	calls := []string{}
+	named := func(name string) sdk.UnaryInterceptor {
+		return func(ctx context.Context, cmd command.Command, next sdk.Invoker) (*response.Response, error) {
+			calls = append(calls, name)
+			return next(ctx, cmd.With("header."+name, "true"))
+		}
+	}
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Interceptors: []sdk.UnaryInterceptor{named("first"), named("second")},
+	})
+
+	require.Nil(t, client.Push(ctx, "hello"))
+	require.Equal(t, []string{"first", "second"}, calls)
+	require.Equal(t, map[string]string{"first": "true", "second": "true"}, srv.Pushed("")[0].Headers)
+}
+
+func TestItInterceptsStreams(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	upper := func(ctx context.Context, cmd command.Command, next sdk.Streamer) (<-chan sdk.Received, error) {
+		in, err := next(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		out := make(chan sdk.Received)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case resp := <-in:
+					resp.Message = strings.ToUpper(resp.Message)
+					out <- resp
+				}
+			}
+		}()
+		return out, nil
+	}
+	client := srv.Client(ctx, sdk.ClientConfig{
+		StreamInterceptors: []sdk.StreamInterceptor{upper},
+	})
+
+	srv.Seed("", "hello")
+	msgs, err := client.ConsumeMessages(ctx)
+	require.Nil(t, err)
+	msg := <-msgs
+	require.Equal(t, "HELLO", msg.Body)
+	require.Nil(t, client.Ack(ctx, msg))
+}
+
+func TestItRecordsMetricsThroughAnInterceptor(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors"}, []string{"method"})
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "durations"}, []string{"method"})
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Metrics: sdk.MetricsConfig{RequestErrorCounter: errs, RequestSecondHistogram: durations},
+	})
+
+	srv.Inject(sdktest.Fault{Keyword: command.Push, Err: errors.New("boom"), Times: 1})
+	require.Error(t, client.Push(ctx, "failed"))
+	require.Nil(t, client.Push(ctx, "ok"))
+
+	require.Equal(t, float64(1), testutil.ToFloat64(errs.WithLabelValues("push")))
+	observed := &dto.Metric{}
+	require.Nil(t, durations.WithLabelValues("push").(prometheus.Metric).Write(observed))
+	require.Equal(t, uint64(2), observed.GetHistogram().GetSampleCount())
+}
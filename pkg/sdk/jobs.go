@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+const (
+	// The header that holds the id of the job a delivered message belongs to
+	HeaderJob = "job_id"
+)
+
+type JobStatus string
+
+var (
+	JobQueued    JobStatus = "queued"
+	JobInFlight  JobStatus = "in_flight"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// A handle on a message pushed as a job, used to follow its status and fetch
+// its result once it has been acked
+type Job struct {
+	ID string
+
+	client *Client
+	// The link the job was pushed on, as only that server tracks it
+	link *link
+}
+
+// Pushes the message as a job, the server tracks its status until it is
+// acked and keeps its result for the server's job ttl after that
+func (c *Client) PushJob(ctx context.Context, data string, opts ...Option) (*Job, error) {
+	cmd, err := command.Build(command.Push, data)
+	if err != nil {
+		return nil, err
+	}
+	l := c.pick()
+	out, err := c.push(ctx, l, apply(cmd, opts).With("job", "true"))
+	if err != nil {
+		return nil, err
+	}
+	id := out.Meta["job"]
+	if id == "" {
+		return nil, fmt.Errorf("%w: server did not return a job id", ErrFailedToPush)
+	}
+	return &Job{ID: id, client: c, link: l}, nil
+}
+
+// Returns a handle on the job with the id
+func (c *Client) Job(id string) *Job {
+	return &Job{ID: id, client: c}
+}
+
+func (j *Job) Status(ctx context.Context) (JobStatus, error) {
+	cmd, err := command.Build(command.Status, j.ID)
+	if err != nil {
+		return "", err
+	}
+	out, err := j.client.sendOn(ctx, j.link, cmd)
+	if err != nil {
+		return "", err
+	}
+	if err := out.Err(); err != nil {
+		return "", err
+	}
+	return JobStatus(out.Message), nil
+}
+
+// Returns the result of the finished job, ErrJobNotDone when it hasn't
+// finished and ErrJobFailed wrapping the result when it failed
+func (j *Job) Result(ctx context.Context) (string, error) {
+	cmd, err := command.Build(command.Result, j.ID)
+	if err != nil {
+		return "", err
+	}
+	out, err := j.client.sendOn(ctx, j.link, cmd)
+	if err != nil {
+		return "", err
+	}
+	if err := out.Err(); err != nil {
+		return "", err
+	}
+	if JobStatus(out.Meta["status"]) == JobFailed {
+		return out.Message, fmt.Errorf("%w: %s", ErrJobFailed, out.Message)
+	}
+	return out.Message, nil
+}
+
+// Waits for the job to finish, polling its result with a backoff until the
+// context is done
+func (j *Job) Wait(ctx context.Context) (string, error) {
+	wait := time.Millisecond * 50
+	for {
+		out, err := j.Result(ctx)
+		if !errors.Is(err, ErrJobNotDone) {
+			return out, err
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, time.Second)
+	}
+}
+
+// Acks the message with the result, succeeding its job
+func (c *Client) Complete(ctx context.Context, msg Message, result string) error {
+	return c.settle(ctx, command.Ack, msg, map[string]string{"result": result})
+}
+
+// Acks the message with the reason, failing its job. The message isn't
+// delivered again.
+func (c *Client) Fail(ctx context.Context, msg Message, reason string) error {
+	return c.settle(ctx, command.Ack, msg, map[string]string{"result": reason, "failed": "true"})
+}
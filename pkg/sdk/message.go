@@ -0,0 +1,161 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A message delivered by the server that waits to be acked. It is delivered
+// again if it is nacked, isn't acked within the server's ack timeout or the
+// client disconnects first.
+type Message struct {
+	Body    string
+	Seq     uint64
+	Group   string
+	Headers map[string]string
+	// The queue the message was delivered from, empty for the default queue
+	Queue string
+
+	// The link the message was delivered on, it's settled on the same one
+	link *link
+	// The consumer span started for it when tracing is enabled
+	span trace.SpanContext
+}
+
+// Pops the next message from the queue, the message must be acked
+func (c *Client) PopMessage(ctx context.Context, opts ...Option) (*Message, error) {
+	cmd, err := command.Build(command.Pop)
+	if err != nil {
+		return nil, err
+	}
+	cmd = apply(cmd, opts).With("ack", "true")
+	l := c.pick()
+	out, err := c.pop(ctx, l, cmd)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := toMessage(cmd, *out)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToPop, err)
+	}
+	msg.link = l
+	if c.receive != nil {
+		msg.span = c.receive(ctx, cmd, *out)
+	}
+	return &msg, nil
+}
+
+// Consumes messages from the queue, each message must be acked. The channel is
+// closed once the consumer stops.
+func (c *Client) ConsumeMessages(ctx context.Context, opts ...Option) (<-chan Message, error) {
+	cmd, err := command.Build(command.Consume)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToConsume, err)
+	}
+	cmd = apply(cmd, opts).With("ack", "true")
+	resps, err := c.consume(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Message, 100)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp, ok := <-resps:
+				if !ok {
+					return
+				}
+				msg, err := toMessage(cmd, resp.Response)
+				if err != nil {
+					continue
+				}
+				msg.link = resp.link
+				msg.span = resp.span
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Removes the message from the queue once it has been processed
+func (c *Client) Ack(ctx context.Context, msg Message) error {
+	return c.settle(ctx, command.Ack, msg, nil)
+}
+
+// Puts the message back on the queue so it is delivered again
+func (c *Client) Nack(ctx context.Context, msg Message) error {
+	return c.settle(ctx, command.Nack, msg, nil)
+}
+
+// Puts the message back on the queue once the delay has passed, it isn't
+// delivered again in the meantime and its group waits for it
+func (c *Client) NackAfter(ctx context.Context, msg Message, delay time.Duration) error {
+	return c.settle(ctx, command.Nack, msg, map[string]string{"delay": delay.String()})
+}
+
+func (c *Client) settle(ctx context.Context, keyword command.Keyword, msg Message, opts map[string]string) error {
+	cmd, err := command.Build(keyword, strconv.FormatUint(msg.Seq, 10))
+	if err != nil {
+		return err
+	}
+	for k, v := range opts {
+		cmd = cmd.With(k, v)
+	}
+	if msg.Queue != "" {
+		cmd = cmd.With("queue", msg.Queue)
+	}
+	out, err := c.sendOn(ctx, msg.link, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToAck, err)
+	}
+	return nil
+}
+
+func toMessage(cmd command.Command, resp response.Response) (Message, error) {
+	seq, err := strconv.ParseUint(resp.Meta["seq"], 10, 64)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: missing sequence number", response.ErrInvalidFormat)
+	}
+	return Message{
+		Body:    resp.Message,
+		Seq:     seq,
+		Group:   resp.Meta["group"],
+		Headers: headers(resp.Meta),
+		Queue:   cmd.Option("queue"),
+	}, nil
+}
+
+func headers(meta map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range meta {
+		name, ok := strings.CutPrefix(k, headerPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[name] = v
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package sdk
+
+import (
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+// Sets an option on the command sent to the server
+type Option func(command.Command) command.Command
+
+// Sends the command to the named queue instead of the default queue
+func WithQueue(name string) Option {
+	return func(cmd command.Command) command.Command {
+		return cmd.With("queue", name)
+	}
+}
+
+// Expires the pushed message if it hasn't been consumed within the ttl
+func WithTTL(ttl time.Duration) Option {
+	return func(cmd command.Command) command.Command {
+		return cmd.With("ttl", ttl.String())
+	}
+}
+
+// Sets the dedup key of the pushed message, pushes with the same key within the
+// server's dedup window are only enqueued once so they can be safely retried
+func WithDedupKey(key string) Option {
+	return func(cmd command.Command) command.Command {
+		return cmd.With("dedup", key)
+	}
+}
+
+// Pushes the message to the group, messages in a group are delivered in order
+// and one at a time to consumers that ack them
+func WithGroup(group string) Option {
+	return func(cmd command.Command) command.Command {
+		return cmd.With("group", group)
+	}
+}
+
+// Sets a header on the pushed or published message, bindings can route
+// published messages by their headers
+func WithHeader(key, value string) Option {
+	return func(cmd command.Command) command.Command {
+		return cmd.With(headerPrefix+key, value)
+	}
+}
+
+// Options prefixed with this set a header on the message
+const headerPrefix = "header."
+
+func apply(cmd command.Command, opts []Option) command.Command {
+	for _, opt := range opts {
+		cmd = opt(cmd)
+	}
+	return cmd
+}
@@ -0,0 +1,36 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestABlockedPushDoesNotStopTheSessionReading(t *testing.T) {
+	srv := sdktest.NewServer(t, sdktest.WithConfig(func(c *config.Config) {
+		c.Queue.Limits.MaxLength = 1
+		c.Queue.Limits.Overflow = "block"
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	require.Nil(t, client.Push(ctx, "first"))
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- client.Push(ctx, "second")
+	}()
+
+	// The pop on the same session makes space for the blocked push
+	time.Sleep(time.Millisecond * 50)
+	popped, err := client.Pop(ctx)
+	require.Nil(t, err)
+	require.Equal(t, "first", popped)
+
+	require.Nil(t, <-blocked)
+	require.Equal(t, uint(1), srv.Len(""))
+}
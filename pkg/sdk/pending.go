@@ -0,0 +1,149 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// The number of shards in the pending table, ids are spread over them by
+// their last byte which is random for v4 uuids
+const pendingShards = 64
+
+// Buffered channels for single responses, reused between commands to avoid
+// allocating one per call
+var waiterPool = sync.Pool{
+	New: func() any {
+		return make(chan response.Response, 1)
+	},
+}
+
+type waiter struct {
+	ch chan response.Response
+	// The link the command was sent on
+	link *link
+	// Closed when a stream stops listening, nil for single responses
+	done chan struct{}
+}
+
+// The commands waiting for responses, sharded so concurrent commands rarely
+// contend on the same lock
+type pending struct {
+	shards [pendingShards]pendingShard
+}
+
+type pendingShard struct {
+	mu      sync.Mutex
+	waiters map[uuid.UUID]waiter
+}
+
+func newPending() *pending {
+	p := &pending{}
+	for i := range p.shards {
+		p.shards[i].waiters = make(map[uuid.UUID]waiter)
+	}
+	return p
+}
+
+func (p *pending) shard(id uuid.UUID) *pendingShard {
+	return &p.shards[int(id[15])%pendingShards]
+}
+
+// Waits for a single response to the command, the channel must be given back
+// with release
+func (p *pending) wait(id uuid.UUID, l *link) chan response.Response {
+	ch := waiterPool.Get().(chan response.Response)
+	s := p.shard(id)
+	s.mu.Lock()
+	s.waiters[id] = waiter{ch: ch, link: l}
+	s.mu.Unlock()
+	return ch
+}
+
+// Stops waiting for the response and returns the channel to the pool
+func (p *pending) release(id uuid.UUID, ch chan response.Response) {
+	s := p.shard(id)
+	s.mu.Lock()
+	delete(s.waiters, id)
+	s.mu.Unlock()
+	// Responses are delivered under the shard lock, so one that arrived
+	// before we removed the waiter is already buffered
+	select {
+	case <-ch:
+	default:
+	}
+	waiterPool.Put(ch)
+}
+
+// Listens for every response to the command until it's cancelled
+func (p *pending) stream(id uuid.UUID, size int, l *link) chan response.Response {
+	ch := make(chan response.Response, size)
+	s := p.shard(id)
+	s.mu.Lock()
+	s.waiters[id] = waiter{ch: ch, link: l, done: make(chan struct{})}
+	s.mu.Unlock()
+	return ch
+}
+
+// Stops listening to the stream, unblocking a delivery waiting on it
+func (p *pending) cancel(id uuid.UUID) {
+	s := p.shard(id)
+	s.mu.Lock()
+	w, ok := s.waiters[id]
+	delete(s.waiters, id)
+	s.mu.Unlock()
+	if ok && w.done != nil {
+		close(w.done)
+	}
+}
+
+// Hands the response to whoever is waiting for it. Delivering to a full stream
+// blocks until it's read or cancelled, which stops the client reading from the
+// connection and pushes back on the server.
+func (p *pending) deliver(resp response.Response) bool {
+	s := p.shard(resp.ID)
+	s.mu.Lock()
+	w, ok := s.waiters[resp.ID]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	if w.done == nil {
+		delete(s.waiters, resp.ID)
+		select {
+		case w.ch <- resp:
+		default:
+		}
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+
+	select {
+	case w.ch <- resp:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// Responds to every command waiting on the link with the error and forgets
+// them, apart from those kept
+func (p *pending) fail(l *link, err error, keep func(uuid.UUID) bool) {
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		for id, w := range s.waiters {
+			if w.link != l || keep(id) {
+				continue
+			}
+			select {
+			case w.ch <- response.BuildError(id, err):
+			default:
+			}
+			delete(s.waiters, id)
+		}
+		s.mu.Unlock()
+	}
+}
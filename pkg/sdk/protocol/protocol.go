@@ -0,0 +1,60 @@
+// Package protocol holds the versions of the wire protocol, which the client
+// and server agree on in the websocket handshake
+package protocol
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Version int
+
+const (
+	// Args, options and metadata are written as they are, so they can't
+	// contain the separators of the protocol
+	V1 Version = 1
+	// Args, options and metadata are percent-encoded, so bodies and values
+	// can contain the separators of the protocol
+	V2 Version = 2
+
+	Latest = V2
+)
+
+// The header a client asks for a version in, the server answers with the
+// version it will speak. Peers that don't send it speak V1.
+const Header = "X-Orderly-Protocol"
+
+var replacer = strings.NewReplacer("%", "%25", ":", "%3A", "=", "%3D")
+
+// Returns the version in the header, V1 when it is missing or invalid. Versions
+// newer than this one knows are lowered to the latest it speaks.
+func FromHeader(h http.Header) Version {
+	v, err := strconv.Atoi(h.Get(Header))
+	if err != nil || Version(v) < V1 {
+		return V1
+	}
+	return min(Version(v), Latest)
+}
+
+// Sets the version in the header
+func (v Version) Set(h http.Header) {
+	h.Set(Header, strconv.Itoa(int(v)))
+}
+
+// Encodes a part of a command or response for the version
+func (v Version) Escape(s string) string {
+	if v < V2 || !strings.ContainsAny(s, "%:=") {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// Decodes a part of a command or response for the version
+func (v Version) Unescape(s string) (string, error) {
+	if v < V2 || !strings.Contains(s, "%") {
+		return s, nil
+	}
+	return url.PathUnescape(s)
+}
@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestItRoundTrips(t *testing.T) {
+	for _, s := range []string{"", "apple", "a::b", "100%", "key=value", `{"a":"b::c"}`, "%3A"} {
+		escaped := V2.Escape(s)
+		require.NotContains(t, escaped, ":")
+		require.NotContains(t, escaped, "=")
+		out, err := V2.Unescape(escaped)
+		require.Nil(t, err)
+		require.Equal(t, s, out)
+	}
+}
+
+func TestItRejectsInvalidEscapes(t *testing.T) {
+	_, err := V2.Unescape("100%")
+	require.Error(t, err)
+}
+
+func TestTheFirstVersionLeavesPartsAsTheyAre(t *testing.T) {
+	for _, s := range []string{"100%", "%3A", "key=value"} {
+		require.Equal(t, s, V1.Escape(s))
+		out, err := V1.Unescape(s)
+		require.Nil(t, err)
+		require.Equal(t, s, out)
+	}
+}
+
+func TestItReadsTheVersionFromTheHeader(t *testing.T) {
+	h := http.Header{}
+	require.Equal(t, V1, FromHeader(h))
+
+	V2.Set(h)
+	require.Equal(t, V2, FromHeader(h))
+
+	h.Set(Header, "99")
+	require.Equal(t, Latest, FromHeader(h))
+	h.Set(Header, "bongo")
+	require.Equal(t, V1, FromHeader(h))
+}
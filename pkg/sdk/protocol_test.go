@@ -0,0 +1,87 @@
+package sdk_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchesRejectOptionsThatCannotApplyToEveryItem(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	job := func(cmd command.Command) command.Command {
+		return cmd.With("job", "true")
+	}
+	for _, opt := range []sdk.Option{sdk.WithDedupKey("order-1"), job} {
+		_, err := client.PushBatch(ctx, []string{"apple", "banana"}, opt)
+		require.ErrorContains(t, err, "batch does not support dedup or job")
+	}
+	require.Equal(t, uint(0), srv.Len(""))
+}
+
+func TestBodiesCanContainTheProtocolSeparators(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	bodies := []string{"hi::queue=other", "a::b", `{"a":"b::c"}`, "100%"}
+	for _, body := range bodies {
+		require.Nil(t, client.Push(ctx, body, sdk.WithHeader("reason", "x::y")))
+	}
+	srv.AssertPushed(t, "", bodies...)
+	require.Equal(t, uint(0), srv.Len("other"))
+
+	for _, body := range bodies {
+		msg, err := client.PopMessage(ctx)
+		require.Nil(t, err)
+		require.Equal(t, body, msg.Body)
+		require.Equal(t, map[string]string{"reason": "x::y"}, msg.Headers)
+		require.Nil(t, client.Ack(ctx, *msg))
+	}
+}
+
+func TestClientsThatDoNotAskForAVersionAreNotEscaped(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+	require.Equal(t, protocol.V1, protocol.FromHeader(resp.Header))
+
+	roundTrip := func(cmd command.Command) response.Response {
+		require.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte(cmd.String())))
+		_, msg, err := conn.ReadMessage()
+		require.Nil(t, err)
+		out, err := response.Parse(string(msg))
+		require.Nil(t, err)
+		return out
+	}
+
+	for _, body := range []string{"100%", "%3A"} {
+		push, err := command.Build(command.Push, body)
+		require.Nil(t, err)
+		require.Nil(t, roundTrip(push).Err())
+	}
+	srv.AssertPushed(t, "", "100%", "%3A")
+
+	for _, body := range []string{"100%", "%3A"} {
+		pop, err := command.Build(command.Pop)
+		require.Nil(t, err)
+		require.Equal(t, body, roundTrip(pop).Message)
+	}
+}
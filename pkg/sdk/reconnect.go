@@ -0,0 +1,309 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// The state of the client's connection to the server
+type State string
+
+var (
+	StateConnected    State = "connected"
+	StateReconnecting State = "reconnecting"
+	StateClosed       State = "closed"
+)
+
+type ReconnectConfig struct {
+	// Reconnect when the connection drops rather than closing the client
+	Enabled bool
+
+	// The backoff before the first attempt, doubled after each failed
+	// attempt up to the max. Each backoff is jittered by up to half.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// The number of failed attempts before the client gives up and closes, 0
+	// retries until the client is closed
+	MaxAttempts int
+}
+
+func (r ReconnectConfig) withDefaults() ReconnectConfig {
+	if r.MinBackoff == 0 {
+		r.MinBackoff = time.Millisecond * 100
+	}
+	if r.MaxBackoff == 0 {
+		r.MaxBackoff = time.Second * 30
+	}
+	return r
+}
+
+// Returns the backoff before the attempt, attempts start at 0
+func (r ReconnectConfig) backoff(attempt int) time.Duration {
+	wait := r.MaxBackoff
+	if attempt < 32 {
+		wait = min(r.MinBackoff<<attempt, r.MaxBackoff)
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// Returns the current state of the connection
+func (c *Client) State() State {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(state State) {
+	c.stateMutex.Lock()
+	if c.state == state || c.state == StateClosed {
+		c.stateMutex.Unlock()
+		return
+	}
+	c.state = state
+	c.stateMutex.Unlock()
+
+	if c.metrics.ConnectedGauge != nil {
+		if state == StateConnected {
+			c.metrics.ConnectedGauge.Set(1)
+		} else {
+			c.metrics.ConnectedGauge.Set(0)
+		}
+	}
+	if c.onStateChange != nil {
+		c.onStateChange(state)
+	}
+}
+
+// Connects to the url, returning the version of the protocol the server agreed
+// to speak
+func (c *Client) dial(ctx context.Context, url string) (*websocket.Conn, *corkedConn, protocol.Version, error) {
+	var cork *corkedConn
+	dialer := *websocket.DefaultDialer
+	dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		cork = newCorkedConn(conn)
+		return cork, nil
+	}
+	header := make(http.Header)
+	protocol.Latest.Set(header)
+	ws, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	// The read fails after the server closes the connection, which
+	// reconnects or closes the link
+	ws.SetCloseHandler(func(code int, text string) error {
+		return nil
+	})
+	return ws, cork, protocol.FromHeader(resp.Header), nil
+}
+
+// Connects the link to the first of its endpoints that accepts the connection
+func (c *Client) connect(ctx context.Context, l *link) error {
+	var err error
+	for range l.urls {
+		url := l.url()
+		var ws *websocket.Conn
+		var cork *corkedConn
+		var v protocol.Version
+		ws, cork, v, err = c.dial(ctx, url)
+		if err != nil {
+			c.unhealthy(url, err)
+			l.rotate()
+			continue
+		}
+		c.attach(ctx, l, ws, cork, v)
+		c.healthy(url)
+		return nil
+	}
+	return err
+}
+
+// Swaps the link's connection for the new one and starts reading from it
+func (c *Client) attach(ctx context.Context, l *link, ws *websocket.Conn, cork *corkedConn, v protocol.Version) {
+	l.tx.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.conn = ws
+	l.cork = cork
+	l.version = v
+	c.discard(l)
+	l.tx.Unlock()
+	l.setState(StateConnected)
+	go c.read(ctx, l, ws, v)
+}
+
+// Called when the link's connection drops, fails the commands waiting for a
+// response on it and reconnects if enabled
+func (c *Client) disconnected(ctx context.Context, l *link, err error) {
+	if c.isClosed() || ctx.Err() != nil {
+		return
+	}
+	c.unhealthy(l.url(), err)
+	if c.reconnect.Enabled {
+		l.setState(StateReconnecting)
+	} else {
+		l.setState(StateClosed)
+	}
+	c.failPending(l)
+	c.resetReplies(l)
+	c.refreshState()
+	if c.reconnect.Enabled {
+		c.redial(ctx, l)
+	}
+}
+
+// Reconnects the link with a backoff, failover links try their next endpoint
+// on each attempt
+func (c *Client) redial(ctx context.Context, l *link) {
+	for attempt := 0; c.reconnect.MaxAttempts == 0 || attempt < c.reconnect.MaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.closed:
+			return
+		case <-time.After(c.reconnect.backoff(attempt)):
+		}
+
+		url := l.rotate()
+		ws, cork, v, err := c.dial(ctx, url)
+		if err != nil {
+			c.unhealthy(url, err)
+			continue
+		}
+		c.attach(ctx, l, ws, cork, v)
+		c.healthy(url)
+		if c.metrics.ReconnectCounter != nil {
+			c.metrics.ReconnectCounter.Inc()
+		}
+		c.refreshState()
+		c.resubscribe(l)
+		return
+	}
+	l.setState(StateClosed)
+	c.refreshState()
+}
+
+// Sets the state of the client from its links, it's connected while any link
+// is and closes once they all have
+func (c *Client) refreshState() {
+	state := StateClosed
+	for _, l := range c.links {
+		switch l.State() {
+		case StateConnected:
+			state = StateConnected
+		case StateReconnecting:
+			if state != StateConnected {
+				state = StateReconnecting
+			}
+		}
+	}
+	if state == StateClosed {
+		c.Close()
+		return
+	}
+	c.setState(state)
+}
+
+// Responds to every command still waiting for a response on the link with a
+// retriable error, the responses to them are lost with the connection
+func (c *Client) failPending(l *link) {
+	c.consumerMutex.Lock()
+	defer c.consumerMutex.Unlock()
+	c.pending.fail(l, ErrDisconnected, func(id uuid.UUID) bool {
+		_, ok := c.consumers[id]
+		return ok
+	})
+}
+
+// Sends the commands of the link's consumers on its new connection
+func (c *Client) resubscribe(l *link) {
+	c.consumerMutex.Lock()
+	cmds := make([]command.Command, 0, len(c.consumers))
+	for id, sub := range c.consumers {
+		if sub.link != l {
+			continue
+		}
+		c.resubscribing[id] = struct{}{}
+		cmds = append(cmds, sub.cmd)
+	}
+	c.consumerMutex.Unlock()
+
+	for _, cmd := range cmds {
+		if err := c.transmit(l, cmd); err != nil {
+			// Stops the consumer with the error, the same as the server
+			// refusing it
+			c.pending.deliver(response.BuildError(cmd.ID, fmt.Errorf("%w: %w", ErrFailedToConsume, err)))
+		}
+	}
+}
+
+// Whether the response is the acknowledgement of a consumer's command that was
+// resent on reconnecting, which is dropped. Errors are handed to the consumer.
+func (c *Client) resubscribed(resp response.Response) bool {
+	c.consumerMutex.Lock()
+	defer c.consumerMutex.Unlock()
+	if len(c.resubscribing) == 0 {
+		return false
+	}
+	if _, ok := c.resubscribing[resp.ID]; !ok {
+		return false
+	}
+	delete(c.resubscribing, resp.ID)
+	return resp.Err() == nil && resp.Message == "ok"
+}
+
+// Stops resubscribing the consumer, the server has refused it or it couldn't
+// be sent
+func (c *Client) forget(id uuid.UUID) {
+	c.consumerMutex.Lock()
+	defer c.consumerMutex.Unlock()
+	delete(c.consumers, id)
+	delete(c.resubscribing, id)
+}
+
+// The reply queue belonged to the link's old session, so requests waiting on
+// it will never get their reply
+func (c *Client) resetReplies(l *link) {
+	c.replyMutex.Lock()
+	defer c.replyMutex.Unlock()
+	if c.replyLink != l {
+		return
+	}
+	c.replyLink = nil
+	if c.replyCancel != nil {
+		c.replyCancel()
+		c.replyCancel = nil
+	}
+	// Cancelling stops the consumer in the background, forget it now so the
+	// link doesn't resubscribe to the old queue when it reconnects
+	c.forget(c.replyConsumer)
+	c.replyConsumer = uuid.Nil
+	c.replyQueue = ""
+	for correlation, reply := range c.replies {
+		close(reply)
+		delete(c.replies, correlation)
+	}
+}
+
+// Whether the error is from the connection dropping, the command can be
+// retried once the client has reconnected
+func IsRetriable(err error) bool {
+	return errors.Is(err, ErrDisconnected)
+}
@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestItBacksOffExponentiallyWithJitter(t *testing.T) {
+	conf := ReconnectConfig{MinBackoff: time.Millisecond * 100, MaxBackoff: time.Second}
+
+	for attempt, limit := range []time.Duration{
+		time.Millisecond * 100,
+		time.Millisecond * 200,
+		time.Millisecond * 400,
+		time.Millisecond * 800,
+		time.Second,
+		time.Second,
+	} {
+		for range 100 {
+			wait := conf.backoff(attempt)
+			require.GreaterOrEqual(t, wait, limit/2)
+			require.LessOrEqual(t, wait, limit)
+		}
+	}
+	require.LessOrEqual(t, conf.backoff(100), time.Second)
+}
+
+func TestTheReplyQueueIsNotResubscribedWhenTheLinkReconnects(t *testing.T) {
+	srv := echoServer(t)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	client, err := NewClient(ctx, ClientConfig{Endpoint: srv.URL})
+	require.Nil(t, err)
+	defer client.Close()
+
+	_, l, err := client.replyTo(ctx)
+	require.Nil(t, err)
+	client.consumerMutex.Lock()
+	require.Len(t, client.consumers, 1)
+	client.consumerMutex.Unlock()
+
+	client.resetReplies(l)
+	client.consumerMutex.Lock()
+	defer client.consumerMutex.Unlock()
+	require.Empty(t, client.consumers)
+}
@@ -0,0 +1,160 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+const (
+	// The header that holds the queue the reply to a request is pushed to
+	HeaderReplyTo = "reply_to"
+	// The header that holds the id that matches a reply to its request
+	HeaderCorrelationID = "correlation_id"
+)
+
+// Pushes the message with a reply to address and correlation id, then waits
+// for the reply. Replies are pushed to a temporary queue that the server
+// removes when the client disconnects. The wait is bounded by the context's
+// deadline, or the client's request timeout when it has none.
+func (c *Client) Request(ctx context.Context, data string, opts ...Option) (Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.requestTimeout)
+		defer cancel()
+	}
+
+	replyTo, l, err := c.replyTo(ctx)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, err)
+	}
+	correlation := id.String()
+	reply := make(chan Message, 1)
+	c.replyMutex.Lock()
+	c.replies[correlation] = reply
+	c.replyMutex.Unlock()
+	defer func() {
+		c.replyMutex.Lock()
+		delete(c.replies, correlation)
+		c.replyMutex.Unlock()
+	}()
+
+	opts = append(opts, WithHeader(HeaderReplyTo, replyTo), WithHeader(HeaderCorrelationID, correlation))
+	cmd, err := command.Build(command.Push, data)
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, err)
+	}
+	// The reply queue only exists on the server it was created on, so the
+	// request is pushed there for the reply to find it
+	if _, err := c.push(ctx, l, apply(cmd, opts)); err != nil {
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, ctx.Err())
+	case <-c.closed:
+		return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, ErrClosed)
+	case msg, ok := <-reply:
+		if !ok {
+			return Message{}, fmt.Errorf("%w: %w", ErrFailedToRequest, ErrDisconnected)
+		}
+		return msg, nil
+	}
+}
+
+// Pushes the reply to the queue the request asked for replies on
+func (c *Client) Reply(ctx context.Context, request Message, data string) error {
+	replyTo := request.Headers[HeaderReplyTo]
+	if replyTo == "" {
+		return ErrNoReplyTo
+	}
+	cmd, err := command.Build(command.Push, data)
+	if err != nil {
+		return err
+	}
+	// Pushed to the server the request was delivered from, which holds the
+	// reply queue
+	_, err = c.push(ctx, request.link, apply(
+		cmd,
+		[]Option{
+			WithQueue(replyTo),
+			WithHeader(HeaderCorrelationID, request.Headers[HeaderCorrelationID]),
+		},
+	))
+	return err
+}
+
+// Returns the name of the temporary queue replies are pushed to and the link
+// it was created on, consuming from it the first time
+func (c *Client) replyTo(ctx context.Context) (string, *link, error) {
+	c.replyMutex.Lock()
+	defer c.replyMutex.Unlock()
+	if c.replyQueue != "" {
+		return c.replyQueue, c.replyLink, nil
+	}
+
+	cmd, err := command.Build(command.Temporary)
+	if err != nil {
+		return "", nil, err
+	}
+	l := c.pick()
+	out, err := c.sendOn(ctx, l, cmd)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := out.Err(); err != nil {
+		return "", nil, err
+	}
+	name := out.Message
+
+	cmd, err = command.Build(command.Consume)
+	if err != nil {
+		return "", nil, err
+	}
+	cmd = cmd.With("queue", name)
+	// The queue is removed when the session ends, so consuming from it stops
+	// when the client reconnects
+	consumeCtx, cancel := context.WithCancel(c.ctx)
+	resps, err := c.consumeOn(consumeCtx, []*link{l}, cmd)
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+	c.replyCancel = cancel
+	c.replyConsumer = cmd.ID
+	go func() {
+		for {
+			select {
+			case <-consumeCtx.Done():
+				return
+			case resp, ok := <-resps:
+				if !ok {
+					return
+				}
+				msg := Message{Body: resp.Message, Headers: headers(resp.Meta), Queue: name}
+				// Sent with the lock held as the reply channels are closed
+				// under it when the client reconnects
+				c.replyMutex.Lock()
+				if reply, ok := c.replies[msg.Headers[HeaderCorrelationID]]; ok {
+					select {
+					case reply <- msg:
+					default:
+					}
+				}
+				c.replyMutex.Unlock()
+			}
+		}
+	}()
+
+	c.replyQueue = name
+	c.replyLink = l
+	return name, l, nil
+}
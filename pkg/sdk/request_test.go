@@ -0,0 +1,97 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+// Replies to every request on the requests queue, sending each request it
+// handles on the channel
+func responder(ctx context.Context, t *testing.T, srv *sdktest.Server) <-chan sdk.Message {
+	client := srv.Client(ctx)
+	msgs, err := client.ConsumeMessages(ctx, sdk.WithQueue("requests"))
+	require.Nil(t, err)
+	requests := make(chan sdk.Message, 10)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-msgs:
+				requests <- msg
+				client.Reply(ctx, msg, "reply to "+msg.Body)
+				client.Ack(ctx, msg)
+			}
+		}
+	}()
+	return requests
+}
+
+func TestItRepliesToRequests(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	requests := responder(ctx, t, srv)
+	client := srv.Client(ctx)
+
+	reply, err := client.Request(ctx, "hello", sdk.WithQueue("requests"))
+	require.Nil(t, err)
+	require.Equal(t, "reply to hello", reply.Body)
+
+	request := <-requests
+	require.Equal(t, request.Headers[sdk.HeaderCorrelationID], reply.Headers[sdk.HeaderCorrelationID])
+	require.Contains(t, srv.Queues(), request.Headers[sdk.HeaderReplyTo])
+
+	// The reply queue is removed when the requester disconnects
+	require.Nil(t, client.Close())
+	require.Eventually(t, func() bool {
+		for _, name := range srv.Queues() {
+			if name == request.Headers[sdk.HeaderReplyTo] {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestRequestsTimeOutWithoutAReply(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	timeout, cancelTimeout := context.WithTimeout(ctx, time.Millisecond*100)
+	defer cancelTimeout()
+	_, err := client.Request(timeout, "hello", sdk.WithQueue("requests"))
+	require.ErrorIs(t, err, sdk.ErrFailedToRequest)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	srv.AssertPushed(t, "requests", "hello")
+}
+
+func TestPendingRequestsFailWhenTheClientReconnects(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Reconnect: sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+	})
+
+	failed := make(chan error, 1)
+	go func() {
+		_, err := client.Request(ctx, "hello", sdk.WithQueue("requests"))
+		failed <- err
+	}()
+	require.Eventually(t, func() bool {
+		return len(srv.Pushed("requests")) == 1
+	}, time.Second, time.Millisecond*10)
+
+	srv.Disconnect()
+	err := <-failed
+	require.ErrorIs(t, err, sdk.ErrFailedToRequest)
+	require.ErrorIs(t, err, sdk.ErrDisconnected)
+}
@@ -3,20 +3,36 @@ package response
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
 )
 
 var (
 	ErrInvalidFormat = errors.New("the response is in an unrecognisable format")
 	ErrInvalidID     = errors.New("id could not be parsed or is invalid")
+
+	ErrQueueFull  = errors.New("queue is full")
+	ErrJobMissing = errors.New("job does not exist")
+	ErrJobNotDone = errors.New("job has not finished")
 )
 
+// Errors that are returned to clients as themselves rather than as a plain
+// message, so they can be matched with errors.Is
+var known = []error{
+	ErrQueueFull,
+	ErrJobMissing,
+	ErrJobNotDone,
+}
+
 type Response struct {
 	ID      uuid.UUID
 	Message string
 	Error   error
+	// Metadata about the message, written after it in the form key=value
+	Meta map[string]string
 }
 
 func (r Response) Err() error {
@@ -41,17 +57,49 @@ func Error(id uuid.UUID, err error) Response {
 	return BuildError(id, err)
 }
 
+// Returns a copy of the response with the metadata set
+func (r Response) With(key, value string) Response {
+	meta := make(map[string]string, len(r.Meta)+1)
+	for k, v := range r.Meta {
+		meta[k] = v
+	}
+	meta[key] = value
+	r.Meta = meta
+	return r
+}
+
+// Encodes the response in the first version of the protocol
 func (r Response) String() string {
+	return r.Encode(protocol.V1)
+}
+
+// Encodes the response in the version of the protocol
+func (r Response) Encode(v protocol.Version) string {
 	if r.Error != nil {
-		return fmt.Sprintf("%s::error%s", r.ID, r.Error.Error())
+		return fmt.Sprintf("%s::error::%s", r.ID, v.Escape(r.Error.Error()))
+	}
+	out := fmt.Sprintf("%s::%s", r.ID, v.Escape(r.Message))
+	keys := make([]string, 0, len(r.Meta))
+	for k := range r.Meta {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		out = fmt.Sprintf("%s::%s=%s", out, v.Escape(k), v.Escape(r.Meta[k]))
 	}
-	return fmt.Sprintf("%s::%s", r.ID, r.Message)
+	return out
 }
 
+// Parses a response in the first version of the protocol
 func Parse(resp string) (Response, error) {
+	return ParseVersion(resp, protocol.V1)
+}
+
+// Parses a response in the version of the protocol, decoding its message and
+// metadata
+func ParseVersion(resp string, v protocol.Version) (Response, error) {
 	spl := strings.Split(resp, "::")
-	if len(spl) != 2 && len(spl) != 3 {
-		fmt.Println(resp)
+	if len(spl) < 2 {
 		return Response{}, ErrInvalidFormat
 	}
 
@@ -61,7 +109,50 @@ func Parse(resp string) (Response, error) {
 	}
 
 	if spl[1] == "error" {
-		return BuildError(id, fmt.Errorf("%s", spl[2])), nil
+		if len(spl) != 3 {
+			return Response{}, ErrInvalidFormat
+		}
+		msg, err := v.Unescape(spl[2])
+		if err != nil {
+			return Response{}, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+		return BuildError(id, ParseError(msg)), nil
+	}
+
+	msg, err := v.Unescape(spl[1])
+	if err != nil {
+		return Response{}, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+	}
+	out := Build(id, msg)
+	for _, part := range spl[2:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key == "" {
+			return Response{}, ErrInvalidFormat
+		}
+		if key, err = v.Unescape(key); err != nil {
+			return Response{}, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+		if value, err = v.Unescape(value); err != nil {
+			return Response{}, fmt.Errorf("%w: %w", ErrInvalidFormat, err)
+		}
+		if out.Meta == nil {
+			out.Meta = map[string]string{}
+		}
+		out.Meta[key] = value
+	}
+	return out, nil
+}
+
+// Returns the error in the message, known errors are wrapped so they can be
+// matched with errors.Is
+func ParseError(msg string) error {
+	for _, err := range known {
+		if msg == err.Error() {
+			return err
+		}
+		if rest, ok := strings.CutPrefix(msg, err.Error()+": "); ok {
+			return fmt.Errorf("%w: %s", err, rest)
+		}
 	}
-	return Build(id, spl[1]), nil
+	return fmt.Errorf("%s", msg)
 }
@@ -1,10 +1,12 @@
 package response_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
 	"github.com/orderly-queue/orderly/pkg/sdk/response"
 	"github.com/stretchr/testify/require"
 )
@@ -44,6 +46,20 @@ func TestItParsesResponses(t *testing.T) {
 				Error: fmt.Errorf("%s", "some error"),
 			},
 		},
+		{
+			name:     "parses response with metadata",
+			response: fmt.Sprintf("%s::apple::group=a::seq=12", id.String()),
+			expected: response.Response{
+				ID:      id,
+				Message: "apple",
+				Meta:    map[string]string{"group": "a", "seq": "12"},
+			},
+		},
+		{
+			name:     "errors when parsing invalid metadata",
+			response: fmt.Sprintf("%s::apple::bongo", id.String()),
+			errors:   true,
+		},
 		{
 			name:     "errors when parsing invalid id format",
 			response: "error::bongo",
@@ -66,6 +82,43 @@ func TestItParsesResponses(t *testing.T) {
 			require.Equal(t, c.expected.ID, resp.ID)
 			require.Equal(t, c.expected.Message, resp.Message)
 			require.Equal(t, c.expected.Error, resp.Error)
+			require.Equal(t, c.expected.Meta, resp.Meta)
 		})
 	}
 }
+
+func TestItParsesKnownErrors(t *testing.T) {
+	id := uuid.New()
+
+	resp, err := response.Parse(response.Error(id, response.ErrQueueFull).String())
+	require.Nil(t, err)
+	require.ErrorIs(t, resp.Err(), response.ErrQueueFull)
+
+	resp, err = response.Parse(response.Error(id, fmt.Errorf("%w: context deadline exceeded", response.ErrQueueFull)).String())
+	require.Nil(t, err)
+	require.ErrorIs(t, resp.Err(), response.ErrQueueFull)
+	require.Equal(t, "queue is full: context deadline exceeded", resp.Err().Error())
+
+	resp, err = response.Parse(response.Error(id, errors.New("bongo")).String())
+	require.Nil(t, err)
+	require.NotErrorIs(t, resp.Err(), response.ErrQueueFull)
+}
+
+func TestItEscapesMessagesAndMeta(t *testing.T) {
+	id := uuid.New()
+
+	for _, body := range []string{"hi::seq=1", "a::b", `{"a":"b::c"}`, "100%"} {
+		resp, err := response.ParseVersion(response.Build(id, body).With("header.reason", "x::y").Encode(protocol.V2), protocol.V2)
+		require.Nil(t, err)
+		require.Equal(t, body, resp.Message)
+		require.Equal(t, map[string]string{"header.reason": "x::y"}, resp.Meta)
+	}
+
+	resp, err := response.ParseVersion(response.Error(id, errors.New("failed::badly")).Encode(protocol.V2), protocol.V2)
+	require.Nil(t, err)
+	require.Equal(t, "failed::badly", resp.Err().Error())
+
+	resp, err = response.Parse(response.Build(id, "100%3A").String())
+	require.Nil(t, err)
+	require.Equal(t, "100%3A", resp.Message)
+}
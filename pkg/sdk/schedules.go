@@ -0,0 +1,100 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// What a schedule does about the runs it missed while the server was down
+type Missed string
+
+var (
+	MissedSkip    Missed = "skip"
+	MissedCatchUp Missed = "catch_up"
+)
+
+// Pushes a templated message to a queue on a cron expression
+type Schedule struct {
+	Name string `json:"name"`
+	// A standard five field cron expression
+	Cron string `json:"cron"`
+	// The queue the message is pushed to, empty for the default queue
+	Queue string `json:"queue,omitempty"`
+	// A text/template rendered with the schedule's name and the time of the
+	// run as .Name and .Time
+	Body   string `json:"body"`
+	Missed Missed `json:"missed,omitempty"`
+	// When the schedule last ran in unix nanoseconds, set by the server
+	LastRun int64 `json:"last_run,omitempty"`
+}
+
+// When the schedule last ran, the zero time if it hasn't
+func (s Schedule) LastRunTime() time.Time {
+	if s.LastRun == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, s.LastRun)
+}
+
+// Adds the schedule, replacing any schedule with the same name
+func (c *Client) Schedule(ctx context.Context, s Schedule) error {
+	cmd, err := command.Build(command.Schedule, s.Name)
+	if err != nil {
+		return err
+	}
+	cmd = cmd.With("cron", s.Cron).With("body", s.Body)
+	if s.Queue != "" {
+		cmd = cmd.With("queue", s.Queue)
+	}
+	if s.Missed != "" {
+		cmd = cmd.With("missed", string(s.Missed))
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSchedule, err)
+	}
+	return nil
+}
+
+func (c *Client) Unschedule(ctx context.Context, name string) error {
+	cmd, err := command.Build(command.Unschedule, name)
+	if err != nil {
+		return err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSchedule, err)
+	}
+	return nil
+}
+
+// Returns the schedules sorted by name
+func (c *Client) Schedules(ctx context.Context) ([]Schedule, error) {
+	cmd, err := command.Build(command.Schedules)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSchedule, err)
+	}
+	schedules := []Schedule{}
+	if err := json.Unmarshal([]byte(out.Message), &schedules); err != nil {
+		return nil, fmt.Errorf("%w: %w", response.ErrInvalidFormat, err)
+	}
+	return schedules, nil
+}
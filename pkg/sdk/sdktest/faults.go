@@ -0,0 +1,184 @@
+package sdktest
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/protocol"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+)
+
+// A fault injected into the commands clients send, before they reach the
+// queue
+type Fault struct {
+	// The command it applies to, empty applies to every command
+	Keyword command.Keyword
+
+	// Delays the command by the duration
+	Latency time.Duration
+
+	// Drops the command so it never gets a response
+	Drop bool
+
+	// Responds to the command with the error rather than running it
+	Err error
+
+	// The number of commands it applies to before it's removed, 0 applies to
+	// every command until Reset is called
+	Times int
+}
+
+// Injects the fault into the commands sent after it
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// Removes every injected fault
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Drops the connection of every client, clients reconnect if they are
+// configured to
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+// Returns the first fault that applies to the command
+func (s *Server) fault(cmd command.Command) (Fault, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, f := range s.faults {
+		if f.Keyword != "" && f.Keyword != cmd.Keyword {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return *f, true
+	}
+	return Fault{}, false
+}
+
+// A client's connection, proxied to the connect handler
+type conn struct {
+	client   *websocket.Conn
+	upstream *websocket.Conn
+	// The version of the protocol the client and connect handler agreed on
+	version protocol.Version
+
+	// Guards writes to the client, which come from the upstream and from
+	// injected errors
+	mu *sync.Mutex
+}
+
+func (c *conn) respond(msg string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+func (c *conn) close() {
+	c.client.Close()
+	c.upstream.Close()
+}
+
+func (s *Server) proxy(w http.ResponseWriter, r *http.Request) {
+	// Asks the connect handler for the client's version and answers the
+	// client with the one it agreed to
+	header := http.Header{}
+	if v := protocol.FromHeader(r.Header); v > protocol.V1 {
+		v.Set(header)
+	}
+	upstream, resp, err := websocket.DefaultDialer.DialContext(r.Context(), s.upstream, header)
+	if err != nil {
+		return
+	}
+	version := protocol.FromHeader(resp.Header)
+	header = http.Header{}
+	if version > protocol.V1 {
+		version.Set(header)
+	}
+	client, err := s.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	c := &conn{client: client, upstream: upstream, version: version, mu: &sync.Mutex{}}
+
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.close()
+	}()
+
+	go func() {
+		defer c.close()
+		for {
+			_, msg, err := upstream.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := c.respond(string(msg)); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		_, msg, err := client.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := s.forward(c, string(msg)); err != nil {
+			return
+		}
+	}
+}
+
+// Applies any fault to the command before sending it upstream
+func (s *Server) forward(c *conn, msg string) error {
+	cmd, err := command.ParseVersion(msg, c.version)
+	if err != nil {
+		// The connect handler responds with the syntax error
+		return c.upstream.WriteMessage(websocket.TextMessage, []byte(msg))
+	}
+
+	if f, ok := s.fault(cmd); ok {
+		if f.Latency > 0 {
+			time.Sleep(f.Latency)
+		}
+		if f.Drop {
+			return nil
+		}
+		if f.Err != nil {
+			return c.respond(response.BuildError(cmd.ID, f.Err).Encode(c.version))
+		}
+	}
+
+	s.record(cmd)
+	return c.upstream.WriteMessage(websocket.TextMessage, []byte(msg))
+}
@@ -0,0 +1,220 @@
+// Package sdktest runs an in-memory orderly server for testing code that uses
+// the sdk, without any storage or containers
+package sdktest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/orderly-queue/orderly/internal/app"
+	"github.com/orderly-queue/orderly/internal/http/handlers/connect"
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const headerPrefix = "header."
+
+type Option func(*config.Config)
+
+// Changes the config the server runs with, storage and snapshots are always
+// disabled
+func WithConfig(fn func(*config.Config)) Option {
+	return func(c *config.Config) {
+		fn(c)
+	}
+}
+
+// A message pushed to the server by a client
+type Pushed struct {
+	Queue   string
+	Body    string
+	Headers map[string]string
+}
+
+type Server struct {
+	// The endpoint to connect clients to
+	URL string
+
+	t   testing.TB
+	app *app.App
+
+	upstream string
+	upgrader websocket.Upgrader
+
+	mu     *sync.Mutex
+	pushed []Pushed
+	faults []*Fault
+	conns  map[*conn]struct{}
+}
+
+// Starts a server on a random port, it's stopped when the test finishes
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	conf := &config.Config{
+		Name:          "sdktest",
+		Environment:   "testing",
+		JwtSecret:     secret(t),
+		EncryptionKey: "base64:32:" + secret(t),
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	conf.Storage.Enabled = false
+	conf.Queue.Snapshot.Enabled = false
+	conf.Queue.Snapshot.Log.Enabled = false
+	conf.SetDefaults()
+	require.Nil(t, conf.Validate())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	a, err := app.New(ctx, conf)
+	require.Nil(t, err)
+	require.Nil(t, a.Scheduler.Start(ctx, a.Schedules()))
+	go a.Queues.Sweep(ctx, conf.Queue.SweepInterval)
+
+	handler := connect.NewConnect(a)
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Add(handler.Method(), handler.Path(), handler.Handler())
+	upstream := httptest.NewServer(e)
+	t.Cleanup(upstream.Close)
+
+	s := &Server{
+		t:        t,
+		app:      a,
+		upstream: "ws" + strings.TrimPrefix(upstream.URL, "http") + handler.Path(),
+		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		mu:       &sync.Mutex{},
+		conns:    make(map[*conn]struct{}),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(s.proxy))
+	t.Cleanup(srv.Close)
+	t.Cleanup(s.Disconnect)
+	s.URL = srv.URL
+
+	return s
+}
+
+// Returns a client connected to the server, it's closed when the test
+// finishes
+func (s *Server) Client(ctx context.Context, conf ...sdk.ClientConfig) *sdk.Client {
+	s.t.Helper()
+	var c sdk.ClientConfig
+	if len(conf) > 0 {
+		c = conf[0]
+	}
+	c.Endpoint = s.URL
+	client, err := sdk.NewClient(ctx, c)
+	require.Nil(s.t, err)
+	s.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Pushes the messages onto the queue, as if they were already there when the
+// test started. An empty queue is the default queue.
+func (s *Server) Seed(name string, bodies ...string) {
+	s.t.Helper()
+	q, err := s.app.Queues.Get(name)
+	require.Nil(s.t, err)
+	for _, body := range bodies {
+		require.Nil(s.t, q.PushWith(context.Background(), body, queue.PushOptions{}))
+	}
+}
+
+// Returns the number of messages waiting on the queue
+func (s *Server) Len(name string) uint {
+	s.t.Helper()
+	q, err := s.app.Queues.Get(name)
+	require.Nil(s.t, err)
+	return q.Len()
+}
+
+// Returns the names of the queues on the server, sorted
+func (s *Server) Queues() []string {
+	return s.app.Queues.Names()
+}
+
+// Returns the messages clients have pushed to the queue, in the order the
+// server received them
+func (s *Server) Pushed(name string) []Pushed {
+	if name == "" {
+		name = queue.DefaultQueue
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Pushed{}
+	for _, p := range s.pushed {
+		if p.Queue == name {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Asserts the bodies of the messages pushed to the queue
+func (s *Server) AssertPushed(t testing.TB, name string, bodies ...string) bool {
+	t.Helper()
+	pushed := []string{}
+	for _, p := range s.Pushed(name) {
+		pushed = append(pushed, p.Body)
+	}
+	if bodies == nil {
+		bodies = []string{}
+	}
+	return assert.Equal(t, bodies, pushed)
+}
+
+// Records the messages in push and batch commands
+func (s *Server) record(cmd command.Command) {
+	name := cmd.Option("queue")
+	if name == "" {
+		name = queue.DefaultQueue
+	}
+	headers := map[string]string{}
+	for k, v := range cmd.Options {
+		if key, ok := strings.CutPrefix(k, headerPrefix); ok {
+			headers[key] = v
+		}
+	}
+
+	var bodies []string
+	switch cmd.Keyword {
+	case command.Push:
+		bodies = cmd.Args[:1]
+	case command.Batch:
+		if err := json.Unmarshal([]byte(cmd.Args[0]), &bodies); err != nil {
+			return
+		}
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, body := range bodies {
+		s.pushed = append(s.pushed, Pushed{Queue: name, Body: body, Headers: headers})
+	}
+}
+
+func secret(t testing.TB) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
@@ -0,0 +1,80 @@
+package sdktest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestItRecordsPushes(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	require.Nil(t, client.Push(ctx, "first"))
+	require.Nil(t, client.Push(ctx, "second", sdk.WithQueue("emails"), sdk.WithHeader("kind", "welcome")))
+
+	srv.AssertPushed(t, "", "first")
+	srv.AssertPushed(t, "emails", "second")
+	require.Equal(t, map[string]string{"kind": "welcome"}, srv.Pushed("emails")[0].Headers)
+	require.Equal(t, uint(1), srv.Len("emails"))
+}
+
+func TestItPopsSeededMessages(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	srv.Seed("", "seeded")
+
+	out, err := client.Pop(ctx)
+	require.Nil(t, err)
+	require.Equal(t, "seeded", out)
+	srv.AssertPushed(t, "")
+}
+
+func TestItInjectsFaults(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx, sdk.ClientConfig{SendTimeout: time.Millisecond * 200})
+
+	srv.Inject(sdktest.Fault{Keyword: command.Push, Err: errors.New("boom"), Times: 1})
+	require.ErrorContains(t, client.Push(ctx, "failed"), "boom")
+	require.Nil(t, client.Push(ctx, "ok"))
+	srv.AssertPushed(t, "", "ok")
+
+	srv.Inject(sdktest.Fault{Keyword: command.Push, Drop: true})
+	require.Error(t, client.Push(ctx, "dropped"))
+	srv.Reset()
+
+	srv.Inject(sdktest.Fault{Latency: time.Millisecond * 50, Times: 1})
+	start := time.Now()
+	require.Nil(t, client.Push(ctx, "slow"))
+	require.GreaterOrEqual(t, time.Since(start), time.Millisecond*50)
+
+	srv.AssertPushed(t, "", "ok", "slow")
+}
+
+func TestClientsReconnectAfterADisconnect(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Reconnect: sdk.ReconnectConfig{Enabled: true, MinBackoff: time.Millisecond},
+	})
+
+	srv.Disconnect()
+	require.Eventually(t, func() bool {
+		return client.Push(ctx, "after") == nil
+	}, time.Second*3, time.Millisecond*10)
+	srv.AssertPushed(t, "", "after")
+}
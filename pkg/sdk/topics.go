@@ -0,0 +1,60 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+// Pushes a copy of the message to every subscription of the topic and every
+// queue of the bindings that match it, the topic is used as the routing key
+func (c *Client) Publish(ctx context.Context, topic, data string, opts ...Option) error {
+	cmd, err := command.Build(command.Publish, topic, data)
+	if err != nil {
+		return err
+	}
+	out, err := c.send(ctx, apply(cmd, opts))
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToPublish, err)
+	}
+	return nil
+}
+
+// Adds a durable subscription to the topic, returning the name of the queue
+// that messages published to the topic are pushed to. Consume from the queue
+// with WithQueue.
+func (c *Client) Subscribe(ctx context.Context, topic, subscription string) (string, error) {
+	cmd, err := command.Build(command.Subscribe, topic, subscription)
+	if err != nil {
+		return "", err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return "", err
+	}
+	if err := out.Err(); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFailedToSubscribe, err)
+	}
+	return out.Message, nil
+}
+
+// Removes the subscription from the topic, along with the messages waiting in
+// its queue
+func (c *Client) Unsubscribe(ctx context.Context, topic, subscription string) error {
+	cmd, err := command.Build(command.Unsubscribe, topic, subscription)
+	if err != nil {
+		return err
+	}
+	out, err := c.send(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if err := out.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSubscribe, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package sdk
+
+import (
+	"context"
+
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/orderly-queue/orderly/pkg/sdk"
+
+type TracingConfig struct {
+	Enabled bool
+
+	// Creates the spans, defaults to the global provider
+	TracerProvider trace.TracerProvider
+	// Writes the trace into the headers of pushed messages and reads it back
+	// on delivery, defaults to w3c trace context
+	Propagator propagation.TextMapPropagator
+}
+
+func (t TracingConfig) withDefaults() TracingConfig {
+	if t.TracerProvider == nil {
+		t.TracerProvider = otel.GetTracerProvider()
+	}
+	if t.Propagator == nil {
+		t.Propagator = propagation.TraceContext{}
+	}
+	return t
+}
+
+// The commands that put messages on a queue, they carry the producer's trace
+// in their headers
+var produces = map[command.Keyword]struct{}{
+	command.Push:    {},
+	command.Batch:   {},
+	command.Publish: {},
+}
+
+// Starts a span for each command. Messages that are pushed, batched or
+// published get the trace in their headers, so the consumer's spans can be
+// linked to it. The client adds it when tracing is enabled.
+func TracingInterceptor(conf TracingConfig) UnaryInterceptor {
+	conf = conf.withDefaults()
+	tracer := conf.TracerProvider.Tracer(tracerName)
+	return func(ctx context.Context, cmd command.Command, next Invoker) (*response.Response, error) {
+		kind := trace.SpanKindClient
+		_, produce := produces[cmd.Keyword]
+		if produce {
+			kind = trace.SpanKindProducer
+		}
+		ctx, span := tracer.Start(
+			ctx,
+			"orderly."+string(cmd.Keyword),
+			trace.WithSpanKind(kind),
+			trace.WithAttributes(cmd.Attributes()...),
+		)
+		defer span.End()
+
+		if produce {
+			carrier := propagation.MapCarrier{}
+			conf.Propagator.Inject(ctx, carrier)
+			for k, v := range carrier {
+				cmd = cmd.With(headerPrefix+k, v)
+			}
+		}
+
+		out, err := next(ctx, cmd)
+		if err == nil {
+			err = out.Err()
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return out, err
+	}
+}
+
+// Starts a consumer span for each message received, linked to the span that
+// produced it. The span is carried by the message, see Message.Context. The
+// client adds it when tracing is enabled.
+func TracingStreamInterceptor(conf TracingConfig) StreamInterceptor {
+	receive := newReceiver(conf)
+	return func(ctx context.Context, cmd command.Command, next Streamer) (<-chan Received, error) {
+		in, err := next(ctx, cmd)
+		if err != nil {
+			return nil, err
+		}
+		out := make(chan Received, cap(in))
+		go func() {
+			defer close(out)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case resp, ok := <-in:
+					if !ok {
+						return
+					}
+					resp.span = receive(ctx, cmd, resp.Response)
+					select {
+					case out <- resp:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		return out, nil
+	}
+}
+
+// Records the delivery of the response in a span of its own trace, linked to
+// the producer's
+type receiver func(ctx context.Context, cmd command.Command, resp response.Response) trace.SpanContext
+
+func newReceiver(conf TracingConfig) receiver {
+	conf = conf.withDefaults()
+	tracer := conf.TracerProvider.Tracer(tracerName)
+	return func(ctx context.Context, cmd command.Command, resp response.Response) trace.SpanContext {
+		producer := conf.Propagator.Extract(context.Background(), propagation.MapCarrier(headers(resp.Meta)))
+		_, span := tracer.Start(
+			trace.ContextWithSpanContext(ctx, trace.SpanContext{}),
+			"orderly.receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(trace.LinkFromContext(producer)),
+			trace.WithAttributes(
+				attribute.String("queue", cmd.Option("queue")),
+				attribute.String("op", "receive"),
+				attribute.Int("size", len(resp.Message)),
+			),
+		)
+		span.End()
+		return span.SpanContext()
+	}
+}
+
+// Returns the context carrying the message's consumer span, for the spans of
+// its processing to be children of. The context is unchanged when tracing is
+// disabled.
+func (m Message) Context(ctx context.Context) context.Context {
+	if !m.span.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithSpanContext(ctx, m.span)
+}
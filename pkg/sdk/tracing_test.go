@@ -0,0 +1,171 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+	"github.com/orderly-queue/orderly/pkg/sdk/response"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func traced(t *testing.T) (context.Context, *sdk.Client, *sdktest.Server, *tracetest.SpanRecorder) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	t.Cleanup(cancel)
+
+	recorder := tracetest.NewSpanRecorder()
+	srv := sdktest.NewServer(t)
+	client := srv.Client(ctx, sdk.ClientConfig{
+		Tracing: sdk.TracingConfig{
+			Enabled:        true,
+			TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)),
+		},
+	})
+	return ctx, client, srv, recorder
+}
+
+func span(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	require.FailNow(t, "span not recorded", name)
+	return nil
+}
+
+func TestItPropagatesTheTraceFromProducerToConsumer(t *testing.T) {
+	ctx, client, srv, recorder := traced(t)
+
+	require.Nil(t, client.Push(ctx, "hello"))
+	push := span(t, recorder, "orderly.push")
+	require.Equal(t, trace.SpanKindProducer, push.SpanKind())
+	require.Contains(t, srv.Pushed("")[0].Headers["traceparent"], push.SpanContext().TraceID().String())
+
+	msgs, err := client.ConsumeMessages(ctx)
+	require.Nil(t, err)
+	msg := <-msgs
+	require.Nil(t, client.Ack(ctx, msg))
+
+	receive := span(t, recorder, "orderly.receive")
+	require.Equal(t, trace.SpanKindConsumer, receive.SpanKind())
+	require.Len(t, receive.Links(), 1)
+	require.Equal(t, push.SpanContext().SpanID(), receive.Links()[0].SpanContext.SpanID())
+	require.Equal(t, receive.SpanContext(), trace.SpanContextFromContext(msg.Context(ctx)))
+}
+
+func TestWorkersHandleMessagesInTheConsumerSpan(t *testing.T) {
+	ctx, client, srv, recorder := traced(t)
+
+	srv.Seed("", "hello")
+	handled := make(chan trace.SpanContext, 1)
+	worker := sdk.NewWorker(client, func(ctx context.Context, msg sdk.Message) error {
+		handled <- trace.SpanContextFromContext(ctx)
+		return nil
+	}, sdk.WorkerConfig{})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go worker.Run(ctx)
+
+	got := <-handled
+	require.True(t, got.IsValid())
+	require.Equal(t, span(t, recorder, "orderly.receive").SpanContext(), got)
+}
+
+func TestPoppedMessagesGetAConsumerSpan(t *testing.T) {
+	ctx, client, _, recorder := traced(t)
+
+	require.Nil(t, client.Push(ctx, "hello"))
+	push := span(t, recorder, "orderly.push")
+
+	msg, err := client.PopMessage(ctx)
+	require.Nil(t, err)
+	require.Nil(t, client.Ack(ctx, *msg))
+
+	receive := span(t, recorder, "orderly.receive")
+	require.Len(t, receive.Links(), 1)
+	require.Equal(t, push.SpanContext().SpanID(), receive.Links()[0].SpanContext.SpanID())
+	require.Equal(t, receive.SpanContext(), trace.SpanContextFromContext(msg.Context(ctx)))
+}
+
+// Records the spans the in-process server starts through the global provider
+func serverSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestServerSpansRecordFailedCommands(t *testing.T) {
+	recorder := serverSpans(t)
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	require.Error(t, client.Nack(ctx, sdk.Message{Seq: 1000}))
+
+	nack := span(t, recorder, "orderly.nack")
+	require.Equal(t, trace.SpanKindServer, nack.SpanKind())
+	require.Equal(t, codes.Error, nack.Status().Code)
+	require.Len(t, nack.Events(), 1)
+}
+
+func TestServerSpansOfConsumersEndWhenTheyStop(t *testing.T) {
+	recorder := serverSpans(t)
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+
+	srv.Seed("", "hello")
+	consumeCtx, stop := context.WithCancel(ctx)
+	msgs, err := client.Consume(consumeCtx)
+	require.Nil(t, err)
+	require.Equal(t, "hello", <-msgs)
+
+	ended := func() bool {
+		for _, span := range recorder.Ended() {
+			if span.Name() == "orderly.consume" && span.SpanKind() == trace.SpanKindServer {
+				return true
+			}
+		}
+		return false
+	}
+	require.False(t, ended())
+	stop()
+	require.Eventually(t, ended, time.Second, time.Millisecond*10)
+}
+
+func TestTheTracingInterceptorClosesItsStreamWhenTheConsumerStops(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	in := make(chan sdk.Received, 1)
+	in <- sdk.Received{Response: response.Build(uuid.New(), "hello")}
+	close(in)
+	interceptor := sdk.TracingStreamInterceptor(sdk.TracingConfig{
+		Enabled:        true,
+		TracerProvider: sdktrace.NewTracerProvider(),
+	})
+	out, err := interceptor(ctx, command.Command{Keyword: command.Consume}, func(context.Context, command.Command) (<-chan sdk.Received, error) {
+		return in, nil
+	})
+	require.Nil(t, err)
+
+	resp, ok := <-out
+	require.True(t, ok)
+	require.Equal(t, "hello", resp.Message)
+	_, ok = <-out
+	require.False(t, ok)
+}
@@ -0,0 +1,142 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pushes values of T encoded with the codec, stamping the codec's name on
+// each message
+type Producer[T any] struct {
+	client *Client
+	codec  Codec
+	opts   []Option
+}
+
+// Creates a producer that sends every message with the options
+func NewProducer[T any](client *Client, codec Codec, opts ...Option) *Producer[T] {
+	return &Producer[T]{client: client, codec: codec, opts: opts}
+}
+
+func (p *Producer[T]) encode(v T, opts []Option) (string, []Option, error) {
+	body, err := p.codec.Encode(v)
+	if err != nil {
+		return "", nil, err
+	}
+	out := append(append([]Option{}, p.opts...), opts...)
+	return body, append(out, WithHeader(HeaderCodec, p.codec.Name())), nil
+}
+
+func (p *Producer[T]) Push(ctx context.Context, v T, opts ...Option) error {
+	body, opts, err := p.encode(v, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToPush, err)
+	}
+	return p.client.Push(ctx, body, opts...)
+}
+
+func (p *Producer[T]) Publish(ctx context.Context, topic string, v T, opts ...Option) error {
+	body, opts, err := p.encode(v, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToPublish, err)
+	}
+	return p.client.Publish(ctx, topic, body, opts...)
+}
+
+// A decoded value along with the message it was delivered in, which must be
+// acked
+type Delivery[T any] struct {
+	Value   T
+	Message Message
+}
+
+// Pops and consumes values of T. Messages stamped with another codec are
+// decoded with it when the consumer was given it as a fallback, otherwise
+// they are rejected. Messages without a codec header are decoded with the
+// consumer's codec.
+type Consumer[T any] struct {
+	client *Client
+	codec  Codec
+	codecs map[string]Codec
+	opts   []Option
+}
+
+// Creates a consumer that consumes with the options
+func NewConsumer[T any](client *Client, codec Codec, opts ...Option) *Consumer[T] {
+	return &Consumer[T]{
+		client: client,
+		codec:  codec,
+		codecs: map[string]Codec{codec.Name(): codec},
+		opts:   opts,
+	}
+}
+
+// Decodes messages stamped with the codecs too, converting them to T
+func (c *Consumer[T]) Accept(codecs ...Codec) *Consumer[T] {
+	for _, codec := range codecs {
+		c.codecs[codec.Name()] = codec
+	}
+	return c
+}
+
+// Decodes the value from the message
+func (c *Consumer[T]) Decode(msg Message) (T, error) {
+	var out T
+	codec := c.codec
+	if name := msg.Headers[HeaderCodec]; name != "" {
+		var ok bool
+		if codec, ok = c.codecs[name]; !ok {
+			return out, fmt.Errorf("%w: expected %s, got %s", ErrCodecMismatch, c.codec.Name(), name)
+		}
+	}
+	err := codec.Decode(msg.Body, &out)
+	return out, err
+}
+
+// Pops the next message and decodes it. The message is returned along with
+// the error when it can't be decoded, so it can be acked or nacked.
+func (c *Consumer[T]) Pop(ctx context.Context, opts ...Option) (Delivery[T], error) {
+	msg, err := c.client.PopMessage(ctx, append(append([]Option{}, c.opts...), opts...)...)
+	if err != nil {
+		return Delivery[T]{}, err
+	}
+	v, err := c.Decode(*msg)
+	return Delivery[T]{Value: v, Message: *msg}, err
+}
+
+// Consumes and decodes messages. Messages that can't be decoded are failed
+// so they aren't delivered again.
+func (c *Consumer[T]) Consume(ctx context.Context, opts ...Option) (<-chan Delivery[T], error) {
+	msgs, err := c.client.ConsumeMessages(ctx, append(append([]Option{}, c.opts...), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Delivery[T], 100)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				v, err := c.Decode(msg)
+				if err != nil {
+					c.client.Fail(ctx, msg, err.Error())
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					c.client.Nack(context.WithoutCancel(ctx), msg)
+					return
+				case out <- Delivery[T]{Value: v, Message: msg}:
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
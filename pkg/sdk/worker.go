@@ -0,0 +1,232 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrHandlerPanicked = errors.New("handler panicked")
+)
+
+// Processes a message, returning an error retries it
+type Handler func(ctx context.Context, msg Message) error
+
+type WorkerConfig struct {
+	// The number of messages handled at once, defaults to 1
+	Concurrency int
+
+	// The options used to consume, such as the queue
+	Options []Option
+
+	// The delay before a failed message is delivered again, doubled for each
+	// attempt up to the max. The server holds the message for the delay, so
+	// the worker moves on to the next one.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// The number of attempts this worker makes at a message before it is
+	// failed rather than retried, 0 retries until it succeeds
+	MaxAttempts int
+
+	// Called when a handled message can't be acked, nacked or failed. The
+	// server delivers it again after its ack timeout.
+	OnError func(msg Message, err error)
+}
+
+func (w WorkerConfig) withDefaults() WorkerConfig {
+	if w.Concurrency <= 0 {
+		w.Concurrency = 1
+	}
+	if w.MinBackoff == 0 {
+		w.MinBackoff = time.Millisecond * 100
+	}
+	if w.MaxBackoff == 0 {
+		w.MaxBackoff = time.Second * 30
+	}
+	if w.OnError == nil {
+		w.OnError = func(Message, error) {}
+	}
+	return w
+}
+
+// An attempt count is forgotten when the message isn't attempted again within
+// this many max backoffs, it was most likely handled by another worker
+const forgetAfter = 10
+
+// Identifies a message across the queues and servers a worker consumes from
+type attemptKey struct {
+	link  *link
+	queue string
+	seq   uint64
+}
+
+type attempts struct {
+	count int
+	last  time.Time
+}
+
+// Consumes messages and runs the handler on them, acking the messages it
+// handles and retrying the ones it fails
+type Worker struct {
+	client  *Client
+	handler Handler
+	conf    WorkerConfig
+
+	// The number of times each message has been attempted
+	mu       *sync.Mutex
+	attempts map[attemptKey]attempts
+}
+
+func NewWorker(client *Client, handler Handler, conf WorkerConfig) *Worker {
+	return &Worker{
+		client:   client,
+		handler:  handler,
+		conf:     conf.withDefaults(),
+		mu:       &sync.Mutex{},
+		attempts: map[attemptKey]attempts{},
+	}
+}
+
+// Handles messages until the context is done, then waits for the handlers
+// that are running to finish. Messages that were delivered but not handled
+// are put back on the queue. An error is returned if the consumer stops first,
+// when the server refuses it after a reconnect.
+func (w *Worker) Run(ctx context.Context) error {
+	consumeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs, err := w.client.ConsumeMessages(consumeCtx, w.conf.Options...)
+	if err != nil {
+		return err
+	}
+
+	// Handlers finish what they started after the worker is stopped
+	handlerCtx := context.WithoutCancel(ctx)
+	wg := &sync.WaitGroup{}
+	for range w.conf.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg, ok := <-msgs:
+					if !ok {
+						return
+					}
+					w.process(handlerCtx, msg)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return w.stopped(ctx)
+			}
+			if err := w.client.Nack(handlerCtx, msg); err != nil {
+				w.conf.OnError(msg, err)
+			}
+		default:
+			return w.stopped(ctx)
+		}
+	}
+}
+
+// The error Run returns, the consumer stopping before the context was done
+// is a failure
+func (w *Worker) stopped(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("%w: the consumer stopped", ErrFailedToConsume)
+}
+
+// Handles the message, a failed message is nacked with a backoff or failed once
+// it has run out of attempts
+func (w *Worker) process(ctx context.Context, msg Message) {
+	w.inFlight(1)
+	defer w.inFlight(-1)
+
+	start := time.Now()
+	err := w.handle(msg.Context(ctx), msg)
+	result := "success"
+	switch {
+	case errors.Is(err, ErrHandlerPanicked):
+		result = "panic"
+	case err != nil:
+		result = "error"
+	}
+	if w.client.metrics.HandlerSecondHistogram != nil {
+		w.client.metrics.HandlerSecondHistogram.With(prometheus.Labels{"result": result}).Observe(time.Since(start).Seconds())
+	}
+
+	key := attemptKey{link: msg.link, queue: msg.Queue, seq: msg.Seq}
+	if err == nil {
+		w.forget(key)
+		w.settled(msg, w.client.Ack(ctx, msg))
+		return
+	}
+
+	attempt := w.attempt(key)
+	if w.conf.MaxAttempts > 0 && attempt >= w.conf.MaxAttempts {
+		w.forget(key)
+		w.settled(msg, w.client.Fail(ctx, msg, err.Error()))
+		return
+	}
+	backoff := min(w.conf.MinBackoff<<min(attempt-1, 32), w.conf.MaxBackoff)
+	w.settled(msg, w.client.NackAfter(ctx, msg, backoff))
+}
+
+func (w *Worker) settled(msg Message, err error) {
+	if err != nil {
+		w.conf.OnError(msg, err)
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanicked, r)
+		}
+	}()
+	return w.handler(ctx, msg)
+}
+
+// Counts an attempt at the message, returning the number of attempts made
+func (w *Worker) attempt(key attemptKey) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	for k, a := range w.attempts {
+		if now.Sub(a.last) > w.conf.MaxBackoff*forgetAfter {
+			delete(w.attempts, k)
+		}
+	}
+	a := w.attempts[key]
+	a.count++
+	a.last = now
+	w.attempts[key] = a
+	return a.count
+}
+
+func (w *Worker) forget(key attemptKey) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.attempts, key)
+}
+
+func (w *Worker) inFlight(delta float64) {
+	if w.client.metrics.HandlerInFlightGauge != nil {
+		w.client.metrics.HandlerInFlightGauge.Add(delta)
+	}
+}
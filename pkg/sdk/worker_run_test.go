@@ -0,0 +1,134 @@
+package sdk_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/sdk/sdktest"
+	"github.com/stretchr/testify/require"
+)
+
+// Runs the worker until the test ends, returning a channel closed when it has
+// stopped
+func run(ctx context.Context, t *testing.T, w *sdk.Worker) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.Nil(t, w.Run(ctx))
+	}()
+	return done
+}
+
+func TestAWorkerAcksTheMessagesItHandles(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+	srv.Seed("", "apple", "banana")
+
+	mu := &sync.Mutex{}
+	handled := []string{}
+	done := run(ctx, t, sdk.NewWorker(client, func(ctx context.Context, msg sdk.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, msg.Body)
+		return nil
+	}, sdk.WorkerConfig{}))
+
+	require.Eventually(t, func() bool {
+		return srv.Len("") == 0
+	}, time.Second*3, time.Millisecond*10)
+	mu.Lock()
+	require.ElementsMatch(t, []string{"apple", "banana"}, handled)
+	mu.Unlock()
+
+	cancel()
+	<-done
+}
+
+func TestAWorkerRetriesAFailedMessageAfterTheBackoff(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+	srv.Seed("", "apple")
+
+	backoff := time.Millisecond * 200
+	count := &atomic.Int32{}
+	attempts := make(chan time.Time, 2)
+	done := run(ctx, t, sdk.NewWorker(client, func(ctx context.Context, msg sdk.Message) error {
+		attempts <- time.Now()
+		if count.Add(1) == 1 {
+			return errors.New("try again")
+		}
+		return nil
+	}, sdk.WorkerConfig{MinBackoff: backoff}))
+
+	first := <-attempts
+	second := <-attempts
+	require.GreaterOrEqual(t, second.Sub(first), backoff)
+	require.Eventually(t, func() bool {
+		return srv.Len("") == 0
+	}, time.Second*3, time.Millisecond*10)
+
+	cancel()
+	<-done
+}
+
+func TestAWorkerFailsAMessageOnceItRunsOutOfAttempts(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+	job, err := client.PushJob(ctx, "apple")
+	require.Nil(t, err)
+
+	attempts := &atomic.Int32{}
+	done := run(ctx, t, sdk.NewWorker(client, func(ctx context.Context, msg sdk.Message) error {
+		attempts.Add(1)
+		return errors.New("broken")
+	}, sdk.WorkerConfig{MinBackoff: time.Millisecond, MaxAttempts: 3}))
+
+	_, err = job.Wait(ctx)
+	require.ErrorIs(t, err, sdk.ErrJobFailed)
+	require.ErrorContains(t, err, "broken")
+	require.Equal(t, int32(3), attempts.Load())
+	require.Equal(t, uint(0), srv.Len(""))
+
+	cancel()
+	<-done
+}
+
+func TestAStoppedWorkerFinishesTheMessagesItIsHandling(t *testing.T) {
+	srv := sdktest.NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	client := srv.Client(ctx)
+	srv.Seed("", "apple")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	workerCtx, stop := context.WithCancel(ctx)
+	done := run(workerCtx, t, sdk.NewWorker(client, func(ctx context.Context, msg sdk.Message) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	}, sdk.WorkerConfig{}))
+
+	<-started
+	stop()
+	select {
+	case <-done:
+		t.Fatal("worker stopped before its handler finished")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	close(release)
+	<-done
+	require.Equal(t, uint(0), srv.Len(""))
+}
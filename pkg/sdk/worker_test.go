@@ -0,0 +1,48 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestItRecoversFromPanickingHandlers(t *testing.T) {
+	w := NewWorker(nil, func(ctx context.Context, msg Message) error {
+		if msg.Body == "panic" {
+			panic("oh no")
+		}
+		return errors.New(msg.Body)
+	}, WorkerConfig{})
+
+	err := w.handle(context.Background(), Message{Body: "panic"})
+	require.ErrorIs(t, err, ErrHandlerPanicked)
+	require.ErrorContains(t, err, "oh no")
+
+	err = w.handle(context.Background(), Message{Body: "failed"})
+	require.NotErrorIs(t, err, ErrHandlerPanicked)
+	require.EqualError(t, err, "failed")
+}
+
+func TestItCountsAttempts(t *testing.T) {
+	w := NewWorker(nil, nil, WorkerConfig{})
+	require.Equal(t, 1, w.conf.Concurrency)
+
+	key := attemptKey{queue: "orders", seq: 5}
+	require.Equal(t, 1, w.attempt(key))
+	require.Equal(t, 2, w.attempt(key))
+	// The same sequence number on another queue is another message
+	require.Equal(t, 1, w.attempt(attemptKey{queue: "emails", seq: 5}))
+	w.forget(key)
+	require.Equal(t, 1, w.attempt(key))
+}
+
+func TestItForgetsAttemptsAtMessagesItDoesNotSeeAgain(t *testing.T) {
+	w := NewWorker(nil, nil, WorkerConfig{MaxBackoff: time.Millisecond})
+	require.Equal(t, 1, w.attempt(attemptKey{seq: 1}))
+	time.Sleep(time.Millisecond * 20)
+	require.Equal(t, 1, w.attempt(attemptKey{seq: 2}))
+	require.NotContains(t, w.attempts, attemptKey{seq: 1})
+}
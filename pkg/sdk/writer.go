@@ -0,0 +1,119 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"runtime"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/orderly-queue/orderly/pkg/sdk/command"
+)
+
+// The most frames written in one flush, so a busy queue can't starve the
+// reconnect of the tx lock
+const maxCoalesced = 256
+
+// Wraps the connection so the writes made while it's corked are buffered and
+// sent together when it's uncorked
+type corkedConn struct {
+	net.Conn
+
+	mu     *sync.Mutex
+	buf    *bufio.Writer
+	corked bool
+}
+
+func newCorkedConn(conn net.Conn) *corkedConn {
+	return &corkedConn{
+		Conn: conn,
+		mu:   &sync.Mutex{},
+		buf:  bufio.NewWriterSize(conn, 64*1024),
+	}
+}
+
+func (c *corkedConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.corked {
+		return c.buf.Write(p)
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *corkedConn) cork() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.corked = true
+}
+
+func (c *corkedConn) uncork() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.corked = false
+	return c.buf.Flush()
+}
+
+// Writes the frames queued on the link to its connection. Frames queued whilst
+// it's writing are coalesced into a single flush.
+func (c *Client) write(ctx context.Context, l *link) {
+	defer c.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.closed:
+			return
+		case frame := <-l.frames:
+			l.tx.Lock()
+			if err := c.flush(l, frame); err != nil {
+				if c.metrics.TransimitErrorCounter != nil {
+					c.metrics.TransimitErrorCounter.Inc()
+				}
+				// The read fails after this, which reconnects or closes the
+				// client
+				l.conn.Close()
+			}
+			l.tx.Unlock()
+		}
+	}
+}
+
+// Writes the frame and any queued behind it, must be called with the link's tx
+// held
+func (c *Client) flush(l *link, frame command.Command) error {
+	if len(l.frames) == 0 {
+		// Give the other senders a chance to queue their frames behind it
+		runtime.Gosched()
+	}
+	if len(l.frames) == 0 {
+		return l.conn.WriteMessage(websocket.TextMessage, []byte(frame.Encode(l.version)))
+	}
+	l.cork.cork()
+	err := l.conn.WriteMessage(websocket.TextMessage, []byte(frame.Encode(l.version)))
+	for n := 1; err == nil && n < maxCoalesced; n++ {
+		select {
+		case frame = <-l.frames:
+			err = l.conn.WriteMessage(websocket.TextMessage, []byte(frame.Encode(l.version)))
+			continue
+		default:
+		}
+		break
+	}
+	if ferr := l.cork.uncork(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// Drops the frames queued for a connection that has gone
+func (c *Client) discard(l *link) {
+	for {
+		select {
+		case <-l.frames:
+		default:
+			return
+		}
+	}
+}
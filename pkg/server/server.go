@@ -0,0 +1,83 @@
+// Package server runs orderly in-process, for embedding it in other binaries
+// and integration harnesses
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/orderly-queue/orderly/internal/queue"
+	"github.com/orderly-queue/orderly/internal/server"
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/thanos-io/objstore"
+)
+
+var (
+	ErrAlreadyStarted = server.ErrAlreadyStarted
+)
+
+// Aliases so the types the registry deals in can be named outside the module
+type (
+	Registry    = queue.Registry
+	Queue       = queue.Queue
+	PushOptions = queue.PushOptions
+	Message     = queue.Message
+	Binding     = queue.Binding
+	Schedule    = queue.Schedule
+	Job         = queue.Job
+)
+
+type Option = server.Option
+
+// Stores snapshots in the bucket rather than the one in the storage config,
+// storage is enabled when it's set
+func WithBucket(bucket objstore.Bucket) Option {
+	return server.WithBucket(bucket)
+}
+
+// Stores snapshots in memory, they are lost when the process exits
+func WithMemoryStorage() Option {
+	return server.WithMemoryStorage()
+}
+
+// The version reported by the server
+func WithVersion(version string) Option {
+	return server.WithVersion(version)
+}
+
+type Server struct {
+	srv *server.Server
+}
+
+// Builds a server from a copy of the config with its defaults set, the copy
+// is validated
+func New(ctx context.Context, conf *config.Config, opts ...Option) (*Server, error) {
+	srv, err := server.New(ctx, conf, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{srv: srv}, nil
+}
+
+// The queues, topics, bindings and schedules the server holds
+func (s *Server) Queues() *Registry {
+	return s.srv.Queues()
+}
+
+// The handler serving the api, for mounting it on another http server rather
+// than calling Start
+func (s *Server) Handler() http.Handler {
+	return s.srv.Handler()
+}
+
+// Restores the latest snapshot and serves the api until the context is
+// cancelled or Stop is called. A final snapshot is taken before it returns.
+func (s *Server) Start(ctx context.Context) error {
+	return s.srv.Start(ctx)
+}
+
+// Stops the server and waits for Start to return, or for the context to be
+// cancelled
+func (s *Server) Stop(ctx context.Context) error {
+	return s.srv.Stop(ctx)
+}
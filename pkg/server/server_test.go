@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/orderly-queue/orderly/pkg/config"
+	"github.com/orderly-queue/orderly/pkg/sdk"
+	"github.com/orderly-queue/orderly/pkg/server"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func port(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func secret(t *testing.T) string {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.Nil(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func conf(t *testing.T) *config.Config {
+	conf := &config.Config{
+		Name:          "embedded",
+		JwtSecret:     secret(t),
+		EncryptionKey: "base64:32:" + secret(t),
+	}
+	conf.Http.Port = port(t)
+	conf.Probes.Port = port(t)
+	conf.Telemetry.Metrics.Port = port(t)
+	return conf
+}
+
+func TestItRunsInProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	bucket := objstore.NewInMemBucket()
+	c := conf(t)
+	c.Queue.Snapshot.Enabled = true
+
+	srv, err := server.New(ctx, c, server.WithBucket(bucket))
+	require.Nil(t, err)
+
+	started := make(chan error, 1)
+	go func() {
+		started <- srv.Start(ctx)
+	}()
+
+	var client *sdk.Client
+	require.Eventually(t, func() bool {
+		client, err = sdk.NewClient(ctx, sdk.ClientConfig{
+			Endpoint: fmt.Sprintf("http://127.0.0.1:%d", c.Http.Port),
+		})
+		return err == nil
+	}, time.Second*5, time.Millisecond*20)
+	defer client.Close()
+
+	require.Nil(t, client.Push(ctx, "embedded"))
+	require.Equal(t, uint(1), srv.Queues().Default().Len())
+
+	require.Nil(t, srv.Stop(ctx))
+	require.Nil(t, <-started)
+	require.ErrorIs(t, srv.Start(ctx), server.ErrAlreadyStarted)
+
+	// The final snapshot is shipped to the bucket on stop
+	snapshots := 0
+	require.Nil(t, bucket.Iter(ctx, "", func(string) error {
+		snapshots++
+		return nil
+	}, objstore.WithRecursiveIter()))
+	require.NotZero(t, snapshots)
+}
+
+func TestItRejectsInvalidConfig(t *testing.T) {
+	_, err := server.New(context.Background(), &config.Config{})
+	require.Error(t, err)
+}
+
+func TestItDoesNotChangeTheCallersConfig(t *testing.T) {
+	c := conf(t)
+	_, err := server.New(context.Background(), c, server.WithMemoryStorage())
+	require.Nil(t, err)
+	require.False(t, c.Storage.Enabled)
+	require.Zero(t, c.Queue.AckTimeout)
+}
+
+// Starts the server and returns a client connected to it once it's serving
+func serve(ctx context.Context, t *testing.T, srv *server.Server, c *config.Config) *sdk.Client {
+	go srv.Start(ctx)
+	t.Cleanup(func() { srv.Stop(context.Background()) })
+
+	var client *sdk.Client
+	require.Eventually(t, func() bool {
+		var err error
+		client, err = sdk.NewClient(ctx, sdk.ClientConfig{
+			Endpoint: fmt.Sprintf("http://127.0.0.1:%d", c.Http.Port),
+		})
+		return err == nil
+	}, time.Second*5, time.Millisecond*20)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAStandbyRefusesSubscriptionsUntilItHasRestored(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	bucket := objstore.NewInMemBucket()
+	standbyConf := func() *config.Config {
+		c := conf(t)
+		c.Queue.Snapshot.Enabled = true
+		c.Queue.Snapshot.Lease = config.Lease{Enabled: true, Standby: true, TTL: time.Minute}
+		return c
+	}
+
+	leaderConf := standbyConf()
+	leader, err := server.New(ctx, leaderConf, server.WithBucket(bucket))
+	require.Nil(t, err)
+	serve(ctx, t, leader, leaderConf)
+
+	c := standbyConf()
+	standby, err := server.New(ctx, c, server.WithBucket(bucket))
+	require.Nil(t, err)
+	client := serve(ctx, t, standby, c)
+
+	_, err = client.Subscribe(ctx, "orders", "emails")
+	require.ErrorContains(t, err, "not been restored")
+	require.ErrorContains(t, client.Unsubscribe(ctx, "orders", "emails"), "not been restored")
+	_, err = client.Request(ctx, "ping")
+	require.ErrorContains(t, err, "not been restored")
+}